@@ -12,6 +12,7 @@
 package main
 
 import (
+	"context"
 	"crypto"
 	"fmt"
 	"os"
@@ -21,6 +22,7 @@ import (
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
 	"github.com/rdimitrov/go-tuf-metadata/metadata/repository"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/repository/storage"
 	"github.com/sigstore/sigstore/pkg/signature"
 	"golang.org/x/crypto/ed25519"
 )
@@ -108,24 +110,11 @@ func main() {
 	}
 	// Save to metadata folder
 	cwd = filepath.Join(cwd, "metadata")
-	for _, name := range []string{"targets", "snapshot", "timestamp", "root"} {
-		switch name {
-		case "targets":
-			filename := fmt.Sprintf("%d.%s.json", roles.Targets("targets").Signed.Version, name)
-			err = roles.Targets("targets").ToFile(filepath.Join(cwd, filename), true)
-		case "snapshot":
-			filename := fmt.Sprintf("%d.%s.json", roles.Snapshot().Signed.Version, name)
-			err = roles.Snapshot().ToFile(filepath.Join(cwd, filename), true)
-		case "timestamp":
-			filename := fmt.Sprintf("%s.json", name)
-			err = roles.Timestamp().ToFile(filepath.Join(cwd, filename), true)
-		case "root":
-			filename := fmt.Sprintf("%d.%s.json", roles.Root().Signed.Version, name)
-			err = roles.Root().ToFile(filepath.Join(cwd, filename), true)
-		}
-		if err != nil {
-			panic(fmt.Sprintln("generate_metadata.go:", "saving metadata to file failed", err))
-		}
+	// Publish the metadata, the timestamp metadata last so that clients
+	// never see it before the files it lists
+	err = roles.PublishMetadata(context.Background(), storage.NewFileStorage(cwd))
+	if err != nil {
+		panic(fmt.Sprintln("generate_metadata.go:", "saving metadata to file failed", err))
 	}
 
 	// Save the created root metadata in the client folder, this is the initial trusted root metadata
@@ -0,0 +1,192 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package bundle exports and reads bundles of TUF metadata and target
+// files shipped to clients without network access.
+//
+// A bundle is laid out like a served repository: the metadata files are
+// in a "metadata" directory, named as the Updater downloads them (e.g.
+// "2.root.json", "timestamp.json", "1.snapshot.json"), and the target
+// files, if any, are in a "targets" directory. Bundles written by Export
+// hold the target files under their path, without the hash prefix of
+// consistent snapshots, which is where Import looks for them. A bundle
+// can be a plain directory, a tarball, optionally compressed with gzip,
+// or a zip archive. It is either verified in place with
+// updater.NewOffline or imported into the local cache of a client with
+// Import.
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MetadataDir is the directory of a bundle holding the metadata files
+	MetadataDir = "metadata"
+	// TargetsDir is the directory of a bundle holding the target files
+	TargetsDir = "targets"
+	// MaxFileSize is the size in bytes above which ReadTar refuses to
+	// extract a file
+	MaxFileSize = 4 << 30
+	// MaxSize is the total size in bytes above which ReadTar refuses to
+	// extract the files of a tarball
+	MaxSize = 16 << 30
+)
+
+// Bundle is an opened bundle, which must be closed once no longer used
+type Bundle struct {
+	fs.FS
+	// dir is the temporary directory a tarball is extracted to
+	dir    string
+	closer io.Closer
+}
+
+// Close releases the resources of the bundle, such as the temporary
+// directory a tarball is extracted to
+func (b *Bundle) Close() error {
+	var err error
+	if b.closer != nil {
+		err = b.closer.Close()
+	}
+	if b.dir != "" {
+		err = errors.Join(err, os.RemoveAll(b.dir))
+	}
+	return err
+}
+
+// Open opens the bundle at name, which is either a directory or an
+// archive. Zip archives are read in place, tarballs are extracted to a
+// temporary directory removed by Bundle.Close.
+func Open(name string) (*Bundle, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &Bundle{FS: os.DirFS(name)}, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	_, err = io.ReadFull(file, magic)
+	if err == nil && bytes.Equal(magic, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &Bundle{FS: zr, closer: file}, nil
+	}
+	defer file.Close()
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return ReadTar(file)
+}
+
+// ReadTar reads a bundle from a tarball, which may be compressed with
+// gzip, by extracting it to a temporary directory removed by
+// Bundle.Close. Only the regular files of the tarball are kept, no
+// larger than MaxFileSize and MaxSize in total.
+func ReadTar(r io.Reader) (*Bundle, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+	dir, err := os.MkdirTemp("", "tuf-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{FS: os.DirFS(dir), dir: dir}
+	err = extractTar(r, dir, MaxFileSize, MaxSize)
+	if err != nil {
+		return nil, errors.Join(err, bundle.Close())
+	}
+	return bundle, nil
+}
+
+// extractTar writes the regular files of the tarball read from r below
+// dir, failing on any file larger than maxFileSize or once the files add
+// up to more than maxSize
+func extractTar(r io.Reader, dir string, maxFileSize, maxSize int64) error {
+	tr := tar.NewReader(r)
+	var size int64
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean(header.Name), "/")
+		if !fs.ValidPath(name) || !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("invalid file name %q in bundle", header.Name)
+		}
+		// the tar reader returns no more than the size of the header
+		if header.Size > maxFileSize {
+			return fmt.Errorf("file %q in bundle is larger than %d bytes", header.Name, maxFileSize)
+		}
+		size += header.Size
+		if size > maxSize {
+			return fmt.Errorf("files in bundle are larger than %d bytes", maxSize)
+		}
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(fileName), 0755)
+		if err != nil {
+			return err
+		}
+		err = writeFile(fileName, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeFile writes the content read from r to the file at name
+func writeFile(name string, r io.Reader) error {
+	out, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
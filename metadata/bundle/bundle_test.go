@@ -0,0 +1,272 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+var bundleFiles = map[string]string{
+	"metadata/1.root.json":    "root",
+	"metadata/timestamp.json": "timestamp",
+	"targets/dir/file.txt":    "target",
+}
+
+// writeTar writes bundleFiles as a tarball named name, with their names
+// prefixed by prefix
+func writeTar(t *testing.T, name, prefix string, compress bool) {
+	out, err := os.Create(name)
+	assert.NoError(t, err)
+	defer out.Close()
+	var w io.Writer = out
+	if compress {
+		gz := gzip.NewWriter(out)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: prefix + "metadata/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for fileName, content := range bundleFiles {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: prefix + fileName, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "bundle")
+	for fileName, content := range bundleFiles {
+		name := filepath.Join(dir, filepath.FromSlash(fileName))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, os.WriteFile(name, []byte(content), 0644))
+	}
+	writeTar(t, filepath.Join(tmpDir, "bundle.tar"), "", false)
+	writeTar(t, filepath.Join(tmpDir, "bundle.tar.gz"), "./", true)
+
+	for _, name := range []string{"bundle", "bundle.tar", "bundle.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			bundle, err := Open(filepath.Join(tmpDir, name))
+			assert.NoError(t, err)
+			for fileName, content := range bundleFiles {
+				data, err := fs.ReadFile(bundle, fileName)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte(content), data)
+			}
+			_, err = bundle.Open("metadata/snapshot.json")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+			// tarballs are extracted to a temporary directory
+			assert.Equal(t, name != "bundle", bundle.dir != "")
+			assert.NoError(t, bundle.Close())
+			if bundle.dir != "" {
+				_, err = os.Stat(bundle.dir)
+				assert.ErrorIs(t, err, fs.ErrNotExist)
+			}
+		})
+	}
+
+	_, err := Open(filepath.Join(tmpDir, "missing.tar"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestReadTarInvalidName(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "../root.json", Typeflag: tar.TypeReg, Mode: 0644}))
+	assert.NoError(t, tw.Close())
+	_, err := ReadTar(&buf)
+	assert.ErrorContains(t, err, `invalid file name "../root.json" in bundle`)
+}
+
+func TestExtractTarTooLarge(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		maxFileSize int64
+		maxSize     int64
+		wantErr     string
+	}{
+		{name: "fits", maxFileSize: 9, maxSize: 19},
+		{name: "file too large", maxFileSize: 8, maxSize: 19, wantErr: "is larger than 8 bytes"},
+		{name: "files too large", maxFileSize: 9, maxSize: 18, wantErr: "files in bundle are larger than 18 bytes"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "bundle.tar")
+			writeTar(t, name, "", false)
+			file, err := os.Open(name)
+			assert.NoError(t, err)
+			defer file.Close()
+			err = extractTar(file, t.TempDir(), tt.maxFileSize, tt.maxSize)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// streamFetcher serves the metadata of the simulator as whole files and
+// its target files as streams only
+type streamFetcher struct {
+	*simulator.RepositorySimulator
+	targetsURL string
+}
+
+func (f streamFetcher) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	if strings.HasPrefix(urlPath, f.targetsURL) {
+		return nil, metadata.ErrValue{Msg: "target files must be streamed"}
+	}
+	return f.RepositorySimulator.DownloadFile(ctx, urlPath, maxLength)
+}
+
+func (f streamFetcher) DownloadFileStream(ctx context.Context, urlPath string, maxLength int64) (io.ReadCloser, error) {
+	data, err := f.RepositorySimulator.DownloadFile(ctx, urlPath, maxLength)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestExportImport(t *testing.T) {
+	sim, metadataDir, targetsDir, err := simulator.InitMetadataDir()
+	assert.NoError(t, err)
+	defer simulator.RepositoryCleanup(simulator.LocalDir)
+	rootBytes, err := simulator.GetRootBytes(metadataDir)
+	assert.NoError(t, err)
+	sim.AddTarget(metadata.TARGETS, []byte("top-level target"), "file.txt")
+	sim.AddDelegation(metadata.TARGETS, metadata.DelegatedRole{
+		Name:      "role1",
+		KeyIDs:    []string{},
+		Threshold: 1,
+		Paths:     []string{"dir/*"},
+	}, metadata.Targets(sim.SafeExpiry).Signed)
+	sim.AddTarget("role1", []byte("delegated target"), "dir/file.txt")
+	// a sibling role which the lookups prefetch without needing it
+	sim.AddDelegation(metadata.TARGETS, metadata.DelegatedRole{
+		Name:      "role2",
+		KeyIDs:    []string{},
+		Threshold: 1,
+		Paths:     []string{"dir/*"},
+	}, metadata.Targets(sim.SafeExpiry).Signed)
+	sim.MDRoot.Signed.Version += 1
+	sim.PublishRoot()
+	sim.UpdateSnapshot()
+	targetPaths := []string{"file.txt", "dir/file.txt"}
+
+	for _, tt := range []struct {
+		name   string
+		format Format
+	}{
+		{name: "bundle.tar.gz", format: TarGz},
+		{name: "bundle.zip", format: Zip},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exportCfg, err := config.New(metadataDir, rootBytes)
+			assert.NoError(t, err)
+			exportCfg.Fetcher = streamFetcher{RepositorySimulator: sim, targetsURL: targetsDir}
+			exportCfg.RemoteTargetsURL = targetsDir
+			exportCfg.PrefetchDelegations = true
+			var buf bytes.Buffer
+			assert.NoError(t, Export(&buf, exportCfg, targetPaths, tt.format))
+			name := filepath.Join(t.TempDir(), tt.name)
+			assert.NoError(t, os.WriteFile(name, buf.Bytes(), 0644))
+
+			bundle, err := Open(name)
+			assert.NoError(t, err)
+			defer bundle.Close()
+			manifest, err := ReadManifest(bundle)
+			assert.NoError(t, err)
+			assert.Equal(t, targetPaths, manifest.Targets)
+			// the target files are stored under their path, whatever the
+			// names served by the repository
+			for _, fileName := range []string{"metadata/2.root.json", "metadata/timestamp.json", "metadata/1.targets.json", "metadata/1.role1.json", "targets/file.txt", "targets/dir/file.txt"} {
+				_, err := fs.Stat(bundle, fileName)
+				assert.NoError(t, err, fileName)
+			}
+			// the root chain starts after the root trusted by the clients,
+			// and the roles no lookup needs are left out
+			for _, fileName := range []string{"metadata/1.root.json", "metadata/1.role2.json"} {
+				_, err = fs.Stat(bundle, fileName)
+				assert.ErrorIs(t, err, fs.ErrNotExist, fileName)
+			}
+
+			clientCfg, err := config.New("https://example.com/metadata", rootBytes)
+			assert.NoError(t, err)
+			clientCfg.LocalMetadataDir = filepath.Join(t.TempDir(), "metadata")
+			clientCfg.LocalTargetsDir = filepath.Join(t.TempDir(), "targets")
+			assert.NoError(t, Import(clientCfg, bundle))
+			for _, role := range []string{metadata.ROOT, metadata.TIMESTAMP, metadata.SNAPSHOT, metadata.TARGETS, "role1"} {
+				_, err := os.Stat(filepath.Join(clientCfg.LocalMetadataDir, role+".json"))
+				assert.NoError(t, err, role)
+			}
+			root, err := metadata.Root().FromFile(filepath.Join(clientCfg.LocalMetadataDir, "root.json"))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), root.Signed.Version)
+			data, err := os.ReadFile(filepath.Join(clientCfg.LocalTargetsDir, url.QueryEscape("dir/file.txt")))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("delegated target"), data)
+		})
+	}
+}
+
+func TestImportTampered(t *testing.T) {
+	sim, metadataDir, targetsDir, err := simulator.InitMetadataDir()
+	assert.NoError(t, err)
+	defer simulator.RepositoryCleanup(simulator.LocalDir)
+	rootBytes, err := simulator.GetRootBytes(metadataDir)
+	assert.NoError(t, err)
+	sim.AddTarget(metadata.TARGETS, []byte("target"), "file.txt")
+	sim.UpdateSnapshot()
+
+	exportCfg, err := config.New(metadataDir, rootBytes)
+	assert.NoError(t, err)
+	exportCfg.Fetcher = sim
+	exportCfg.RemoteTargetsURL = targetsDir
+	var buf bytes.Buffer
+	assert.NoError(t, Export(&buf, exportCfg, []string{"file.txt"}, TarGz))
+	bundle, err := ReadTar(&buf)
+	assert.NoError(t, err)
+	defer bundle.Close()
+	err = os.WriteFile(filepath.Join(bundle.dir, TargetsDir, "file.txt"), []byte("tamper"), 0644)
+	assert.NoError(t, err)
+
+	clientCfg, err := config.New("https://example.com/metadata", rootBytes)
+	assert.NoError(t, err)
+	clientCfg.LocalMetadataDir = t.TempDir()
+	clientCfg.LocalTargetsDir = t.TempDir()
+	err = Import(clientCfg, bundle)
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{})
+	_, err = os.Stat(filepath.Join(clientCfg.LocalTargetsDir, "file.txt"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	clientCfg.DisableLocalCache = true
+	err = Import(clientCfg, bundle)
+	assert.ErrorIs(t, err, metadata.ErrValue{Msg: "can not import a bundle with the local cache disabled"})
+	assert.ErrorIs(t, Export(&buf, exportCfg, nil, Format(-1)), metadata.ErrValue{Msg: "unknown bundle format -1"})
+}
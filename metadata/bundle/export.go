@@ -0,0 +1,262 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/store"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/updater"
+)
+
+// Format is the archive format of an exported bundle
+type Format int
+
+const (
+	// TarGz writes a tarball compressed with gzip
+	TarGz Format = iota
+	// Zip writes a zip archive
+	Zip
+)
+
+// Export downloads and verifies the metadata and target files a client
+// needs to look up and download targetPaths, following cfg as an Updater
+// would, and writes them as a bundle to w.
+//
+// The bundle holds the root chain starting after cfg.LocalTrustedRoot,
+// which should thus be the oldest root trusted by the clients importing
+// it, the top-level metadata, the metadata of the delegated roles along
+// the delegation path of each target and the target files, along with a
+// manifest listing targetPaths. The target files are streamed to w as
+// they are downloaded, so w holds an incomplete bundle to discard if an
+// error is returned. The local cache of cfg is neither used nor written
+// to.
+func Export(w io.Writer, cfg *config.UpdaterConfig, targetPaths []string, format Format) error {
+	archive, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	// the metadata is recorded as the Updater persists it, i.e. once it
+	// is verified and only for the roles a lookup actually loaded
+	recorder := &recordingStore{
+		MemoryStore: store.NewMemoryStore(),
+		metadata:    map[string][]byte{},
+	}
+	exportCfg := *cfg
+	exportCfg.Store = recorder
+	exportCfg.DisableLocalCache = false
+	exportCfg.UnsafeLocalMode = false
+	up, err := updater.New(&exportCfg)
+	if err != nil {
+		return err
+	}
+	// the initial root is trusted by the clients already
+	recorder.roots = nil
+	err = up.Refresh()
+	if err != nil {
+		return err
+	}
+	targetFiles := make([]*metadata.TargetFiles, 0, len(targetPaths))
+	for _, targetPath := range targetPaths {
+		targetFile, err := up.GetTargetInfo(targetPath)
+		if err != nil {
+			return err
+		}
+		targetFiles = append(targetFiles, targetFile)
+	}
+	// all the metadata is loaded once the target files are looked up
+	files, err := recorder.files(up.GetTrustedMetadataSet().Root.Signed.ConsistentSnapshot)
+	if err != nil {
+		return err
+	}
+	manifest, err := json.MarshalIndent(Manifest{Targets: targetPaths}, "", "  ")
+	if err != nil {
+		return err
+	}
+	files[ManifestName] = manifest
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err = archive.writeFile(name, files[name])
+		if err != nil {
+			return err
+		}
+	}
+	written := map[string]bool{}
+	for _, targetFile := range targetFiles {
+		if written[targetFile.Path] {
+			continue
+		}
+		written[targetFile.Path] = true
+		if !fs.ValidPath(targetFile.Path) {
+			return metadata.ErrValue{Msg: fmt.Sprintf("target path %s can not be stored in a bundle", targetFile.Path)}
+		}
+		out, err := archive.create(path.Join(TargetsDir, targetFile.Path), targetFile.Length)
+		if err != nil {
+			return err
+		}
+		err = up.DownloadTargetTo(targetFile, out, "")
+		if err != nil {
+			return err
+		}
+	}
+	return archive.close()
+}
+
+// archiveWriter writes the files of a bundle to an archive
+type archiveWriter struct {
+	tw      *tar.Writer
+	gz      *gzip.Writer
+	zw      *zip.Writer
+	modTime time.Time
+}
+
+// newArchiveWriter creates an archiveWriter writing an archive of the
+// given format to w
+func newArchiveWriter(w io.Writer, format Format) (*archiveWriter, error) {
+	archive := &archiveWriter{modTime: time.Now().UTC()}
+	switch format {
+	case TarGz:
+		archive.gz = gzip.NewWriter(w)
+		archive.tw = tar.NewWriter(archive.gz)
+	case Zip:
+		archive.zw = zip.NewWriter(w)
+	default:
+		return nil, metadata.ErrValue{Msg: fmt.Sprintf("unknown bundle format %d", format)}
+	}
+	return archive, nil
+}
+
+// create adds the file at name, whose size bytes of content are written
+// to the returned writer
+func (a *archiveWriter) create(name string, size int64) (io.Writer, error) {
+	if a.zw != nil {
+		return a.zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: a.modTime,
+		})
+	}
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  a.modTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.tw, nil
+}
+
+// writeFile adds the file at name with the given content
+func (a *archiveWriter) writeFile(name string, data []byte) error {
+	out, err := a.create(name, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// close completes the archive
+func (a *archiveWriter) close() error {
+	if a.zw != nil {
+		return a.zw.Close()
+	}
+	err := a.tw.Close()
+	if err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// recordingStore is a memory store recording the metadata written to it
+type recordingStore struct {
+	*store.MemoryStore
+	mu sync.Mutex
+	// roots are the root metadata written, one per version
+	roots [][]byte
+	// metadata maps the other roles to the metadata written last
+	metadata map[string][]byte
+}
+
+// WriteMetadata writes the metadata of roleName and records it
+func (s *recordingStore) WriteMetadata(roleName string, data []byte) error {
+	err := s.MemoryStore.WriteMetadata(roleName, data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if roleName == metadata.ROOT {
+		s.roots = append(s.roots, data)
+	} else {
+		s.metadata[roleName] = data
+	}
+	return nil
+}
+
+// files returns the recorded metadata under its name in the bundle, which
+// is the name the Updater downloads it from
+func (s *recordingStore) files(consistentSnapshot bool) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := map[string][]byte{}
+	for _, data := range s.roots {
+		version, err := metadataVersion(data)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Join(MetadataDir, fmt.Sprintf("%d.%s.json", version, metadata.ROOT))] = data
+	}
+	for roleName, data := range s.metadata {
+		name := fmt.Sprintf("%s.json", url.QueryEscape(roleName))
+		if consistentSnapshot && roleName != metadata.TIMESTAMP {
+			version, err := metadataVersion(data)
+			if err != nil {
+				return nil, err
+			}
+			name = fmt.Sprintf("%d.%s", version, name)
+		}
+		files[path.Join(MetadataDir, name)] = data
+	}
+	return files, nil
+}
+
+// metadataVersion returns the version of the metadata in data
+func metadataVersion(data []byte) (int64, error) {
+	var md struct {
+		Signed struct {
+			Version int64 `json:"version"`
+		} `json:"signed"`
+	}
+	err := json.Unmarshal(data, &md)
+	return md.Signed.Version, err
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package bundle
+
+import (
+	"encoding/json"
+	"io/fs"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/fetcher"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/updater"
+)
+
+// ManifestName is the name of the manifest of an exported bundle
+const ManifestName = "bundle.json"
+
+// Manifest describes the content of an exported bundle
+type Manifest struct {
+	// Targets lists the paths of the target files in the bundle
+	Targets []string `json:"targets"`
+}
+
+// ReadManifest reads the manifest of bundle
+func ReadManifest(bundle fs.FS) (*Manifest, error) {
+	data, err := fs.ReadFile(bundle, ManifestName)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Import verifies an exported bundle and stores its metadata and the
+// target files listed in its manifest in the local cache of cfg, i.e. in
+// cfg.LocalMetadataDir and cfg.LocalTargetsDir or cfg.Store.
+//
+// The bundle goes through the whole client workflow of an Updater created
+// with cfg, as if it was served by the remote repository, so it is
+// verified against the trusted root and the metadata already cached.
+func Import(cfg *config.UpdaterConfig, bundle fs.FS) error {
+	if cfg.DisableLocalCache {
+		return metadata.ErrValue{Msg: "can not import a bundle with the local cache disabled"}
+	}
+	manifest, err := ReadManifest(bundle)
+	if err != nil {
+		return err
+	}
+	importCfg := *cfg
+	importCfg.Fetcher = fetcher.NewFSFetcher(bundle)
+	importCfg.RemoteMetadataURL = MetadataDir
+	importCfg.RemoteTargetsURL = TargetsDir
+	importCfg.MetadataMirrorURLs = nil
+	importCfg.TargetsMirrorURLs = nil
+	importCfg.UnsafeLocalMode = false
+	// the target files are in the bundle under their path
+	importCfg.PrefixTargetsWithHash = false
+	up, err := updater.New(&importCfg)
+	if err != nil {
+		return err
+	}
+	err = up.Refresh()
+	if err != nil {
+		return err
+	}
+	for _, targetPath := range manifest.Targets {
+		targetFile, err := up.GetTargetInfo(targetPath)
+		if err != nil {
+			return err
+		}
+		_, _, err = up.DownloadTarget(targetFile, "", "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -12,10 +12,15 @@
 package config
 
 import (
+	"encoding/json"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata/fetcher"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/instrumentation"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/store"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
 )
 
 type UpdaterConfig struct {
@@ -27,12 +32,62 @@ type UpdaterConfig struct {
 	SnapshotMaxLength  int64
 	TargetsMaxLength   int64
 	// Updater configuration
-	Fetcher               fetcher.Fetcher
-	LocalTrustedRoot      []byte
-	LocalMetadataDir      string
-	LocalTargetsDir       string
-	RemoteMetadataURL     string
-	RemoteTargetsURL      string
+	Fetcher fetcher.Fetcher
+	// Store caches the trusted metadata and the downloaded target files,
+	// a nil Store uses files in LocalMetadataDir and LocalTargetsDir
+	Store store.Store
+	// LockTimeout limits the wait for the locks which protect a local
+	// cache shared with other processes, a zero value leaves it to the
+	// context passed by the caller
+	LockTimeout time.Duration
+	// Clock returns the reference time the expiry of the metadata is
+	// checked against at each refresh, a nil Clock uses the current time.
+	// FixedClock pins it to a given time.
+	Clock func() time.Time
+	// ExpiryPolicy lets the cached metadata be used when it can not be
+	// updated, so clients keep going through an outage of the repository,
+	// and lets it be trusted once expired, e.g. for the grace periods of
+	// trustedmetadata.GracePeriods. Expired metadata downloaded from the
+	// repository is never trusted. Such degraded trust is logged and
+	// reported by Updater.DegradedRoles. A nil ExpiryPolicy trusts no
+	// expired metadata.
+	ExpiryPolicy trustedmetadata.ExpiryPolicy
+	// CustomValidators validate the custom metadata of the target files
+	// found by the Updater, which rejects those failing any validator
+	// applying to them
+	CustomValidators []CustomValidator
+	// Instrumentation receives the spans and measurements of the client
+	// workflow, e.g. from the adapters of the instrumentation/otel and
+	// instrumentation/prometheus modules. A nil Instrumentation
+	// discards them.
+	Instrumentation instrumentation.Instrumentation
+	// DownloadTimeout limits the time spent on each individual download of
+	// metadata. Target files streamed by the fetcher can take longer, as
+	// it only limits the time to get a response and then the time spent
+	// waiting for more data. A zero value leaves it to the context passed
+	// by the caller.
+	DownloadTimeout   time.Duration
+	LocalTrustedRoot  []byte
+	LocalMetadataDir  string
+	LocalTargetsDir   string
+	RemoteMetadataURL string
+	RemoteTargetsURL  string
+	// MetadataMirrorURLs and TargetsMirrorURLs list mirrors of
+	// RemoteMetadataURL and RemoteTargetsURL. They are tried in order
+	// whenever a download from the previous one fails or does not
+	// verify. Mirrors do not need to be trusted, the signed metadata is.
+	MetadataMirrorURLs []string
+	TargetsMirrorURLs  []string
+	// PreferFastestMirror tries the mirrors in order of their observed
+	// latency instead of the configured order
+	PreferFastestMirror bool
+	// MaxConcurrentDownloads bounds the number of downloads run at the
+	// same time by DownloadTargets and by the prefetching of delegations
+	MaxConcurrentDownloads int
+	// PrefetchDelegations downloads the metadata of sibling delegated roles
+	// concurrently while looking for a target. The metadata is still
+	// verified one role after the other, in the order of the specification.
+	PrefetchDelegations   bool
 	DisableLocalCache     bool
 	PrefixTargetsWithHash bool
 	// UnsafeLocalMode only uses the metadata as written on disk
@@ -58,16 +113,42 @@ func New(remoteURL string, rootBytes []byte) (*UpdaterConfig, error) {
 		SnapshotMaxLength:  2000000, // bytes
 		TargetsMaxLength:   5000000, // bytes
 		// Updater configuration
-		Fetcher:               &fetcher.DefaultFetcher{}, // use the default built-in download fetcher
-		LocalTrustedRoot:      rootBytes,                 // trusted root.json
-		RemoteMetadataURL:     remoteURL,                 // URL of where the TUF metadata is
-		RemoteTargetsURL:      targetsURL,                // URL of where the target files should be downloaded from
-		DisableLocalCache:     false,                     // enable local caching of trusted metadata
-		PrefixTargetsWithHash: true,                      // use hash-prefixed target files with consistent snapshots
-		UnsafeLocalMode:       false,
+		Fetcher:                &fetcher.DefaultFetcher{}, // use the default built-in download fetcher
+		DownloadTimeout:        15 * time.Second,          // per-file download timeout
+		LockTimeout:            time.Minute,               // wait for other processes sharing the local cache
+		MaxConcurrentDownloads: 4,                         // downloads run at the same time
+		LocalTrustedRoot:       rootBytes,                 // trusted root.json
+		RemoteMetadataURL:      remoteURL,                 // URL of where the TUF metadata is
+		RemoteTargetsURL:       targetsURL,                // URL of where the target files should be downloaded from
+		DisableLocalCache:      false,                     // enable local caching of trusted metadata
+		PrefixTargetsWithHash:  true,                      // use hash-prefixed target files with consistent snapshots
+		UnsafeLocalMode:        false,
 	}, nil
 }
 
+// CustomValidator validates the custom metadata of target files, e.g.
+// against a JSON Schema compiled with the schema package
+type CustomValidator struct {
+	// Role restricts the validator to the target files listed by the role
+	// with that name, an empty Role applies to all roles
+	Role string
+	// Paths restricts the validator to the target files whose path matches
+	// one of the patterns, just like the paths of a delegated role do. An
+	// empty Paths applies to all target files.
+	Paths []string
+	// Validate checks the custom metadata of a target file, which is nil
+	// if the target file has none
+	Validate func(custom *json.RawMessage) error
+}
+
+// FixedClock returns a Clock always returning t, e.g. to check whether
+// metadata was valid at a given date
+func FixedClock(t time.Time) func() time.Time {
+	return func() time.Time {
+		return t
+	}
+}
+
 func (cfg *UpdaterConfig) EnsurePathsExist() error {
 	if cfg.DisableLocalCache {
 		return nil
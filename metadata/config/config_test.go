@@ -16,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata/fetcher"
 	"github.com/stretchr/testify/assert"
@@ -37,18 +38,21 @@ func TestNewUpdaterConfig(t *testing.T) {
 			remoteURL: "somepath",
 			rootBytes: []byte("somerootbytes"),
 			config: &UpdaterConfig{
-				MaxRootRotations:      32,
-				MaxDelegations:        32,
-				RootMaxLength:         512000,
-				TimestampMaxLength:    16384,
-				SnapshotMaxLength:     2000000,
-				TargetsMaxLength:      5000000,
-				Fetcher:               &fetcher.DefaultFetcher{},
-				LocalTrustedRoot:      []byte("somerootbytes"),
-				RemoteMetadataURL:     "somepath",
-				RemoteTargetsURL:      "somepath/targets",
-				DisableLocalCache:     false,
-				PrefixTargetsWithHash: true,
+				MaxRootRotations:       32,
+				MaxDelegations:         32,
+				RootMaxLength:          512000,
+				TimestampMaxLength:     16384,
+				SnapshotMaxLength:      2000000,
+				TargetsMaxLength:       5000000,
+				Fetcher:                &fetcher.DefaultFetcher{},
+				DownloadTimeout:        15 * time.Second,
+				LockTimeout:            time.Minute,
+				MaxConcurrentDownloads: 4,
+				LocalTrustedRoot:       []byte("somerootbytes"),
+				RemoteMetadataURL:      "somepath",
+				RemoteTargetsURL:       "somepath/targets",
+				DisableLocalCache:      false,
+				PrefixTargetsWithHash:  true,
 			},
 			wantErr: nil,
 		},
@@ -12,12 +12,30 @@
 package metadata
 
 import (
+	"errors"
 	"fmt"
+	"time"
 )
 
 // Define TUF error types used inside the new modern implementation.
 // The names chosen for TUF error types should start in 'Err' except where
 // there is a good reason not to, and provide that reason in those cases.
+//
+// Errors carry structured fields on top of their message, so callers can
+// tell e.g. rollbacks from expired metadata and learn which role failed.
+// errors.Is matches an error against a target of its own type whose
+// non-zero fields are all equal to its own, so the empty value of a type
+// matches any error of that type and ErrExpiredMetadata{Role: "timestamp"}
+// only expired timestamp metadata. It also matches the empty value of the
+// type an error is a subset of, such as ErrRepository{} for repository
+// errors. errors.As gives access to the fields.
+
+// matches reports whether value matches want, a zero want matching any
+// value
+func matches[T comparable](want, value T) bool {
+	var zero T
+	return want == zero || want == value
+}
 
 // Repository errors
 
@@ -35,6 +53,14 @@ func (e ErrRepository) Error() string {
 // ErrUnsignedMetadata - An error about metadata object with insufficient threshold of signatures
 type ErrUnsignedMetadata struct {
 	Msg string
+	// Role is the name of the role whose signatures were verified
+	Role string
+	// KeyIDs are the sorted IDs of the keys whose signatures verified,
+	// separated by commas. It is a string rather than a slice to keep
+	// errors comparable with ==.
+	KeyIDs string
+	// Threshold is the number of signatures required
+	Threshold int
 }
 
 func (e ErrUnsignedMetadata) Error() string {
@@ -43,12 +69,26 @@ func (e ErrUnsignedMetadata) Error() string {
 
 // ErrUnsignedMetadata is a subset of ErrRepository
 func (e ErrUnsignedMetadata) Is(target error) bool {
-	return target == ErrRepository{} || target == ErrUnsignedMetadata{}
+	switch t := target.(type) {
+	case ErrRepository:
+		return t == ErrRepository{}
+	case ErrUnsignedMetadata:
+		return matches(t.Msg, e.Msg) && matches(t.Role, e.Role) &&
+			matches(t.KeyIDs, e.KeyIDs) && matches(t.Threshold, e.Threshold)
+	}
+	return false
 }
 
-// ErrBadVersionNumber - An error for metadata that contains an invalid version number
+// ErrBadVersionNumber - An error for metadata that contains an invalid version number,
+// e.g. a version lower than the trusted one, as served by a rollback attack
 type ErrBadVersionNumber struct {
 	Msg string
+	// Role is the name of the role whose metadata has the invalid version
+	Role string
+	// Expected is the version expected, or the lowest version accepted
+	Expected int64
+	// Actual is the version of the metadata
+	Actual int64
 }
 
 func (e ErrBadVersionNumber) Error() string {
@@ -57,12 +97,24 @@ func (e ErrBadVersionNumber) Error() string {
 
 // ErrBadVersionNumber is a subset of ErrRepository
 func (e ErrBadVersionNumber) Is(target error) bool {
-	return target == ErrRepository{} || target == ErrBadVersionNumber{}
+	switch t := target.(type) {
+	case ErrRepository:
+		return t == ErrRepository{}
+	case ErrBadVersionNumber:
+		return matches(t.Msg, e.Msg) && matches(t.Role, e.Role) && matches(t.Expected, e.Expected) && matches(t.Actual, e.Actual)
+	}
+	return false
 }
 
 // ErrEqualVersionNumber - An error for metadata containing a previously verified version number
 type ErrEqualVersionNumber struct {
 	Msg string
+	// Role is the name of the role whose metadata has the version
+	Role string
+	// Expected is the lowest version accepted
+	Expected int64
+	// Actual is the version of the metadata
+	Actual int64
 }
 
 func (e ErrEqualVersionNumber) Error() string {
@@ -71,12 +123,24 @@ func (e ErrEqualVersionNumber) Error() string {
 
 // ErrEqualVersionNumber is a subset of both ErrRepository and ErrBadVersionNumber
 func (e ErrEqualVersionNumber) Is(target error) bool {
-	return target == ErrRepository{} || target == ErrBadVersionNumber{} || target == ErrEqualVersionNumber{}
+	switch t := target.(type) {
+	case ErrRepository:
+		return t == ErrRepository{}
+	case ErrBadVersionNumber:
+		return t == ErrBadVersionNumber{}
+	case ErrEqualVersionNumber:
+		return matches(t.Msg, e.Msg) && matches(t.Role, e.Role) && matches(t.Expected, e.Expected) && matches(t.Actual, e.Actual)
+	}
+	return false
 }
 
 // ErrExpiredMetadata - Indicate that a TUF Metadata file has expired
 type ErrExpiredMetadata struct {
 	Msg string
+	// Role is the name of the role whose metadata has expired
+	Role string
+	// Expires is the expiry date of the metadata
+	Expires time.Time
 }
 
 func (e ErrExpiredMetadata) Error() string {
@@ -85,12 +149,21 @@ func (e ErrExpiredMetadata) Error() string {
 
 // ErrExpiredMetadata is a subset of ErrRepository
 func (e ErrExpiredMetadata) Is(target error) bool {
-	return target == ErrRepository{} || target == ErrExpiredMetadata{}
+	switch t := target.(type) {
+	case ErrRepository:
+		return t == ErrRepository{}
+	case ErrExpiredMetadata:
+		return matches(t.Msg, e.Msg) && matches(t.Role, e.Role) && (t.Expires.IsZero() || t.Expires.Equal(e.Expires))
+	}
+	return false
 }
 
 // ErrLengthOrHashMismatch - An error while checking the length and hash values of an object
 type ErrLengthOrHashMismatch struct {
 	Msg string
+	// Algorithm is the hash algorithm which failed to verify, it is empty
+	// if the length did not match
+	Algorithm string
 }
 
 func (e ErrLengthOrHashMismatch) Error() string {
@@ -99,23 +172,111 @@ func (e ErrLengthOrHashMismatch) Error() string {
 
 // ErrLengthOrHashMismatch is a subset of ErrRepository
 func (e ErrLengthOrHashMismatch) Is(target error) bool {
-	return target == ErrRepository{} || target == ErrLengthOrHashMismatch{}
+	switch t := target.(type) {
+	case ErrRepository:
+		return t == ErrRepository{}
+	case ErrLengthOrHashMismatch:
+		return matches(t.Msg, e.Msg) && matches(t.Algorithm, e.Algorithm)
+	}
+	return false
+}
+
+// ErrCustomMetadata - Indicate that the custom metadata of a target file does not validate
+type ErrCustomMetadata struct {
+	Msg string
+	// Path is the path of the target file
+	Path string
+	// Role is the name of the role listing the target file
+	Role string
+}
+
+func (e ErrCustomMetadata) Error() string {
+	return fmt.Sprintf("custom metadata error: %s", e.Msg)
+}
+
+// ErrCustomMetadata is a subset of ErrRepository
+func (e ErrCustomMetadata) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrRepository:
+		return t == ErrRepository{}
+	case ErrCustomMetadata:
+		return matches(t.Msg, e.Msg) && matches(t.Path, e.Path) && matches(t.Role, e.Role)
+	}
+	return false
+}
+
+// ErrTargetNotFound - Indicate that a target file is not listed by any trusted role
+// reached through the delegation tree
+type ErrTargetNotFound struct {
+	// Path is the path of the target file
+	Path string
+}
+
+func (e ErrTargetNotFound) Error() string {
+	return fmt.Sprintf("target %s not found", e.Path)
+}
+
+// ErrTargetNotFound matches any ErrTargetNotFound if the path of target is empty
+func (e ErrTargetNotFound) Is(target error) bool {
+	t, ok := target.(ErrTargetNotFound)
+	return ok && matches(t.Path, e.Path)
+}
+
+// ErrTooManyDelegations - Indicate that the delegation tree holds more roles
+// than allowed to visit, leaving some of them unvisited
+type ErrTooManyDelegations struct {
+	// Max is the maximum number of delegated roles to visit
+	Max int
+	// Left is the number of roles left unvisited
+	Left int
+}
+
+func (e ErrTooManyDelegations) Error() string {
+	return fmt.Sprintf("too many delegations: %d roles left unvisited, at most %d allowed", e.Left, e.Max)
+}
+
+// ErrTooManyDelegations matches a target of its type whose non-zero fields
+// match its own
+func (e ErrTooManyDelegations) Is(target error) bool {
+	t, ok := target.(ErrTooManyDelegations)
+	return ok && matches(t.Max, e.Max) && matches(t.Left, e.Left)
 }
 
 // Download errors
 
-// ErrDownload - An error occurred while attempting to download a file
+// ErrDownload - An error occurred while attempting to download a file, such as
+// a network failure
 type ErrDownload struct {
 	Msg string
+	// URL is the URL of the file
+	URL string
+	// Err is the underlying error, if any
+	Err error
 }
 
 func (e ErrDownload) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("download error: %s: %v", e.Msg, e.Err)
+	}
 	return fmt.Sprintf("download error: %s", e.Msg)
 }
 
+func (e ErrDownload) Unwrap() error {
+	return e.Err
+}
+
+// ErrDownload matches a target of its type whose message, URL and underlying
+// error match its own
+func (e ErrDownload) Is(target error) bool {
+	t, ok := target.(ErrDownload)
+	return ok && matches(t.Msg, e.Msg) && matches(t.URL, e.URL) && (t.Err == nil || errors.Is(e.Err, t.Err))
+}
+
 // ErrDownloadLengthMismatch - Indicate that a mismatch of lengths was seen while downloading a file
 type ErrDownloadLengthMismatch struct {
 	Msg string
+	// URL is the URL of the file
+	URL string
 }
 
 func (e ErrDownloadLengthMismatch) Error() string {
@@ -124,13 +285,21 @@ func (e ErrDownloadLengthMismatch) Error() string {
 
 // ErrDownloadLengthMismatch is a subset of ErrDownload
 func (e ErrDownloadLengthMismatch) Is(target error) bool {
-	return target == ErrDownload{} || target == ErrDownloadLengthMismatch{}
+	switch t := target.(type) {
+	case ErrDownload:
+		return t.Msg == "" && t.URL == "" && t.Err == nil
+	case ErrDownloadLengthMismatch:
+		return matches(t.Msg, e.Msg) && matches(t.URL, e.URL)
+	}
+	return false
 }
 
 // ErrDownloadHTTP - Returned by Fetcher interface implementations for HTTP errors
 type ErrDownloadHTTP struct {
 	StatusCode int
 	URL        string
+	// RetryAfter is the delay asked for by the server, if any
+	RetryAfter time.Duration
 }
 
 func (e ErrDownloadHTTP) Error() string {
@@ -139,7 +308,13 @@ func (e ErrDownloadHTTP) Error() string {
 
 // ErrDownloadHTTP is a subset of ErrDownload
 func (e ErrDownloadHTTP) Is(target error) bool {
-	return target == ErrDownload{} || target == ErrDownloadHTTP{}
+	switch t := target.(type) {
+	case ErrDownload:
+		return t.Msg == "" && t.URL == "" && t.Err == nil
+	case ErrDownloadHTTP:
+		return matches(t.StatusCode, e.StatusCode) && matches(t.URL, e.URL) && matches(t.RetryAfter, e.RetryAfter)
+	}
+	return false
 }
 
 // ValueError
@@ -168,3 +343,41 @@ type ErrRuntime struct {
 func (e ErrRuntime) Error() string {
 	return fmt.Sprintf("runtime error: %s", e.Msg)
 }
+
+// Store errors
+
+// ErrReadOnly - Returned by Store implementations which do not support writing
+type ErrReadOnly struct {
+	Msg string
+}
+
+func (e ErrReadOnly) Error() string {
+	return fmt.Sprintf("read-only store error: %s", e.Msg)
+}
+
+// ErrReadOnly matches an empty ErrReadOnly whatever its message
+func (e ErrReadOnly) Is(target error) bool {
+	return target == ErrReadOnly{}
+}
+
+// Storage errors
+
+// ErrUpload - Returned by Storage implementations when a file can not be
+// uploaded, such as when the server rejects it
+type ErrUpload struct {
+	Msg string
+	// URL is the URL of the file
+	URL string
+	// StatusCode is the HTTP status code of the response, if any
+	StatusCode int
+}
+
+func (e ErrUpload) Error() string {
+	return fmt.Sprintf("upload error: %s", e.Msg)
+}
+
+// ErrUpload matches a target of its type whose non-zero fields match its own
+func (e ErrUpload) Is(target error) bool {
+	t, ok := target.(ErrUpload)
+	return ok && matches(t.Msg, e.Msg) && matches(t.URL, e.URL) && matches(t.StatusCode, e.StatusCode)
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorsIs(t *testing.T) {
+	expires := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	networkErr := &url.Error{Op: "Get", URL: "https://example.com/1.root.json", Err: errors.New("connection refused")}
+	for _, tt := range []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{
+			name:   "empty target of the same type",
+			err:    ErrExpiredMetadata{Msg: "timestamp.json is expired", Role: TIMESTAMP, Expires: expires},
+			target: ErrExpiredMetadata{},
+			want:   true,
+		},
+		{
+			name:   "matching fields",
+			err:    ErrExpiredMetadata{Msg: "timestamp.json is expired", Role: TIMESTAMP, Expires: expires},
+			target: ErrExpiredMetadata{Role: TIMESTAMP, Expires: expires.In(time.Local)},
+			want:   true,
+		},
+		{
+			name:   "mismatching field",
+			err:    ErrExpiredMetadata{Msg: "timestamp.json is expired", Role: TIMESTAMP, Expires: expires},
+			target: ErrExpiredMetadata{Role: SNAPSHOT},
+			want:   false,
+		},
+		{
+			name:   "mismatching message",
+			err:    ErrExpiredMetadata{Msg: "timestamp.json is expired", Role: TIMESTAMP},
+			target: ErrExpiredMetadata{Msg: "snapshot.json is expired"},
+			want:   false,
+		},
+		{
+			name:   "empty parent",
+			err:    ErrBadVersionNumber{Msg: "new timestamp version 1 must be >= 2", Role: TIMESTAMP, Expected: 2, Actual: 1},
+			target: ErrRepository{},
+			want:   true,
+		},
+		{
+			name:   "parent with a message",
+			err:    ErrBadVersionNumber{Msg: "new timestamp version 1 must be >= 2"},
+			target: ErrRepository{Msg: "new timestamp version 1 must be >= 2"},
+			want:   false,
+		},
+		{
+			name:   "other type",
+			err:    ErrBadVersionNumber{Role: TIMESTAMP},
+			target: ErrExpiredMetadata{},
+			want:   false,
+		},
+		{
+			name:   "subset of a subset",
+			err:    ErrEqualVersionNumber{Role: TIMESTAMP, Expected: 3, Actual: 2},
+			target: ErrBadVersionNumber{},
+			want:   true,
+		},
+		{
+			name:   "key IDs",
+			err:    ErrUnsignedMetadata{Role: ROOT, KeyIDs: "a,b", Threshold: 3},
+			target: ErrUnsignedMetadata{KeyIDs: "a,b", Threshold: 3},
+			want:   true,
+		},
+		{
+			name:   "mismatching key IDs",
+			err:    ErrUnsignedMetadata{Role: ROOT, KeyIDs: "a,b", Threshold: 3},
+			target: ErrUnsignedMetadata{KeyIDs: "a"},
+			want:   false,
+		},
+		{
+			name:   "hash algorithm",
+			err:    ErrLengthOrHashMismatch{Msg: "hash verification failed - mismatch for algorithm sha512", Algorithm: "sha512"},
+			target: ErrLengthOrHashMismatch{Algorithm: "sha512"},
+			want:   true,
+		},
+		{
+			name:   "target not found",
+			err:    fmt.Errorf("lookup failed: %w", ErrTargetNotFound{Path: "file.txt"}),
+			target: ErrTargetNotFound{},
+			want:   true,
+		},
+		{
+			name:   "other target not found",
+			err:    ErrTargetNotFound{Path: "file.txt"},
+			target: ErrTargetNotFound{Path: "other.txt"},
+			want:   false,
+		},
+		{
+			name:   "too many delegations",
+			err:    ErrTooManyDelegations{Max: 32, Left: 96},
+			target: ErrTooManyDelegations{},
+			want:   true,
+		},
+		{
+			name:   "network failure",
+			err:    ErrDownload{Msg: "download failed for https://example.com/1.root.json", URL: "https://example.com/1.root.json", Err: networkErr},
+			target: ErrDownload{URL: "https://example.com/1.root.json"},
+			want:   true,
+		},
+		{
+			name:   "wrapped network error",
+			err:    ErrDownload{Msg: "download failed for https://example.com/1.root.json", Err: networkErr},
+			target: networkErr,
+			want:   true,
+		},
+		{
+			name:   "HTTP error is a download error",
+			err:    ErrDownloadHTTP{StatusCode: 404, URL: "https://example.com/1.root.json"},
+			target: ErrDownload{},
+			want:   true,
+		},
+		{
+			name:   "HTTP status",
+			err:    ErrDownloadHTTP{StatusCode: 404, URL: "https://example.com/1.root.json"},
+			target: ErrDownloadHTTP{StatusCode: 503},
+			want:   false,
+		},
+		{
+			name:   "download error is not a repository error",
+			err:    ErrDownloadLengthMismatch{Msg: "too long", URL: "https://example.com/1.root.json"},
+			target: ErrRepository{},
+			want:   false,
+		},
+		{
+			name:   "upload status",
+			err:    ErrUpload{Msg: "403 Forbidden", URL: "http://localhost:9000/tuf/timestamp.json", StatusCode: 403},
+			target: ErrUpload{StatusCode: 403},
+			want:   true,
+		},
+		{
+			name:   "upload error is not a download error",
+			err:    ErrUpload{Msg: "403 Forbidden", URL: "http://localhost:9000/tuf/timestamp.json", StatusCode: 403},
+			target: ErrDownload{},
+			want:   false,
+		},
+		{
+			name:   "cancellation is not a download error",
+			err:    context.Canceled,
+			target: ErrDownload{},
+			want:   false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, errors.Is(tt.err, tt.target))
+		})
+	}
+}
+
+func TestErrorsAs(t *testing.T) {
+	networkErr := &url.Error{Op: "Get", URL: "https://example.com/1.root.json", Err: errors.New("connection refused")}
+	err := fmt.Errorf("refresh failed: %w", ErrDownload{Msg: "download failed for https://example.com/1.root.json", URL: "https://example.com/1.root.json", Err: networkErr})
+	assert.EqualError(t, err, `refresh failed: download error: download failed for https://example.com/1.root.json: Get "https://example.com/1.root.json": connection refused`)
+
+	var errDownload ErrDownload
+	if assert.ErrorAs(t, err, &errDownload) {
+		assert.Equal(t, "https://example.com/1.root.json", errDownload.URL)
+	}
+	var errURL *url.Error
+	if assert.ErrorAs(t, err, &errURL) {
+		assert.Equal(t, "Get", errURL.Op)
+	}
+	var errVersion ErrBadVersionNumber
+	assert.False(t, errors.As(err, &errVersion))
+}
+
+func TestErrorsComparable(t *testing.T) {
+	// errors can be compared with == and used as map keys
+	seen := map[error]bool{
+		ErrUnsignedMetadata{Role: ROOT, KeyIDs: "a,b", Threshold: 3}: true,
+	}
+	assert.True(t, seen[ErrUnsignedMetadata{Role: ROOT, KeyIDs: "a,b", Threshold: 3}])
+}
@@ -12,72 +12,332 @@
 package fetcher
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
 )
 
 // Fetcher interface
 type Fetcher interface {
-	DownloadFile(urlPath string, maxLength int64, timeout time.Duration) ([]byte, error)
+	// DownloadFile downloads the file at urlPath. Implementations must
+	// stop and return an error once ctx is cancelled or its deadline expires.
+	DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error)
 }
 
-// DefaultFetcher implements Fetcher
+// StreamFetcher is implemented by fetchers which can hand out the content
+// of a download as it arrives instead of buffering it in memory
+type StreamFetcher interface {
+	Fetcher
+	// DownloadFileStream returns the content of the file at urlPath as a
+	// stream which errors out once more than maxLength bytes are read.
+	// The caller is responsible for closing it.
+	DownloadFileStream(ctx context.Context, urlPath string, maxLength int64) (io.ReadCloser, error)
+}
+
+// RangeFetcher is implemented by fetchers which can resume an interrupted
+// download instead of starting it again from the beginning
+type RangeFetcher interface {
+	Fetcher
+	// DownloadFileRange is like DownloadFileStream but asks for the content
+	// of the file at urlPath starting at offset. maxLength limits the length
+	// of the whole file, not of the returned stream. It also returns the
+	// offset the stream actually starts at, which is 0 if the server does
+	// not support ranges.
+	DownloadFileRange(ctx context.Context, urlPath string, offset, maxLength int64) (io.ReadCloser, int64, error)
+}
+
+// DefaultFetcher implements Fetcher, StreamFetcher and RangeFetcher.
+// The zero value is ready to use and shares its connections with every
+// other DefaultFetcher using the default client.
 type DefaultFetcher struct {
+	client        *http.Client
 	httpUserAgent string
+	header        http.Header
+	retryPolicy   RetryPolicy
+	// transport is the copy of the transport of client configured by
+	// SetProxy and SetRootCAs, if any
+	transport *http.Transport
+}
+
+// defaultClient is used by fetchers which were not given a client
+var defaultClient = &http.Client{}
+
+// NewDefaultFetcher creates a DefaultFetcher with a client of its own
+func NewDefaultFetcher() *DefaultFetcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	d := NewDefaultFetcherWithRoundTripper(transport)
+	d.transport = transport
+	return d
+}
+
+// NewDefaultFetcherWithClient creates a DefaultFetcher sending its
+// requests through client
+func NewDefaultFetcherWithClient(client *http.Client) *DefaultFetcher {
+	return &DefaultFetcher{client: client}
+}
+
+// NewDefaultFetcherWithRoundTripper creates a DefaultFetcher sending its
+// requests through a client using transport
+func NewDefaultFetcherWithRoundTripper(transport http.RoundTripper) *DefaultFetcher {
+	return NewDefaultFetcherWithClient(&http.Client{Transport: transport})
+}
+
+// SetHTTPUserAgent sets the User-Agent header sent with every request
+func (d *DefaultFetcher) SetHTTPUserAgent(httpUserAgent string) {
+	d.httpUserAgent = httpUserAgent
+}
+
+// SetHeader sets a header sent with every request, replacing any value
+// previously set for key
+func (d *DefaultFetcher) SetHeader(key, value string) {
+	if d.header == nil {
+		d.header = http.Header{}
+	}
+	d.header.Set(key, value)
+}
+
+// SetBearerToken authenticates every request with a bearer token
+func (d *DefaultFetcher) SetBearerToken(token string) {
+	d.SetHeader("Authorization", "Bearer "+token)
+}
+
+// SetBasicAuth authenticates every request with a username and password
+func (d *DefaultFetcher) SetBasicAuth(username, password string) {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	d.SetHeader("Authorization", "Basic "+credentials)
+}
+
+// SetProxy sends every request through the proxy at proxyURL. Proxy
+// credentials can be given as part of proxyURL. A nil proxyURL disables
+// proxying, including the one configured by the environment. Like
+// SetRootCAs, it configures a copy of the transport of the client the
+// fetcher was created with, which is left unchanged.
+func (d *DefaultFetcher) SetProxy(proxyURL *url.URL) error {
+	transport, err := d.ownTransport()
+	if err != nil {
+		return err
+	}
+	if proxyURL == nil {
+		transport.Proxy = nil
+	} else {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return nil
+}
+
+// SetRootCAs sets the certificate authorities used to verify the
+// certificate of the servers, instead of the ones of the host
+func (d *DefaultFetcher) SetRootCAs(rootCAs *x509.CertPool) error {
+	transport, err := d.ownTransport()
+	if err != nil {
+		return err
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.RootCAs = rootCAs
+	return nil
+}
+
+// ownTransport returns the transport of the fetcher's own client. The
+// first call switches the fetcher to a copy of its client using a copy of
+// its transport, or of http.DefaultTransport if the client has none, so
+// that the transport shared with other clients is never changed.
+func (d *DefaultFetcher) ownTransport() (*http.Transport, error) {
+	if d.transport != nil {
+		return d.transport, nil
+	}
+	client := &http.Client{}
+	if d.client != nil {
+		*client = *d.client
+	}
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, metadata.ErrValue{Msg: fmt.Sprintf("transport of type %T can not be configured, expected *http.Transport", client.Transport)}
+	}
+	client.Transport = transport
+	d.client = client
+	d.transport = transport
+	return transport, nil
 }
 
 // DownloadFile downloads a file from urlPath, errors out if it failed,
-// its length is larger than maxLength or the timeout is reached.
-func (d *DefaultFetcher) DownloadFile(urlPath string, maxLength int64, timeout time.Duration) ([]byte, error) {
-	client := &http.Client{Timeout: timeout}
-	req, err := http.NewRequest("GET", urlPath, nil)
+// its length is larger than maxLength or ctx is done. Failed downloads
+// are retried as configured by SetRetryPolicy.
+func (d *DefaultFetcher) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	var data []byte
+	err := d.retry(ctx, urlPath, func() error {
+		body, _, err := d.downloadRange(ctx, urlPath, 0, maxLength)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		// nothing was handed out yet, so a body failing halfway
+		// can be downloaded again as well
+		data, err = io.ReadAll(body)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	return data, nil
+}
+
+// DownloadFileStream starts downloading a file from urlPath and returns
+// its body without buffering it. It errors out if the request failed or the
+// reported length is larger than maxLength. Reading more than maxLength
+// bytes from the returned body fails as well.
+func (d *DefaultFetcher) DownloadFileStream(ctx context.Context, urlPath string, maxLength int64) (io.ReadCloser, error) {
+	body, _, err := d.DownloadFileRange(ctx, urlPath, 0, maxLength)
+	return body, err
+}
+
+// DownloadFileRange starts downloading a file from urlPath at offset using
+// a Range request. Servers ignoring the Range header are handled by
+// returning the whole body and an offset of 0. Just like DownloadFileStream
+// it errors out if more than maxLength bytes are served in total.
+// Failing requests are retried as configured by SetRetryPolicy, errors
+// occurring while reading the returned body are not.
+func (d *DefaultFetcher) DownloadFileRange(ctx context.Context, urlPath string, offset, maxLength int64) (io.ReadCloser, int64, error) {
+	var body io.ReadCloser
+	var start int64
+	err := d.retry(ctx, urlPath, func() error {
+		var err error
+		body, start, err = d.downloadRange(ctx, urlPath, offset, maxLength)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, start, nil
+}
+
+// downloadRange makes a single attempt at DownloadFileRange
+func (d *DefaultFetcher) downloadRange(ctx context.Context, urlPath string, offset, maxLength int64) (io.ReadCloser, int64, error) {
+	client := d.client
+	if client == nil {
+		client = defaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", urlPath, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for key, values := range d.header {
+		req.Header[key] = values
+	}
 	// Use in case of multiple sessions.
 	if d.httpUserAgent != "" {
 		req.Header.Set("User-Agent", d.httpUserAgent)
 	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 	// Execute the request.
 	res, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, downloadError(urlPath, err)
 	}
-	defer res.Body.Close()
 	// Handle HTTP status codes.
-	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusForbidden || res.StatusCode != http.StatusOK {
-		return nil, metadata.ErrDownloadHTTP{StatusCode: res.StatusCode, URL: urlPath}
+	var start int64
+	switch {
+	case res.StatusCode == http.StatusOK:
+		// the server sent the whole file
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		// make sure the server sent the range that was asked for
+		start, err = parseContentRangeStart(res.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			res.Body.Close()
+			return nil, 0, metadata.ErrDownload{Msg: fmt.Sprintf("download failed for %s, unexpected content range %q", urlPath, res.Header.Get("Content-Range")), URL: urlPath}
+		}
+	default:
+		res.Body.Close()
+		return nil, 0, metadata.ErrDownloadHTTP{StatusCode: res.StatusCode, URL: urlPath, RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"))}
 	}
-	var length int64
 	// Get content length from header (might not be accurate, -1 or not set).
 	if header := res.Header.Get("Content-Length"); header != "" {
-		length, err = strconv.ParseInt(header, 10, 0)
+		length, err := strconv.ParseInt(header, 10, 0)
 		if err != nil {
-			return nil, err
+			res.Body.Close()
+			return nil, 0, err
 		}
 		// Error if the reported size is greater than what is expected.
-		if length > maxLength {
-			return nil, metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s, length %d is larger than expected %d", urlPath, length, maxLength)}
+		if start+length > maxLength {
+			res.Body.Close()
+			return nil, 0, metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s, length %d is larger than expected %d", urlPath, start+length, maxLength), URL: urlPath}
 		}
 	}
-	// Although the size has been checked above, use a LimitReader in case
+	// Although the size has been checked above, limit the body in case
 	// the reported size is inaccurate, or size is -1 which indicates an
-	// unknown length. We read maxLength + 1 in order to check if the read data
-	// surpased our set limit.
-	data, err := io.ReadAll(io.LimitReader(res.Body, maxLength+1))
-	if err != nil {
-		return nil, err
+	// unknown length.
+	return &limitedBody{body: res.Body, urlPath: urlPath, maxLength: maxLength, read: start}, start, nil
+}
+
+// parseContentRangeStart returns the first byte position of a
+// "bytes <first>-<last>/<length>" Content-Range header value
+func parseContentRangeStart(contentRange string) (int64, error) {
+	byteRange, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("unsupported content range unit")
 	}
-	// Error if the reported size is greater than what is expected.
-	length = int64(len(data))
-	if length > maxLength {
-		return nil, metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s, length %d is larger than expected %d", urlPath, length, maxLength)}
+	first, _, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, fmt.Errorf("malformed content range")
 	}
+	return strconv.ParseInt(first, 10, 64)
+}
 
-	return data, nil
+// limitedBody errors out once more than maxLength bytes are read from body.
+// read starts at the offset of body within the file when resuming.
+type limitedBody struct {
+	body      io.ReadCloser
+	urlPath   string
+	maxLength int64
+	read      int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	// We read at most maxLength + 1 bytes in order to check if the read
+	// data surpassed our set limit.
+	if left := l.maxLength + 1 - l.read; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := l.body.Read(p)
+	l.read += int64(n)
+	// Error if the read size is greater than what is expected.
+	if l.read > l.maxLength {
+		return n, metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s, length %d is larger than expected %d", l.urlPath, l.read, l.maxLength), URL: l.urlPath}
+	}
+	if err != nil && err != io.EOF {
+		return n, downloadError(l.urlPath, err)
+	}
+	return n, err
+}
+
+// downloadError wraps err, a failure to get the file at urlPath from the
+// server such as a network failure, in an ErrDownload. Cancellations are
+// returned as is.
+func downloadError(urlPath string, err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return metadata.ErrDownload{Msg: fmt.Sprintf("download failed for %s", urlPath), URL: urlPath, Err: err}
+}
+
+func (l *limitedBody) Close() error {
+	return l.body.Close()
 }
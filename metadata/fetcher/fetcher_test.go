@@ -12,8 +12,17 @@
 package fetcher
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
@@ -44,7 +53,7 @@ func TestDownLoadFile(t *testing.T) {
 			desc:    "URL does not exist",
 			url:     "https://somebadtufrepourl.com/metadata/",
 			data:    nil,
-			wantErr: &url.Error{},
+			wantErr: metadata.ErrDownload{},
 		},
 		{
 			name:    "invalid url format",
@@ -74,7 +83,13 @@ func TestDownLoadFile(t *testing.T) {
 			t.Logf("Desc: %s", tt.desc)
 			// run the function under test
 			fetcher := DefaultFetcher{httpUserAgent: "Metadata_Unit_Test/1.0"}
-			data, err := fetcher.DownloadFile(tt.url, tt.maxLength, tt.timeout)
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			data, err := fetcher.DownloadFile(ctx, tt.url, tt.maxLength)
 			// special case if we expect no error
 			if tt.wantErr == nil {
 				assert.NoErrorf(t, err, "expected no error but got %v", err)
@@ -86,3 +101,436 @@ func TestDownLoadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadFileContext(t *testing.T) {
+	// serve a response which never completes before the test deadline
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-blocked:
+		}
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fetcher := DefaultFetcher{}
+	data, err := fetcher.DownloadFile(ctx, server.URL, 512000)
+	assert.Nil(t, data)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDownloadFileStream(t *testing.T) {
+	content := []byte("streamed content without a content length header")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// flushing before writing the body forces a chunked response
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	fetcher := DefaultFetcher{}
+	body, err := fetcher.DownloadFileStream(context.Background(), server.URL, int64(len(content)))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	assert.NoError(t, body.Close())
+
+	body, err = fetcher.DownloadFileStream(context.Background(), server.URL, 10)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(body)
+	assert.ErrorIs(t, err, metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s, length %d is larger than expected %d", server.URL, 11, 10)})
+	assert.NoError(t, body.Close())
+}
+
+func TestDownloadFileRange(t *testing.T) {
+	content := []byte("content of a file downloaded in two parts")
+	modTime := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ranges":
+			http.ServeContent(w, r, "file", modTime, bytes.NewReader(content))
+		case "/no-ranges":
+			_, _ = w.Write(content)
+		case "/wrong-range":
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 1-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[1:])
+		}
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name       string
+		path       string
+		offset     int64
+		maxLength  int64
+		wantOffset int64
+		wantData   []byte
+		wantErr    error
+	}{
+		{
+			name:       "resumed",
+			path:       "/ranges",
+			offset:     10,
+			maxLength:  int64(len(content)),
+			wantOffset: 10,
+			wantData:   content[10:],
+		},
+		{
+			name:       "no offset",
+			path:       "/ranges",
+			offset:     0,
+			maxLength:  int64(len(content)),
+			wantOffset: 0,
+			wantData:   content,
+		},
+		{
+			name:       "range ignored",
+			path:       "/no-ranges",
+			offset:     10,
+			maxLength:  int64(len(content)),
+			wantOffset: 0,
+			wantData:   content,
+		},
+		{
+			name:      "unexpected range",
+			path:      "/wrong-range",
+			offset:    10,
+			maxLength: int64(len(content)),
+			wantErr:   metadata.ErrDownload{Msg: fmt.Sprintf("download failed for %s/wrong-range, unexpected content range %q", server.URL, fmt.Sprintf("bytes 1-%d/%d", len(content)-1, len(content)))},
+		},
+		{
+			name:      "length of the whole file exceeded",
+			path:      "/ranges",
+			offset:    10,
+			maxLength: 20,
+			wantErr:   metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s/ranges, length %d is larger than expected %d", server.URL, len(content), 20)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := DefaultFetcher{}
+			body, offset, err := fetcher.DownloadFileRange(context.Background(), server.URL+tt.path, tt.offset, tt.maxLength)
+			if tt.wantErr != nil {
+				assert.Nil(t, body)
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			defer body.Close()
+			assert.Equal(t, tt.wantOffset, offset)
+			data, err := io.ReadAll(body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantData, data)
+		})
+	}
+}
+
+func TestDownloadFileRetry(t *testing.T) {
+	content := []byte("content served once the server recovered")
+	policy := RetryPolicy{
+		MaxAttempts:          3,
+		InitialBackoff:       time.Millisecond,
+		MaxBackoff:           5 * time.Millisecond,
+		Multiplier:           2,
+		Jitter:               0.5,
+		RetryableStatusCodes: []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+	}
+	for _, tt := range []struct {
+		name         string
+		failures     int
+		status       int
+		policy       RetryPolicy
+		wantAttempts int
+		wantStatus   int
+	}{
+		{
+			name:         "transient failures",
+			failures:     2,
+			status:       http.StatusServiceUnavailable,
+			policy:       policy,
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			failures:     3,
+			status:       http.StatusBadGateway,
+			policy:       policy,
+			wantAttempts: 3,
+			wantStatus:   http.StatusBadGateway,
+		},
+		{
+			name:         "status not retryable",
+			failures:     1,
+			status:       http.StatusNotFound,
+			policy:       policy,
+			wantAttempts: 1,
+			wantStatus:   http.StatusNotFound,
+		},
+		{
+			name:         "retries disabled",
+			failures:     1,
+			status:       http.StatusServiceUnavailable,
+			policy:       RetryPolicy{},
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if attempts <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				_, _ = w.Write(content)
+			}))
+			defer server.Close()
+
+			fetcher := DefaultFetcher{}
+			fetcher.SetRetryPolicy(tt.policy)
+			data, err := fetcher.DownloadFile(context.Background(), server.URL, int64(len(content)))
+			assert.Equal(t, tt.wantAttempts, attempts)
+			if tt.wantStatus != 0 {
+				var errHTTP metadata.ErrDownloadHTTP
+				assert.Nil(t, data)
+				assert.ErrorAs(t, err, &errHTTP)
+				assert.Equal(t, tt.wantStatus, errHTTP.StatusCode)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, content, data)
+		})
+	}
+}
+
+func TestDownloadFileRetryContext(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// the server asks for a delay way past the deadline of the download
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fetcher := DefaultFetcher{}
+	fetcher.SetRetryPolicy(DefaultRetryPolicy())
+	_, err := fetcher.DownloadFile(ctx, server.URL, 512000)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1, metadata.ErrDownloadHTTP{}))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2, metadata.ErrDownloadHTTP{}))
+	assert.Equal(t, 800*time.Millisecond, policy.backoff(4, metadata.ErrDownloadHTTP{}))
+	assert.Equal(t, time.Second, policy.backoff(5, metadata.ErrDownloadHTTP{}))
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(1, metadata.ErrDownloadHTTP{RetryAfter: 300 * time.Millisecond}))
+	assert.Equal(t, time.Second, policy.backoff(1, metadata.ErrDownloadHTTP{RetryAfter: time.Hour}))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.backoff(2, metadata.ErrDownloadHTTP{})
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.LessOrEqual(t, delay, 300*time.Millisecond)
+	}
+}
+
+func TestDownloadFileHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		configure func(*DefaultFetcher)
+		header    string
+		want      string
+	}{
+		{
+			name:      "user agent",
+			configure: func(d *DefaultFetcher) { d.SetHTTPUserAgent("Metadata_Unit_Test/1.0") },
+			header:    "User-Agent",
+			want:      "Metadata_Unit_Test/1.0",
+		},
+		{
+			name:      "custom header",
+			configure: func(d *DefaultFetcher) { d.SetHeader("X-Mirror-Region", "eu") },
+			header:    "X-Mirror-Region",
+			want:      "eu",
+		},
+		{
+			name:      "bearer token",
+			configure: func(d *DefaultFetcher) { d.SetBearerToken("token") },
+			header:    "Authorization",
+			want:      "Bearer token",
+		},
+		{
+			name:      "basic auth",
+			configure: func(d *DefaultFetcher) { d.SetBasicAuth("user", "password") },
+			header:    "Authorization",
+			want:      "Basic dXNlcjpwYXNzd29yZA==",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(r.Header.Get(tt.header)))
+			}))
+			defer server.Close()
+
+			fetcher := NewDefaultFetcher()
+			tt.configure(fetcher)
+			data, err := fetcher.DownloadFile(context.Background(), server.URL, 512000)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestDownloadFileWithClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tls"))
+	}))
+	defer server.Close()
+
+	// the certificate of the test server is not trusted by default
+	fetcher := NewDefaultFetcher()
+	_, err := fetcher.DownloadFile(context.Background(), server.URL, 512000)
+	assert.Error(t, err)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+	err = fetcher.SetRootCAs(rootCAs)
+	assert.NoError(t, err)
+	data, err := fetcher.DownloadFile(context.Background(), server.URL, 512000)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("tls"), data)
+
+	// the client given is used as is
+	fetcher = NewDefaultFetcherWithClient(server.Client())
+	data, err = fetcher.DownloadFile(context.Background(), server.URL, 512000)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("tls"), data)
+
+	// a copy of the transport of the client given is configured
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12}}}
+	fetcher = NewDefaultFetcherWithClient(client)
+	err = fetcher.SetRootCAs(rootCAs)
+	assert.NoError(t, err)
+	data, err = fetcher.DownloadFile(context.Background(), server.URL, 512000)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("tls"), data)
+	assert.Nil(t, client.Transport.(*http.Transport).TLSClientConfig.RootCAs)
+	// as is a copy of the default transport for a client without one
+	client = &http.Client{Timeout: time.Minute}
+	fetcher = NewDefaultFetcherWithClient(client)
+	err = fetcher.SetRootCAs(rootCAs)
+	assert.NoError(t, err)
+	data, err = fetcher.DownloadFile(context.Background(), server.URL, 512000)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("tls"), data)
+	assert.Nil(t, client.Transport)
+	if defaultConfig := http.DefaultTransport.(*http.Transport).TLSClientConfig; defaultConfig != nil {
+		assert.Nil(t, defaultConfig.RootCAs)
+	}
+
+	// only a *http.Transport can be configured
+	fetcher = NewDefaultFetcherWithRoundTripper(roundTripperFunc(http.DefaultTransport.RoundTrip))
+	err = fetcher.SetRootCAs(rootCAs)
+	assert.ErrorIs(t, err, metadata.ErrValue{Msg: "transport of type fetcher.roundTripperFunc can not be configured, expected *http.Transport"})
+}
+
+func TestDownloadFileProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxy receives the absolute URL of the requested file
+		if r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNzd29yZA==" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	assert.NoError(t, err)
+	proxyURL.User = url.UserPassword("user", "password")
+
+	// the zero value switches to a transport of its own
+	fetcher := DefaultFetcher{}
+	err = fetcher.SetProxy(proxyURL)
+	assert.NoError(t, err)
+	data, err := fetcher.DownloadFile(context.Background(), "http://repository.invalid/metadata/1.root.json", 512000)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("http://repository.invalid/metadata/1.root.json"), data)
+}
+
+// roundTripperFunc implements http.RoundTripper with a function
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestFSFetcher(t *testing.T) {
+	fetcher := NewFSFetcher(fstest.MapFS{
+		"metadata/root.json": {Data: []byte("root")},
+	})
+	for _, tt := range []struct {
+		name      string
+		url       string
+		maxLength int64
+		wantData  []byte
+		wantErr   error
+	}{
+		{
+			name:      "relative path",
+			url:       "metadata/root.json",
+			maxLength: 4,
+			wantData:  []byte("root"),
+		},
+		{
+			name:      "URL",
+			url:       "file:///metadata/root.json",
+			maxLength: 4,
+			wantData:  []byte("root"),
+		},
+		{
+			name:      "missing file",
+			url:       "metadata/timestamp.json",
+			maxLength: 4,
+			wantErr:   metadata.ErrDownloadHTTP{StatusCode: http.StatusNotFound, URL: "metadata/timestamp.json"},
+		},
+		{
+			name:      "directory",
+			url:       "metadata",
+			maxLength: 4,
+			wantErr:   metadata.ErrDownloadHTTP{StatusCode: http.StatusNotFound, URL: "metadata"},
+		},
+		{
+			name:      "invalid path",
+			url:       "metadata/../../root.json",
+			maxLength: 4,
+			wantErr:   metadata.ErrDownloadHTTP{StatusCode: http.StatusNotFound, URL: "metadata/../../root.json"},
+		},
+		{
+			name:      "file too long",
+			url:       "metadata/root.json",
+			maxLength: 3,
+			wantErr:   metadata.ErrDownloadLengthMismatch{Msg: "download failed for metadata/root.json, length 4 is larger than expected 3", URL: "metadata/root.json"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := fetcher.DownloadFile(context.Background(), tt.url, tt.maxLength)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantData, data)
+		})
+	}
+}
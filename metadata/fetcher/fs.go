@@ -0,0 +1,82 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// FSFetcher implements Fetcher by reading files from a file system instead
+// of downloading them, e.g. to verify a bundle of metadata offline. The
+// path of the URLs it is given is looked up in the file system the way an
+// HTTP file server would, so the same URLs work with both.
+type FSFetcher struct {
+	fsys fs.FS
+}
+
+// NewFSFetcher creates an FSFetcher reading files from fsys
+func NewFSFetcher(fsys fs.FS) *FSFetcher {
+	return &FSFetcher{fsys: fsys}
+}
+
+// DownloadFile reads the file at the path of urlPath. A missing file fails
+// with a 404 ErrDownloadHTTP, like a missing file on a server does.
+func (f *FSFetcher) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(urlPath)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if !fs.ValidPath(name) {
+		return nil, metadata.ErrDownloadHTTP{StatusCode: http.StatusNotFound, URL: urlPath}
+	}
+	file, err := f.fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, metadata.ErrDownloadHTTP{StatusCode: http.StatusNotFound, URL: urlPath}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, metadata.ErrDownloadHTTP{StatusCode: http.StatusNotFound, URL: urlPath}
+	}
+	if info.Size() > maxLength {
+		return nil, metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s, length %d is larger than expected %d", urlPath, info.Size(), maxLength), URL: urlPath}
+	}
+	// the size may not be known, read one more byte than allowed to
+	// detect files too long anyway
+	data, err := io.ReadAll(io.LimitReader(file, maxLength+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxLength {
+		return nil, metadata.ErrDownloadLengthMismatch{Msg: fmt.Sprintf("download failed for %s, length %d is larger than expected %d", urlPath, len(data), maxLength), URL: urlPath}
+	}
+	return data, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// RetryPolicy configures how DefaultFetcher retries failed downloads.
+// The zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retry, values below 1 are
+	// treated as 1
+	Multiplier float64
+	// Jitter randomizes each delay by up to +/- the given fraction of it,
+	// e.g. 0.2 for +/- 20%
+	Jitter float64
+	// RetryableStatusCodes lists the HTTP status codes worth retrying
+	RetryableStatusCodes []int
+	// RetryableError reports whether a network error is worth retrying,
+	// IsRetryableNetworkError is used if it is not set
+	RetryableError func(err error) bool
+}
+
+// DefaultRetryPolicy returns a policy suited for riding out transient
+// failures of a repository or its CDN
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// IsRetryableNetworkError reports whether err is a network error which
+// might not happen again, like a timeout, a refused or reset connection
+// or a connection closed before the response was complete
+func IsRetryableNetworkError(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// url.Error is a net.Error itself, look at what it wraps instead
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// SetRetryPolicy sets the policy used to retry failed downloads
+func (d *DefaultFetcher) SetRetryPolicy(policy RetryPolicy) {
+	d.retryPolicy = policy
+}
+
+// retry calls attempt until it succeeds, returns an error which is not
+// worth retrying or the policy runs out of attempts. The delay between two
+// attempts is interrupted as soon as ctx is done.
+func (d *DefaultFetcher) retry(ctx context.Context, urlPath string, attempt func() error) error {
+	log := metadata.GetLogger()
+
+	policy := d.retryPolicy
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= policy.MaxAttempts || ctx.Err() != nil || !policy.retryable(err) {
+			return err
+		}
+		delay := policy.backoff(n, err)
+		log.Info("Retrying download", "url", urlPath, "attempt", n+1, "delay", delay.String(), "error", err.Error())
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether err is worth another attempt
+func (p RetryPolicy) retryable(err error) bool {
+	var errHTTP metadata.ErrDownloadHTTP
+	if errors.As(err, &errHTTP) {
+		for _, code := range p.RetryableStatusCodes {
+			if code == errHTTP.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	var errLength metadata.ErrDownloadLengthMismatch
+	if errors.As(err, &errLength) {
+		// the server will keep on serving too much data
+		return false
+	}
+	if p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+	return IsRetryableNetworkError(err)
+}
+
+// backoff returns the delay before the attempt following the n-th one.
+// A Retry-After delay sent by the server is honoured, up to MaxBackoff.
+func (p RetryPolicy) backoff(n int, err error) time.Duration {
+	var delay time.Duration
+	var errHTTP metadata.ErrDownloadHTTP
+	if errors.As(err, &errHTTP) && errHTTP.RetryAfter > 0 {
+		delay = errHTTP.RetryAfter
+	} else {
+		multiplier := math.Max(p.Multiplier, 1)
+		delay = time.Duration(float64(p.InitialBackoff) * math.Pow(multiplier, float64(n-1)))
+		if p.Jitter > 0 {
+			delay = time.Duration(float64(delay) * (1 + p.Jitter*(2*rand.Float64()-1)))
+		}
+	}
+	if p.MaxBackoff > 0 && (delay > p.MaxBackoff || delay < 0) {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// parseRetryAfter returns the delay of a Retry-After header value given
+// either in seconds or as an HTTP date, or 0 if there is none
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
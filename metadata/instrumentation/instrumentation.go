@@ -0,0 +1,117 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package instrumentation defines the hooks through which the Updater
+// reports the progress of the client workflow, to trace it and to collect
+// metrics about it. The otel and prometheus subpackages implement them on
+// top of OpenTelemetry and Prometheus, as separate modules so that only
+// their users depend on those libraries.
+package instrumentation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// Step is a step of the client workflow
+type Step string
+
+const (
+	// StepRefresh is a whole refresh of the top-level metadata, the parent
+	// of the steps loading the top-level roles
+	StepRefresh Step = "refresh"
+	// StepLoadRoot loads the new versions of the root metadata
+	StepLoadRoot Step = "load_root"
+	// StepLoadTimestamp loads the timestamp metadata
+	StepLoadTimestamp Step = "load_timestamp"
+	// StepLoadSnapshot loads the snapshot metadata
+	StepLoadSnapshot Step = "load_snapshot"
+	// StepLoadTargets loads the metadata of a top-level or delegated
+	// targets role
+	StepLoadTargets Step = "load_targets"
+)
+
+// FileKind tells metadata files and target files apart
+type FileKind string
+
+const (
+	Metadata FileKind = "metadata"
+	Target   FileKind = "target"
+)
+
+// Instrumentation receives the measurements of the client workflow. Its
+// methods are called concurrently by the goroutines using an Updater and
+// must not block.
+type Instrumentation interface {
+	// StartStep is called as a step of the workflow starts, role being the
+	// role whose metadata the step loads, if any. The step runs with the
+	// returned context, and calls the returned function once it is done with
+	// the error it failed with, if any.
+	StartStep(ctx context.Context, step Step, role string) (context.Context, func(err error))
+	// Downloaded reports the number of bytes downloaded for a file,
+	// whether it passed the verification or not
+	Downloaded(ctx context.Context, kind FileKind, bytes int64)
+	// VerificationFailed reports a downloaded file failing the verification
+	// against the trusted metadata. ErrorType classifies err.
+	VerificationFailed(ctx context.Context, kind FileKind, err error)
+	// CachedTarget reports whether a look up of a target file in the local
+	// cache found it up to date
+	CachedTarget(ctx context.Context, hit bool)
+	// DelegationWalk reports the walk of the delegations looking for a
+	// target file, depth being the length of the deepest chain of
+	// delegations visited, the top-level targets role included
+	DelegationWalk(ctx context.Context, depth int, found bool)
+}
+
+// Nop is an Instrumentation which does nothing
+type Nop struct{}
+
+func (Nop) StartStep(ctx context.Context, step Step, role string) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+func (Nop) Downloaded(ctx context.Context, kind FileKind, bytes int64) {
+}
+
+func (Nop) VerificationFailed(ctx context.Context, kind FileKind, err error) {
+}
+
+func (Nop) CachedTarget(ctx context.Context, hit bool) {
+}
+
+func (Nop) DelegationWalk(ctx context.Context, depth int, found bool) {
+}
+
+// ErrorType classifies a verification failure, e.g. to label metrics
+func ErrorType(err error) string {
+	switch {
+	case errors.As(err, &metadata.ErrUnsignedMetadata{}):
+		return "unsigned"
+	case errors.As(err, &metadata.ErrEqualVersionNumber{}):
+		return "equal_version"
+	case errors.As(err, &metadata.ErrBadVersionNumber{}):
+		return "bad_version"
+	case errors.As(err, &metadata.ErrExpiredMetadata{}):
+		return "expired"
+	case errors.As(err, &metadata.ErrLengthOrHashMismatch{}):
+		return "length_or_hash_mismatch"
+	case errors.As(err, &metadata.ErrCustomMetadata{}):
+		return "custom_metadata"
+	case errors.As(err, &metadata.ErrRepository{}):
+		return "repository"
+	case errors.As(err, &metadata.ErrValue{}), errors.As(err, &metadata.ErrType{}):
+		return "invalid"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package instrumentation
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+func TestErrorType(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{err: metadata.ErrUnsignedMetadata{Msg: "not enough signatures"}, want: "unsigned"},
+		{err: metadata.ErrEqualVersionNumber{Msg: "same version"}, want: "equal_version"},
+		{err: metadata.ErrBadVersionNumber{Msg: "older version"}, want: "bad_version"},
+		{err: metadata.ErrExpiredMetadata{Msg: "expired"}, want: "expired"},
+		{err: fmt.Errorf("file: %w", metadata.ErrLengthOrHashMismatch{Msg: "mismatch"}), want: "length_or_hash_mismatch"},
+		{err: metadata.ErrCustomMetadata{Msg: "invalid custom"}, want: "custom_metadata"},
+		{err: metadata.ErrRepository{Msg: "repository"}, want: "repository"},
+		{err: metadata.ErrValue{Msg: "value"}, want: "invalid"},
+		{err: metadata.ErrType{Msg: "type"}, want: "invalid"},
+		{err: errors.New("unexpected end of JSON input"), want: "other"},
+	} {
+		assert.Equal(t, tt.want, ErrorType(tt.err), tt.err.Error())
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package otel reports the client workflow of the Updater as OpenTelemetry
+// spans and metrics.
+//
+// Each step of the workflow is a span, the steps loading the top-level
+// roles being children of the refresh span. Downloads, verification
+// failures and walks of the delegations are recorded as events of the span
+// they are part of. The metrics are:
+//
+//   - tuf.updater.step.duration: histogram of the duration of the steps,
+//     by step and outcome
+//   - tuf.updater.downloaded: bytes downloaded, by kind of file
+//   - tuf.updater.verification.failures: downloaded files failing the
+//     verification, by kind of file and type of error
+//   - tuf.updater.cached_target.lookups: look ups of target files in the
+//     local cache, by whether they were found up to date
+//   - tuf.updater.delegation.depth: histogram of the depth of the walks of
+//     the delegations, by whether the target file was found
+package otel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata/instrumentation"
+)
+
+// scope is the name of the instrumentation scope of the tracer and meter
+const scope = "github.com/rdimitrov/go-tuf-metadata/metadata/updater"
+
+// Instrumentation implements instrumentation.Instrumentation on top of
+// an OpenTelemetry tracer and meter
+type Instrumentation struct {
+	tracer               trace.Tracer
+	stepDuration         metric.Float64Histogram
+	downloaded           metric.Int64Counter
+	verificationFailures metric.Int64Counter
+	cachedTargets        metric.Int64Counter
+	delegationDepth      metric.Int64Histogram
+}
+
+// New creates an Instrumentation reporting the spans to tracerProvider and
+// the metrics to meterProvider, e.g. otel.GetTracerProvider() and
+// otel.GetMeterProvider()
+func New(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) (*Instrumentation, error) {
+	meter := meterProvider.Meter(scope)
+	stepDuration, err := meter.Float64Histogram("tuf.updater.step.duration",
+		metric.WithDescription("Duration of the steps of the client workflow"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	downloaded, err := meter.Int64Counter("tuf.updater.downloaded",
+		metric.WithDescription("Bytes downloaded"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	verificationFailures, err := meter.Int64Counter("tuf.updater.verification.failures",
+		metric.WithDescription("Downloaded files failing the verification"))
+	if err != nil {
+		return nil, err
+	}
+	cachedTargets, err := meter.Int64Counter("tuf.updater.cached_target.lookups",
+		metric.WithDescription("Look ups of target files in the local cache"))
+	if err != nil {
+		return nil, err
+	}
+	delegationDepth, err := meter.Int64Histogram("tuf.updater.delegation.depth",
+		metric.WithDescription("Depth of the walks of the delegations"),
+		metric.WithExplicitBucketBoundaries(1, 2, 3, 4, 6, 8, 16, 32))
+	if err != nil {
+		return nil, err
+	}
+	return &Instrumentation{
+		tracer:               tracerProvider.Tracer(scope),
+		stepDuration:         stepDuration,
+		downloaded:           downloaded,
+		verificationFailures: verificationFailures,
+		cachedTargets:        cachedTargets,
+		delegationDepth:      delegationDepth,
+	}, nil
+}
+
+// StartStep starts a span named after the step
+func (i *Instrumentation) StartStep(ctx context.Context, step instrumentation.Step, role string) (context.Context, func(err error)) {
+	var attrs []attribute.KeyValue
+	if role != "" {
+		attrs = append(attrs, attribute.String("tuf.role", role))
+	}
+	ctx, span := i.tracer.Start(ctx, "tuf."+string(step), trace.WithAttributes(attrs...))
+	start := time.Now()
+	return ctx, func(err error) {
+		outcome := "success"
+		if err != nil {
+			outcome = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		i.stepDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("tuf.step", string(step)),
+			attribute.String("tuf.outcome", outcome)))
+	}
+}
+
+func (i *Instrumentation) Downloaded(ctx context.Context, kind instrumentation.FileKind, bytes int64) {
+	trace.SpanFromContext(ctx).AddEvent("tuf.download", trace.WithAttributes(
+		attribute.String("tuf.kind", string(kind)),
+		attribute.Int64("tuf.bytes", bytes)))
+	i.downloaded.Add(ctx, bytes, metric.WithAttributes(attribute.String("tuf.kind", string(kind))))
+}
+
+func (i *Instrumentation) VerificationFailed(ctx context.Context, kind instrumentation.FileKind, err error) {
+	errorType := instrumentation.ErrorType(err)
+	trace.SpanFromContext(ctx).AddEvent("tuf.verification_failure", trace.WithAttributes(
+		attribute.String("tuf.kind", string(kind)),
+		attribute.String("error.type", errorType),
+		attribute.String("exception.message", err.Error())))
+	i.verificationFailures.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("tuf.kind", string(kind)),
+		attribute.String("error.type", errorType)))
+}
+
+func (i *Instrumentation) CachedTarget(ctx context.Context, hit bool) {
+	i.cachedTargets.Add(ctx, 1, metric.WithAttributes(attribute.Bool("tuf.hit", hit)))
+}
+
+func (i *Instrumentation) DelegationWalk(ctx context.Context, depth int, found bool) {
+	trace.SpanFromContext(ctx).AddEvent("tuf.delegation_walk", trace.WithAttributes(
+		attribute.Int("tuf.depth", depth),
+		attribute.Bool("tuf.found", found)))
+	i.delegationDepth.Record(ctx, int64(depth), metric.WithAttributes(attribute.Bool("tuf.found", found)))
+}
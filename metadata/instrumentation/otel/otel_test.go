@@ -0,0 +1,104 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/instrumentation"
+)
+
+// sums returns the value of the data points of the sum metrics by name
+// and attributes
+func sums(t *testing.T, reader sdkmetric.Reader) map[string]map[attribute.Distinct]int64 {
+	var rm metricdata.ResourceMetrics
+	err := reader.Collect(context.Background(), &rm)
+	assert.NoError(t, err)
+	values := map[string]map[attribute.Distinct]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			values[m.Name] = map[attribute.Distinct]int64{}
+			for _, point := range sum.DataPoints {
+				values[m.Name][point.Attributes.Equivalent()] = point.Value
+			}
+		}
+	}
+	return values
+}
+
+// distinct returns the identifier of a set of attributes
+func distinct(kvs ...attribute.KeyValue) attribute.Distinct {
+	set := attribute.NewSet(kvs...)
+	return set.Equivalent()
+}
+
+func TestInstrumentation(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	var instr instrumentation.Instrumentation
+	instr, err := New(tracerProvider, meterProvider)
+	assert.NoError(t, err)
+
+	ctx, endRefresh := instr.StartStep(context.Background(), instrumentation.StepRefresh, "")
+	stepCtx, endStep := instr.StartStep(ctx, instrumentation.StepLoadTimestamp, metadata.TIMESTAMP)
+	instr.Downloaded(stepCtx, instrumentation.Metadata, 100)
+	instr.Downloaded(stepCtx, instrumentation.Metadata, 20)
+	instr.VerificationFailed(stepCtx, instrumentation.Metadata, metadata.ErrExpiredMetadata{Msg: "timestamp.json is expired"})
+	endStep(metadata.ErrExpiredMetadata{Msg: "timestamp.json is expired"})
+	endRefresh(nil)
+	instr.CachedTarget(context.Background(), true)
+	instr.CachedTarget(context.Background(), false)
+	instr.CachedTarget(context.Background(), false)
+	instr.DelegationWalk(context.Background(), 3, true)
+
+	// the steps are nested spans
+	ended := spans.Ended()
+	assert.Len(t, ended, 2)
+	step, refresh := ended[0], ended[1]
+	assert.Equal(t, "tuf.load_timestamp", step.Name())
+	assert.Equal(t, "tuf.refresh", refresh.Name())
+	assert.Equal(t, refresh.SpanContext().SpanID(), step.Parent().SpanID())
+	assert.Contains(t, step.Attributes(), attribute.String("tuf.role", metadata.TIMESTAMP))
+	assert.Equal(t, codes.Error, step.Status().Code)
+	assert.Equal(t, codes.Unset, refresh.Status().Code)
+	events := []string{}
+	for _, event := range step.Events() {
+		events = append(events, event.Name)
+	}
+	assert.Equal(t, []string{"tuf.download", "tuf.download", "tuf.verification_failure", "exception"}, events)
+
+	values := sums(t, reader)
+	metadataKind := distinct(attribute.String("tuf.kind", "metadata"))
+	assert.Equal(t, int64(120), values["tuf.updater.downloaded"][metadataKind])
+	expired := distinct(attribute.String("tuf.kind", "metadata"), attribute.String("error.type", "expired"))
+	assert.Equal(t, int64(1), values["tuf.updater.verification.failures"][expired])
+	hit := distinct(attribute.Bool("tuf.hit", true))
+	miss := distinct(attribute.Bool("tuf.hit", false))
+	assert.Equal(t, int64(1), values["tuf.updater.cached_target.lookups"][hit])
+	assert.Equal(t, int64(2), values["tuf.updater.cached_target.lookups"][miss])
+}
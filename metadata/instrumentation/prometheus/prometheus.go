@@ -0,0 +1,121 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package prometheus exports metrics about the client workflow of the
+// Updater to Prometheus. The metrics are:
+//
+//   - tuf_updater_step_duration_seconds: histogram of the duration of the
+//     steps, by step and result
+//   - tuf_updater_downloaded_bytes_total: bytes downloaded, by kind of file
+//   - tuf_updater_verification_failures_total: downloaded files failing the
+//     verification, by kind of file and type of error
+//   - tuf_updater_cached_target_lookups_total: look ups of target files in
+//     the local cache, by result
+//   - tuf_updater_delegation_walk_depth: histogram of the depth of the walks
+//     of the delegations, by whether the target file was found
+//
+// The metrics are not labelled by role, as there may be many delegated
+// roles, e.g. with hash bin delegations.
+package prometheus
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata/instrumentation"
+)
+
+// Instrumentation implements instrumentation.Instrumentation with
+// Prometheus metrics
+type Instrumentation struct {
+	stepDuration         *prometheus.HistogramVec
+	downloadedBytes      *prometheus.CounterVec
+	verificationFailures *prometheus.CounterVec
+	cachedTargets        *prometheus.CounterVec
+	delegationDepth      *prometheus.HistogramVec
+}
+
+// New creates an Instrumentation and registers its metrics with
+// registerer, e.g. prometheus.DefaultRegisterer
+func New(registerer prometheus.Registerer) (*Instrumentation, error) {
+	i := &Instrumentation{
+		stepDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tuf_updater_step_duration_seconds",
+			Help:    "Duration of the steps of the client workflow.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"step", "result"}),
+		downloadedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tuf_updater_downloaded_bytes_total",
+			Help: "Bytes downloaded.",
+		}, []string{"kind"}),
+		verificationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tuf_updater_verification_failures_total",
+			Help: "Downloaded files failing the verification.",
+		}, []string{"kind", "error_type"}),
+		cachedTargets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tuf_updater_cached_target_lookups_total",
+			Help: "Look ups of target files in the local cache.",
+		}, []string{"result"}),
+		delegationDepth: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tuf_updater_delegation_walk_depth",
+			Help:    "Depth of the walks of the delegations.",
+			Buckets: []float64{1, 2, 3, 4, 6, 8, 16, 32},
+		}, []string{"found"}),
+	}
+	for _, collector := range []prometheus.Collector{
+		i.stepDuration,
+		i.downloadedBytes,
+		i.verificationFailures,
+		i.cachedTargets,
+		i.delegationDepth,
+	} {
+		err := registerer.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// StartStep times the step
+func (i *Instrumentation) StartStep(ctx context.Context, step instrumentation.Step, role string) (context.Context, func(err error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		i.stepDuration.WithLabelValues(string(step), result).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (i *Instrumentation) Downloaded(ctx context.Context, kind instrumentation.FileKind, bytes int64) {
+	i.downloadedBytes.WithLabelValues(string(kind)).Add(float64(bytes))
+}
+
+func (i *Instrumentation) VerificationFailed(ctx context.Context, kind instrumentation.FileKind, err error) {
+	i.verificationFailures.WithLabelValues(string(kind), instrumentation.ErrorType(err)).Inc()
+}
+
+func (i *Instrumentation) CachedTarget(ctx context.Context, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	i.cachedTargets.WithLabelValues(result).Inc()
+}
+
+func (i *Instrumentation) DelegationWalk(ctx context.Context, depth int, found bool) {
+	i.delegationDepth.WithLabelValues(strconv.FormatBool(found)).Observe(float64(depth))
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/instrumentation"
+)
+
+func TestInstrumentation(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	instr, err := New(registry)
+	assert.NoError(t, err)
+	// the metrics are registered once
+	_, err = New(registry)
+	assert.Error(t, err)
+
+	ctx := context.Background()
+	_, end := instr.StartStep(ctx, instrumentation.StepLoadRoot, metadata.ROOT)
+	end(nil)
+	_, end = instr.StartStep(ctx, instrumentation.StepLoadSnapshot, metadata.SNAPSHOT)
+	end(errors.New("failed"))
+	instr.Downloaded(ctx, instrumentation.Metadata, 100)
+	instr.Downloaded(ctx, instrumentation.Target, 2048)
+	instr.VerificationFailed(ctx, instrumentation.Target, metadata.ErrLengthOrHashMismatch{Msg: "hash verification failed"})
+	instr.CachedTarget(ctx, true)
+	instr.DelegationWalk(ctx, 2, false)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(instr.stepDuration))
+	assert.Equal(t, float64(100), testutil.ToFloat64(instr.downloadedBytes.WithLabelValues("metadata")))
+	assert.Equal(t, float64(2048), testutil.ToFloat64(instr.downloadedBytes.WithLabelValues("target")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(instr.cachedTargets.WithLabelValues("hit")))
+	err = testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP tuf_updater_verification_failures_total Downloaded files failing the verification.
+# TYPE tuf_updater_verification_failures_total counter
+tuf_updater_verification_failures_total{error_type="length_or_hash_mismatch",kind="target"} 1
+`), "tuf_updater_verification_failures_total")
+	assert.NoError(t, err)
+	err = testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP tuf_updater_delegation_walk_depth Depth of the walks of the delegations.
+# TYPE tuf_updater_delegation_walk_depth histogram
+tuf_updater_delegation_walk_depth_bucket{found="false",le="1"} 0
+tuf_updater_delegation_walk_depth_bucket{found="false",le="2"} 1
+tuf_updater_delegation_walk_depth_bucket{found="false",le="3"} 1
+tuf_updater_delegation_walk_depth_bucket{found="false",le="4"} 1
+tuf_updater_delegation_walk_depth_bucket{found="false",le="6"} 1
+tuf_updater_delegation_walk_depth_bucket{found="false",le="8"} 1
+tuf_updater_delegation_walk_depth_bucket{found="false",le="16"} 1
+tuf_updater_delegation_walk_depth_bucket{found="false",le="32"} 1
+tuf_updater_delegation_walk_depth_bucket{found="false",le="+Inf"} 1
+tuf_updater_delegation_walk_depth_sum{found="false"} 2
+tuf_updater_delegation_walk_depth_count{found="false"} 1
+`), "tuf_updater_delegation_walk_depth")
+	assert.NoError(t, err)
+}
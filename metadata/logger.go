@@ -11,10 +11,26 @@
 
 package metadata
 
-var log Logger = DiscardLogger{}
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+var log LeveledLogger = DiscardLogger{}
 
 // Logger partially implements the go-log/logr's interface:
 // https://github.com/go-logr/logr/blob/master/logr.go
+//
+// The key/value pairs logged by the packages of this module use the same
+// keys for the same things: "role" for the name of a role, "version" for
+// the version of its metadata, "url" for a URL, "keyid" for a key ID,
+// "path" for the path of a target file or of a local file, "repo" for the
+// name of a repository of a multi-repository client and "error" for an
+// error.
 type Logger interface {
 	// Info logs a non-error message with key/value pairs
 	Info(msg string, kv ...any)
@@ -22,6 +38,15 @@ type Logger interface {
 	Error(err error, msg string, kv ...any)
 }
 
+// LeveledLogger is a Logger telling debug messages apart, such as those
+// about each signature verified or each role visited while looking for a
+// target file
+type LeveledLogger interface {
+	Logger
+	// Debug logs a verbose non-error message with key/value pairs
+	Debug(msg string, kv ...any)
+}
+
 type DiscardLogger struct{}
 
 func (d DiscardLogger) Info(msg string, kv ...any) {
@@ -30,10 +55,93 @@ func (d DiscardLogger) Info(msg string, kv ...any) {
 func (d DiscardLogger) Error(err error, msg string, kv ...any) {
 }
 
+func (d DiscardLogger) Debug(msg string, kv ...any) {
+}
+
+// SlogLogger is a LeveledLogger writing to a log/slog Logger. The error
+// passed to Error is logged with the "error" key.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a SlogLogger writing to logger, or to the default
+// slog Logger if logger is nil
+func NewSlogLogger(logger *slog.Logger) SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return SlogLogger{logger: logger}
+}
+
+func (s SlogLogger) Info(msg string, kv ...any) {
+	s.log(slog.LevelInfo, msg, kv...)
+}
+
+func (s SlogLogger) Error(err error, msg string, kv ...any) {
+	s.log(slog.LevelError, msg, append([]any{"error", err}, kv...)...)
+}
+
+func (s SlogLogger) Debug(msg string, kv ...any) {
+	s.log(slog.LevelDebug, msg, kv...)
+}
+
+// log writes a record at level, attributed to the caller of the SlogLogger
+func (s SlogLogger) log(level slog.Level, msg string, kv ...any) {
+	ctx := context.Background()
+	if !s.logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	// skip runtime.Callers, log and the method calling it
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.Add(kv...)
+	_ = s.logger.Handler().Handle(ctx, record)
+}
+
+// logrLogger logs the debug messages of a logr.Logger at its V(1) level.
+// The call depth of the logr.Logger skips the methods of logrLogger, so
+// that messages are attributed to their callers.
+type logrLogger struct {
+	logger logr.Logger
+}
+
+func (l logrLogger) Info(msg string, kv ...any) {
+	l.logger.Info(msg, kv...)
+}
+
+func (l logrLogger) Error(err error, msg string, kv ...any) {
+	l.logger.Error(err, msg, kv...)
+}
+
+func (l logrLogger) Debug(msg string, kv ...any) {
+	l.logger.V(1).Info(msg, kv...)
+}
+
+// infoLogger logs the debug messages of a Logger as info messages
+type infoLogger struct {
+	Logger
+}
+
+func (l infoLogger) Debug(msg string, kv ...any) {
+	l.Logger.Info(msg, kv...)
+}
+
+// SetLogger sets the logger used by the packages of this module. Unless
+// logger is a LeveledLogger, debug messages are logged at the V(1) level
+// of a logr.Logger, and as info messages by any other Logger.
 func SetLogger(logger Logger) {
-	log = logger
+	switch logger := logger.(type) {
+	case LeveledLogger:
+		log = logger
+	case logr.Logger:
+		log = logrLogger{logger: logger.WithCallDepth(1)}
+	default:
+		log = infoLogger{Logger: logger}
+	}
 }
 
-func GetLogger() Logger {
+// GetLogger returns the logger set by SetLogger
+func GetLogger() LeveledLogger {
 	return log
 }
@@ -12,10 +12,16 @@
 package metadata
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	stdlog "log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/go-logr/logr/funcr"
 	"github.com/go-logr/stdr"
 	"github.com/stretchr/testify/assert"
 )
@@ -24,11 +30,89 @@ func TestSetLogger(t *testing.T) {
 	// This function is just a simple setter, no need for testing table
 	testLogger := stdr.New(stdlog.New(os.Stdout, "test", stdlog.LstdFlags))
 	SetLogger(testLogger)
-	assert.Equal(t, testLogger, log, "setting package global logger was unsuccessful")
+	assert.Equal(t, logrLogger{logger: testLogger.WithCallDepth(1)}, log, "setting package global logger was unsuccessful")
+}
+
+// infoOnlyLogger is a Logger without debug level
+type infoOnlyLogger struct {
+	messages *[]string
+}
+
+func (l infoOnlyLogger) Info(msg string, kv ...any) {
+	*l.messages = append(*l.messages, msg)
+}
+
+func (l infoOnlyLogger) Error(err error, msg string, kv ...any) {
 }
 
 func TestGetLogger(t *testing.T) {
-	// This function is just a simple getter, no need for testing table
-	testLogger := GetLogger()
-	assert.Equal(t, log, testLogger, "function did not return current logger")
+	defer SetLogger(DiscardLogger{})
+
+	// a LeveledLogger is returned as is
+	SetLogger(DiscardLogger{})
+	assert.Equal(t, DiscardLogger{}, GetLogger(), "function did not return current logger")
+
+	// debug messages go to the V(1) level of a logr.Logger
+	for _, verbosity := range []int{0, 1} {
+		messages := []string{}
+		SetLogger(funcr.New(func(prefix, args string) {
+			messages = append(messages, args)
+		}, funcr.Options{Verbosity: verbosity}))
+		GetLogger().Info("info")
+		GetLogger().Debug("debug")
+		if verbosity == 0 {
+			assert.Equal(t, []string{`"level"=0 "msg"="info"`}, messages)
+		} else {
+			assert.Equal(t, []string{`"level"=0 "msg"="info"`, `"level"=1 "msg"="debug"`}, messages)
+		}
+	}
+
+	// messages are attributed to the caller of the logr.Logger
+	callers := []string{}
+	SetLogger(funcr.New(func(prefix, args string) {
+		callers = append(callers, args)
+	}, funcr.Options{LogCaller: funcr.All, Verbosity: 1}))
+	GetLogger().Info("info")
+	GetLogger().Error(errors.New("failed"), "error")
+	GetLogger().Debug("debug")
+	assert.Len(t, callers, 3)
+	for _, caller := range callers {
+		assert.Contains(t, caller, `"caller"={"file":"logger_test.go"`)
+	}
+
+	// and are info messages for other loggers
+	messages := []string{}
+	SetLogger(infoOnlyLogger{messages: &messages})
+	GetLogger().Debug("debug")
+	assert.Equal(t, []string{"debug"}, messages)
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{AddSource: true})))
+	var leveled LeveledLogger = logger
+	leveled.Debug("Verified with key", "role", ROOT, "keyid", "abc")
+	leveled.Info("Updated root", "role", ROOT, "version", 2)
+	leveled.Error(errors.New("expired"), "Trusting expired metadata", "role", TIMESTAMP)
+
+	records := []map[string]any{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		record := map[string]any{}
+		err := decoder.Decode(&record)
+		assert.NoError(t, err)
+		source := record["source"].(map[string]any)
+		assert.Equal(t, "logger_test.go", filepath.Base(source["file"].(string)))
+		delete(record, "time")
+		delete(record, "source")
+		records = append(records, record)
+	}
+	// the debug message is filtered by the level of the handler
+	assert.Equal(t, []map[string]any{
+		{"level": "INFO", "msg": "Updated root", "role": "root", "version": float64(2)},
+		{"level": "ERROR", "msg": "Trusting expired metadata", "error": "expired", "role": "timestamp"},
+	}, records)
+
+	// the default slog logger is used if none is given
+	assert.Equal(t, slog.Default(), NewSlogLogger(nil).logger)
 }
@@ -27,6 +27,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -50,7 +51,7 @@ func Root(expires ...time.Time) *Metadata[RootType] {
 			Threshold: 1,
 		}
 	}
-	log.Info("Created metadata", "type", ROOT)
+	GetLogger().Debug("Created metadata", "role", ROOT)
 	return &Metadata[RootType]{
 		Signed: RootType{
 			Type:               ROOT,
@@ -71,7 +72,7 @@ func Snapshot(expires ...time.Time) *Metadata[SnapshotType] {
 	if len(expires) == 0 {
 		expires = []time.Time{time.Now().UTC()}
 	}
-	log.Info("Created metadata", "type", SNAPSHOT)
+	GetLogger().Debug("Created metadata", "role", SNAPSHOT)
 	return &Metadata[SnapshotType]{
 		Signed: SnapshotType{
 			Type:        SNAPSHOT,
@@ -94,7 +95,7 @@ func Timestamp(expires ...time.Time) *Metadata[TimestampType] {
 	if len(expires) == 0 {
 		expires = []time.Time{time.Now().UTC()}
 	}
-	log.Info("Created metadata", "type", TIMESTAMP)
+	GetLogger().Debug("Created metadata", "role", TIMESTAMP)
 	return &Metadata[TimestampType]{
 		Signed: TimestampType{
 			Type:        TIMESTAMP,
@@ -117,7 +118,7 @@ func Targets(expires ...time.Time) *Metadata[TargetsType] {
 	if len(expires) == 0 {
 		expires = []time.Time{time.Now().UTC()}
 	}
-	log.Info("Created metadata", "type", TARGETS)
+	GetLogger().Debug("Created metadata", "role", TARGETS)
 	return &Metadata[TargetsType]{
 		Signed: TargetsType{
 			Type:        TARGETS,
@@ -168,7 +169,7 @@ func (meta *Metadata[T]) FromFile(name string) (*Metadata[T], error) {
 		return nil, err
 	}
 	*meta = *m
-	log.Info("Loaded metadata from file", "name", name)
+	GetLogger().Debug("Loaded metadata from file", "path", name)
 	return meta, nil
 }
 
@@ -179,13 +180,13 @@ func (meta *Metadata[T]) FromBytes(data []byte) (*Metadata[T], error) {
 		return nil, err
 	}
 	*meta = *m
-	log.Info("Loaded metadata from bytes")
+	GetLogger().Debug("Loaded metadata from bytes")
 	return meta, nil
 }
 
 // ToBytes serialize metadata to bytes
 func (meta *Metadata[T]) ToBytes(pretty bool) ([]byte, error) {
-	log.Info("Writing metadata to bytes")
+	GetLogger().Debug("Writing metadata to bytes")
 	if pretty {
 		return json.MarshalIndent(*meta, "", "\t")
 	}
@@ -194,7 +195,7 @@ func (meta *Metadata[T]) ToBytes(pretty bool) ([]byte, error) {
 
 // ToFile save metadata to file
 func (meta *Metadata[T]) ToFile(name string, pretty bool) error {
-	log.Info("Writing metadata to file", "name", name)
+	GetLogger().Debug("Writing metadata to file", "path", name)
 	data, err := meta.ToBytes(pretty)
 	if err != nil {
 		return err
@@ -232,20 +233,27 @@ func (meta *Metadata[T]) Sign(signer signature.Signer) (*Signature, error) {
 	// update the Signatures part
 	meta.Signatures = append(meta.Signatures, *sig)
 	// return the new signature
-	log.Info("Signed metadata with key", "ID", key.ID())
+	GetLogger().Debug("Signed metadata with key", "keyid", key.ID())
 	return sig, nil
 }
 
 // VerifyDelegate verifies that delegatedMetadata is signed with the required
 // threshold of keys for the delegated role delegatedRole
 func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata any) error {
+	_, err := meta.VerifyDelegateKeyIDs(delegatedRole, delegatedMetadata)
+	return err
+}
+
+// VerifyDelegateKeyIDs is like VerifyDelegate but also returns the sorted
+// IDs of the keys of delegatedRole whose signature verified
+func (meta *Metadata[T]) VerifyDelegateKeyIDs(delegatedRole string, delegatedMetadata any) ([]string, error) {
 	i := any(meta)
 	signingKeys := map[string]bool{}
 	var keys map[string]*Key
 	var roleKeyIDs []string
 	var roleThreshold int
 
-	log.Info("Verifying", "role", delegatedRole)
+	GetLogger().Debug("Verifying", "role", delegatedRole)
 
 	// collect keys, keyIDs and threshold based on delegator type
 	switch i := i.(type) {
@@ -257,12 +265,12 @@ func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata
 			roleThreshold = role.Threshold
 		} else {
 			// the delegated role was not found, no need to proceed
-			return ErrValue{Msg: fmt.Sprintf("no delegation found for %s", delegatedRole)}
+			return nil, ErrValue{Msg: fmt.Sprintf("no delegation found for %s", delegatedRole)}
 		}
 	// Targets delegator
 	case *Metadata[TargetsType]:
 		if i.Signed.Delegations == nil {
-			return ErrValue{Msg: "no delegations found"}
+			return nil, ErrValue{Msg: "no delegations found"}
 		}
 		keys = i.Signed.Delegations.Keys
 		if i.Signed.Delegations.Roles != nil {
@@ -277,31 +285,31 @@ func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata
 			}
 			// the delegated role was not found, no need to proceed
 			if !found {
-				return ErrValue{Msg: fmt.Sprintf("no delegation found for %s", delegatedRole)}
+				return nil, ErrValue{Msg: fmt.Sprintf("no delegation found for %s", delegatedRole)}
 			}
 		} else if i.Signed.Delegations.SuccinctRoles != nil {
 			roleKeyIDs = i.Signed.Delegations.SuccinctRoles.KeyIDs
 			roleThreshold = i.Signed.Delegations.SuccinctRoles.Threshold
 		}
 	default:
-		return ErrType{Msg: "call is valid only on delegator metadata (should be either root or targets)"}
+		return nil, ErrType{Msg: "call is valid only on delegator metadata (should be either root or targets)"}
 	}
 	// if there are no keyIDs for that role it means there's no delegation found
 	if len(roleKeyIDs) == 0 {
-		return ErrValue{Msg: fmt.Sprintf("no delegation found for %s", delegatedRole)}
+		return nil, ErrValue{Msg: fmt.Sprintf("no delegation found for %s", delegatedRole)}
 	}
 	// loop through each role keyID
 	for _, keyID := range roleKeyIDs {
 		key, ok := keys[keyID]
 		if !ok {
-			return ErrValue{Msg: fmt.Sprintf("key with ID %s not found in %s keyids", keyID, delegatedRole)}
+			return nil, ErrValue{Msg: fmt.Sprintf("key with ID %s not found in %s keyids", keyID, delegatedRole)}
 		}
 		sign := Signature{}
 		var payload []byte
 		// convert to a PublicKey type
 		publicKey, err := key.ToPublicKey()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		// use corresponding hash function for key type
 		hash := crypto.Hash(0)
@@ -311,7 +319,7 @@ func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata
 		// load a verifier based on that key
 		verifier, err := signature.LoadVerifier(publicKey, hash)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		// collect the signature for that key and build the payload we'll verify
 		// based on the Signed part of the delegated metadata
@@ -324,7 +332,7 @@ func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata
 			}
 			payload, err = cjson.EncodeCanonical(d.Signed)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		case *Metadata[SnapshotType]:
 			for _, signature := range d.Signatures {
@@ -334,7 +342,7 @@ func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata
 			}
 			payload, err = cjson.EncodeCanonical(d.Signed)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		case *Metadata[TimestampType]:
 			for _, signature := range d.Signatures {
@@ -344,7 +352,7 @@ func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata
 			}
 			payload, err = cjson.EncodeCanonical(d.Signed)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		case *Metadata[TargetsType]:
 			for _, signature := range d.Signatures {
@@ -354,28 +362,38 @@ func (meta *Metadata[T]) VerifyDelegate(delegatedRole string, delegatedMetadata
 			}
 			payload, err = cjson.EncodeCanonical(d.Signed)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		default:
-			return ErrType{Msg: "unknown delegated metadata type"}
+			return nil, ErrType{Msg: "unknown delegated metadata type"}
 		}
 		// verify if the signature for that payload corresponds to the given key
 		if err := verifier.VerifySignature(bytes.NewReader(sign.Signature), bytes.NewReader(payload)); err != nil {
 			// failed to verify the metadata with that key ID
-			log.Info("Failed to verify %s with key ID %s", delegatedRole, keyID)
+			GetLogger().Debug("Failed to verify with key", "role", delegatedRole, "keyid", keyID, "error", err.Error())
 		} else {
 			// save the verified keyID only if verification passed
 			signingKeys[keyID] = true
-			log.Info("Verified with key", "role", delegatedRole, "ID", keyID)
+			GetLogger().Debug("Verified with key", "role", delegatedRole, "keyid", keyID)
 		}
 	}
+	keyIDs := make([]string, 0, len(signingKeys))
+	for keyID := range signingKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
 	// check if the amount of valid signatures is enough
 	if len(signingKeys) < roleThreshold {
-		log.Info("Verifying failed, not enough signatures", "role", delegatedRole, "got", len(signingKeys), "want", roleThreshold)
-		return ErrUnsignedMetadata{Msg: fmt.Sprintf("Verifying %s failed, not enough signatures, got %d, want %d", delegatedRole, len(signingKeys), roleThreshold)}
+		GetLogger().Debug("Verifying failed, not enough signatures", "role", delegatedRole, "got", len(signingKeys), "want", roleThreshold)
+		return nil, ErrUnsignedMetadata{
+			Msg:       fmt.Sprintf("Verifying %s failed, not enough signatures, got %d, want %d", delegatedRole, len(signingKeys), roleThreshold),
+			Role:      delegatedRole,
+			KeyIDs:    strings.Join(keyIDs, ","),
+			Threshold: roleThreshold,
+		}
 	}
-	log.Info("Verified successfully", "role", delegatedRole)
-	return nil
+	GetLogger().Debug("Verified successfully", "role", delegatedRole)
+	return keyIDs, nil
 }
 
 // IsExpired returns true if metadata is expired.
@@ -435,6 +453,44 @@ func (f *TargetFiles) VerifyLengthHashes(data []byte) error {
 	return nil
 }
 
+// VerifyLengthHashesFromReader checks whether the data read from r matches
+// the TargetFiles length and hashes. The data is hashed as it is read and
+// at most Length+1 bytes are consumed, so r does not need to fit in memory
+func (f *TargetFiles) VerifyLengthHashesFromReader(r io.Reader) error {
+	hashers := map[string]hash.Hash{}
+	writers := []io.Writer{}
+	for k := range f.Hashes {
+		var hasher hash.Hash
+		switch k {
+		case "sha256":
+			hasher = sha256.New()
+		case "sha512":
+			hasher = sha512.New()
+		default:
+			return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("hash verification failed - unknown hashing algorithm - %s", k), Algorithm: k}
+		}
+		hashers[k] = hasher
+		writers = append(writers, hasher)
+	}
+	// read one byte more than expected so oversized data can be detected
+	n, err := io.Copy(io.MultiWriter(writers...), io.LimitReader(r, f.Length+1))
+	if err != nil {
+		return err
+	}
+	if n > f.Length {
+		return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("length verification failed - expected %d, got at least %d", f.Length, n)}
+	}
+	if n != f.Length {
+		return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("length verification failed - expected %d, got %d", f.Length, n)}
+	}
+	for k, v := range f.Hashes {
+		if !hmac.Equal(v, hashers[k].Sum(nil)) {
+			return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("hash verification failed - mismatch for algorithm %s", k), Algorithm: k}
+		}
+	}
+	return nil
+}
+
 // Equal checks whether the source target file matches another
 func (source *TargetFiles) Equal(expected TargetFiles) bool {
 	if source.Length == expected.Length && source.Hashes.Equal(expected.Hashes) {
@@ -445,7 +501,7 @@ func (source *TargetFiles) Equal(expected TargetFiles) bool {
 
 // FromFile generate TargetFiles from file
 func (t *TargetFiles) FromFile(localPath string, hashes ...string) (*TargetFiles, error) {
-	log.Info("Generating target file from file", "path", localPath)
+	GetLogger().Debug("Generating target file from file", "path", localPath)
 	// open file
 	in, err := os.Open(localPath)
 	if err != nil {
@@ -462,7 +518,7 @@ func (t *TargetFiles) FromFile(localPath string, hashes ...string) (*TargetFiles
 
 // FromBytes generate TargetFiles from bytes
 func (t *TargetFiles) FromBytes(localPath string, data []byte, hashes ...string) (*TargetFiles, error) {
-	log.Info("Generating target file from bytes", "path", localPath)
+	GetLogger().Debug("Generating target file from bytes", "path", localPath)
 	var hasher hash.Hash
 	targetFile := &TargetFiles{
 		Hashes: map[string]HexBytes{},
@@ -496,9 +552,39 @@ func (t *TargetFiles) FromBytes(localPath string, data []byte, hashes ...string)
 	return targetFile, nil
 }
 
+// CustomAs unmarshals the custom metadata of target into a value of type T.
+// The zero value of T is returned if target has no custom metadata.
+func CustomAs[T any](target *TargetFiles) (T, error) {
+	var custom T
+	if target.Custom == nil {
+		return custom, nil
+	}
+	err := json.Unmarshal(*target.Custom, &custom)
+	if err != nil {
+		return custom, ErrValue{Msg: fmt.Sprintf("failed to unmarshal custom metadata of %s: %v", target.Path, err)}
+	}
+	return custom, nil
+}
+
+// SetCustom sets the custom metadata of t to the JSON encoding of v,
+// a nil v removes it
+func (t *TargetFiles) SetCustom(v any) error {
+	if v == nil {
+		t.Custom = nil
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	custom := json.RawMessage(data)
+	t.Custom = &custom
+	return nil
+}
+
 // ClearSignatures clears Signatures
 func (meta *Metadata[T]) ClearSignatures() {
-	log.Info("Cleared signatures")
+	GetLogger().Debug("Cleared signatures")
 	meta.Signatures = []Signature{}
 }
 
@@ -551,17 +637,30 @@ func isTargetInPathPattern(targetpath string, pathpattern string) bool {
 // delegated roles who are responsible for targetFilepath
 func (role *Delegations) GetRolesForTarget(targetFilepath string) map[string]bool {
 	res := map[string]bool{}
+	for _, r := range role.GetOrderedRolesForTarget(targetFilepath) {
+		res[r.Name] = r.Terminating
+	}
+	return res
+}
+
+// GetOrderedRolesForTarget is like GetRolesForTarget but returns the
+// delegated roles in order of appearance, which is the order they
+// must be visited in when looking for targetFilepath
+func (role *Delegations) GetOrderedRolesForTarget(targetFilepath string) []RoleResult {
+	res := []RoleResult{}
 	// standard delegations
 	if role.Roles != nil {
 		for _, r := range role.Roles {
 			ok, err := r.IsDelegatedPath(targetFilepath)
 			if err == nil && ok {
-				res[r.Name] = r.Terminating
+				res = append(res, RoleResult{Name: r.Name, Terminating: r.Terminating})
 			}
 		}
 	} else if role.SuccinctRoles != nil {
 		// SuccinctRoles delegations
-		res = role.SuccinctRoles.GetRolesForTarget(targetFilepath)
+		for name, terminating := range role.SuccinctRoles.GetRolesForTarget(targetFilepath) {
+			res = append(res, RoleResult{Name: name, Terminating: terminating})
+		}
 	}
 	return res
 }
@@ -713,7 +812,7 @@ func (signed *TargetsType) AddKey(key *Key, role string) error {
 					signed.Delegations.Keys[key.ID()] = key // TODO: should we check if we don't accidentally override an existing keyID with another key value?
 					return nil
 				}
-				log.Info("Delegated role already has keyID", "role", role, "ID", key.ID())
+				GetLogger().Debug("Delegated role already has keyID", "role", role, "keyid", key.ID())
 			}
 		}
 		if !isDelegatedRole {
@@ -726,7 +825,7 @@ func (signed *TargetsType) AddKey(key *Key, role string) error {
 			signed.Delegations.Keys[key.ID()] = key // TODO: should we check if we don't accidentally override an existing keyID with another key value?
 			return nil
 		}
-		log.Info("SuccinctRoles role already has keyID", "ID", key.ID())
+		GetLogger().Debug("SuccinctRoles role already has keyID", "keyid", key.ID())
 
 	}
 	signed.Delegations.Keys[key.ID()] = key // TODO: should we check if we don't accidentally override an existing keyID with another key value?
@@ -833,11 +932,11 @@ func verifyHashes(data []byte, hashes Hashes) error {
 		case "sha512":
 			hasher = sha512.New()
 		default:
-			return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("hash verification failed - unknown hashing algorithm - %s", k)}
+			return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("hash verification failed - unknown hashing algorithm - %s", k), Algorithm: k}
 		}
 		hasher.Write(data)
 		if hex.EncodeToString(v) != hex.EncodeToString(hasher.Sum(nil)) {
-			return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("hash verification failed - mismatch for algorithm %s", k)}
+			return ErrLengthOrHashMismatch{Msg: fmt.Sprintf("hash verification failed - mismatch for algorithm %s", k), Algorithm: k}
 		}
 	}
 	return nil
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -538,7 +539,7 @@ func TestMetadataVerifyDelegate(t *testing.T) {
 	expires := snapshot.Signed.Expires
 	snapshot.Signed.Expires = snapshot.Signed.Expires.Add(time.Hour * 24)
 	err = root.VerifyDelegate(SNAPSHOT, snapshot)
-	assert.ErrorIs(t, err, ErrUnsignedMetadata{"Verifying snapshot failed, not enough signatures, got 0, want 1"})
+	assert.ErrorIs(t, err, ErrUnsignedMetadata{Msg: "Verifying snapshot failed, not enough signatures, got 0, want 1"})
 	snapshot.Signed.Expires = expires
 
 	// Verify fails with verification error
@@ -548,12 +549,12 @@ func TestMetadataVerifyDelegate(t *testing.T) {
 	assert.NotEmpty(t, goodSig)
 	snapshot.Signatures[idx].Signature = []byte("foo")
 	err = root.VerifyDelegate(SNAPSHOT, snapshot)
-	assert.ErrorIs(t, err, ErrUnsignedMetadata{"Verifying snapshot failed, not enough signatures, got 0, want 1"})
+	assert.ErrorIs(t, err, ErrUnsignedMetadata{Msg: "Verifying snapshot failed, not enough signatures, got 0, want 1"})
 	snapshot.Signatures[idx].Signature = goodSig
 
 	// Verify fails if roles keys do not sign the metadata
 	err = root.VerifyDelegate(TIMESTAMP, snapshot)
-	assert.ErrorIs(t, err, ErrUnsignedMetadata{"Verifying timestamp failed, not enough signatures, got 0, want 1"})
+	assert.ErrorIs(t, err, ErrUnsignedMetadata{Msg: "Verifying timestamp failed, not enough signatures, got 0, want 1"})
 
 	// Add a key to snapshot role, make sure the new sig fails to verify
 	tsKeyID := root.Signed.Roles[TIMESTAMP].KeyIDs[0]
@@ -569,11 +570,16 @@ func TestMetadataVerifyDelegate(t *testing.T) {
 	// fail to verify
 	err = root.VerifyDelegate(SNAPSHOT, snapshot)
 	assert.NoError(t, err)
+	// only the keys with a valid signature are reported
+	keyIDs, err := root.VerifyDelegateKeyIDs(SNAPSHOT, snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{keyID}, keyIDs)
 
 	// Verify fails if threshold of signatures is not reached
 	root.Signed.Roles[SNAPSHOT].Threshold = 2
 	err = root.VerifyDelegate(SNAPSHOT, snapshot)
-	assert.ErrorIs(t, err, ErrUnsignedMetadata{"Verifying snapshot failed, not enough signatures, got 1, want 2"})
+	assert.ErrorIs(t, err, ErrUnsignedMetadata{Msg: "Verifying snapshot failed, not enough signatures, got 1, want 2"})
+	assert.ErrorIs(t, err, ErrUnsignedMetadata{Role: SNAPSHOT, KeyIDs: keyID, Threshold: 2})
 
 	// Verify succeeds when we correct the new signature and reach the
 	// threshold of 2 keys
@@ -583,6 +589,11 @@ func TestMetadataVerifyDelegate(t *testing.T) {
 	assert.NoError(t, err)
 	err = root.VerifyDelegate(SNAPSHOT, snapshot)
 	assert.NoError(t, err)
+	keyIDs, err = root.VerifyDelegateKeyIDs(SNAPSHOT, snapshot)
+	assert.NoError(t, err)
+	wantKeyIDs := []string{keyID, tsKeyID}
+	sort.Strings(wantKeyIDs)
+	assert.Equal(t, wantKeyIDs, keyIDs)
 }
 
 func TestRootAddKeyAndRevokeKey(t *testing.T) {
@@ -803,18 +814,18 @@ func TestLengthAndHashValidation(t *testing.T) {
 	originalLength := snapshotMetafile.Length
 	snapshotMetafile.Length = 2345
 	err = snapshotMetafile.VerifyLengthHashes(data)
-	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{fmt.Sprintf("length verification failed - expected %d, got %d", 2345, originalLength)})
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: fmt.Sprintf("length verification failed - expected %d, got %d", 2345, originalLength)})
 
 	snapshotMetafile.Length = originalLength
 	originalHashSHA256 := snapshotMetafile.Hashes["sha256"]
 	snapshotMetafile.Hashes["sha256"] = []byte("incorrecthash")
 	err = snapshotMetafile.VerifyLengthHashes(data)
-	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{"hash verification failed - mismatch for algorithm sha256"})
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: "hash verification failed - mismatch for algorithm sha256"})
 
 	snapshotMetafile.Hashes["sha256"] = originalHashSHA256
 	snapshotMetafile.Hashes["unsupported-alg"] = []byte("72c5cabeb3e8079545a5f4d2b067f8e35f18a0de3c2b00d3cb8d05919c19c72d")
 	err = snapshotMetafile.VerifyLengthHashes(data)
-	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{"hash verification failed - unknown hashing algorithm - unsupported-alg"})
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: "hash verification failed - unknown hashing algorithm - unsupported-alg"})
 
 	// test optional length and hashes
 	snapshotMetafile.Length = 0
@@ -833,12 +844,43 @@ func TestLengthAndHashValidation(t *testing.T) {
 	originalLength = targetFile.Length
 	targetFile.Length = 2345
 	err = targetFile.VerifyLengthHashes(targetFileData)
-	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{fmt.Sprintf("length verification failed - expected %d, got %d", 2345, originalLength)})
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: fmt.Sprintf("length verification failed - expected %d, got %d", 2345, originalLength)})
 
 	targetFile.Length = originalLength
 	targetFile.Hashes["sha256"] = []byte("incorrecthash")
 	err = targetFile.VerifyLengthHashes(targetFileData)
-	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{"hash verification failed - mismatch for algorithm sha256"})
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: "hash verification failed - mismatch for algorithm sha256"})
+}
+
+func TestLengthAndHashValidationFromReader(t *testing.T) {
+	// Test target files' hash and length verification over a stream
+	targets, err := Targets().FromFile(testutils.RepoDir + "/targets.json")
+	assert.NoError(t, err)
+	targetFile := targets.Signed.Targets["file1.txt"]
+	targetFileData, err := os.ReadFile(testutils.TargetsDir + "/" + targetFile.Path)
+	assert.NoError(t, err)
+
+	err = targetFile.VerifyLengthHashesFromReader(bytes.NewReader(targetFileData))
+	assert.NoError(t, err)
+
+	// test exceptions
+	originalLength := targetFile.Length
+	targetFile.Length = 2345
+	err = targetFile.VerifyLengthHashesFromReader(bytes.NewReader(targetFileData))
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: fmt.Sprintf("length verification failed - expected %d, got %d", 2345, originalLength)})
+
+	targetFile.Length = 1
+	err = targetFile.VerifyLengthHashesFromReader(bytes.NewReader(targetFileData))
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: "length verification failed - expected 1, got at least 2"})
+
+	targetFile.Length = originalLength
+	targetFile.Hashes["sha256"] = []byte("incorrecthash")
+	err = targetFile.VerifyLengthHashesFromReader(bytes.NewReader(targetFileData))
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: "hash verification failed - mismatch for algorithm sha256"})
+
+	targetFile.Hashes["unsupported-alg"] = []byte("incorrecthash")
+	err = targetFile.VerifyLengthHashesFromReader(bytes.NewReader(targetFileData))
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: "hash verification failed - unknown hashing algorithm - unsupported-alg"})
 }
 
 func TestTargetFileFromFile(t *testing.T) {
@@ -854,7 +896,7 @@ func TestTargetFileFromFile(t *testing.T) {
 	mismatchingTargetFileData, err := os.ReadFile(testutils.TargetsDir + "/file2.txt")
 	assert.NoError(t, err)
 	err = targetFileFromFile.VerifyLengthHashes(mismatchingTargetFileData)
-	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{"hash verification failed - mismatch for algorithm sha256"})
+	assert.ErrorIs(t, err, ErrLengthOrHashMismatch{Msg: "hash verification failed - mismatch for algorithm sha256"})
 
 	// Test with an unsupported algorithm
 	_, err = TargetFile().FromFile(testutils.TargetsDir+"/file1.txt", "123")
@@ -871,6 +913,46 @@ func TestTargetFileCustom(t *testing.T) {
 	assert.Equal(t, "{\"foo\":\"bar\"}", string(custom))
 }
 
+func TestTargetFileCustomAs(t *testing.T) {
+	type release struct {
+		Version string   `json:"version"`
+		Tags    []string `json:"tags"`
+	}
+	targetFile := TargetFile()
+	targetFile.Path = "release.tar.gz"
+
+	// Missing custom metadata gives the zero value
+	custom, err := CustomAs[release](targetFile)
+	assert.NoError(t, err)
+	assert.Equal(t, release{}, custom)
+
+	// Set custom metadata and read it back
+	err = targetFile.SetCustom(release{Version: "1.2.3", Tags: []string{"stable"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":"1.2.3","tags":["stable"]}`, string(*targetFile.Custom))
+	custom, err = CustomAs[release](targetFile)
+	assert.NoError(t, err)
+	assert.Equal(t, release{Version: "1.2.3", Tags: []string{"stable"}}, custom)
+	fields, err := CustomAs[map[string]any](targetFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.3", fields["version"])
+
+	// Custom metadata of another shape fails to unmarshal
+	_, err = CustomAs[[]string](targetFile)
+	assert.IsType(t, ErrValue{}, err)
+	assert.ErrorContains(t, err, "failed to unmarshal custom metadata of release.tar.gz")
+
+	// Values which can not be encoded are rejected
+	err = targetFile.SetCustom(func() {})
+	assert.Error(t, err)
+	assert.NotNil(t, targetFile.Custom)
+
+	// A nil value removes the custom metadata
+	err = targetFile.SetCustom(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, targetFile.Custom)
+}
+
 func TestTargetFileFromBytes(t *testing.T) {
 	data := []byte("Inline test content")
 
@@ -274,6 +274,26 @@ func TestIsDelegatedPath(t *testing.T) {
 	}
 }
 
+func TestGetOrderedRolesForTarget(t *testing.T) {
+	delegations := &Delegations{
+		Roles: []DelegatedRole{
+			{Name: "c", Paths: []string{"*.tgz"}},
+			{Name: "a", Paths: []string{"*.txt"}},
+			{Name: "b", Paths: []string{"*"}, Terminating: true},
+			{Name: "d", Paths: []string{"foo.*"}},
+		},
+	}
+	// roles are returned in order of appearance
+	assert.Equal(t, []RoleResult{{Name: "c"}, {Name: "b", Terminating: true}, {Name: "d"}}, delegations.GetOrderedRolesForTarget("foo.tgz"))
+	assert.Equal(t, []RoleResult{{Name: "a"}, {Name: "b", Terminating: true}}, delegations.GetOrderedRolesForTarget("bar.txt"))
+	assert.Equal(t, map[string]bool{"a": false, "b": true}, delegations.GetRolesForTarget("bar.txt"))
+
+	succinct := &Delegations{
+		SuccinctRoles: &SuccinctRoles{BitLength: 8, NamePrefix: "bin"},
+	}
+	assert.Equal(t, []RoleResult{{Name: "bin-34", Terminating: true}}, succinct.GetOrderedRolesForTarget("foo.tgz"))
+}
+
 func TestClearSignatures(t *testing.T) {
 	meta := Root()
 	// verify signatures is empty
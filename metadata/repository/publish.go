@@ -0,0 +1,214 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/repository/storage"
+)
+
+// Target is a target file to publish along with its content
+type Target struct {
+	File *metadata.TargetFiles
+	// Content is read once to verify it against File, then once more or
+	// twice for each file it is published as, depending on the storage
+	Content io.ReadSeeker
+}
+
+// Publish publishes targets to targetsStorage, followed by the metadata to
+// metadataStorage. Files are published in the order in which clients need
+// them to exist: the target files, then the delegated targets metadata,
+// the top-level targets metadata, the snapshot metadata, the root metadata
+// and finally the timestamp metadata. Clients thus never download
+// timestamp metadata listing files which are not published yet, as long
+// as consistent snapshots are enabled; otherwise the snapshot and targets
+// metadata are replaced in place and clients may see them change before
+// the timestamp metadata does. Publishing stops at the first error,
+// before the timestamp metadata is published.
+func (r *Repository) Publish(ctx context.Context, metadataStorage, targetsStorage storage.Storage, targets ...Target) error {
+	for _, target := range targets {
+		err := r.PublishTarget(ctx, targetsStorage, target)
+		if err != nil {
+			return err
+		}
+	}
+	return r.PublishMetadata(ctx, metadataStorage)
+}
+
+// PublishTarget publishes the content of a target file to s, once it is
+// verified against the length and hashes of the target file. If the root
+// metadata enables consistent snapshots, the content is published under
+// its path prefixed with each of its hashes, as in "dir/<hash>.name", and
+// under its path otherwise.
+func (r *Repository) PublishTarget(ctx context.Context, s storage.Storage, target Target) error {
+	if r.root == nil {
+		return metadata.ErrValue{Msg: "root metadata must be set"}
+	}
+	names, err := targetNames(target.File, r.root.Signed.ConsistentSnapshot)
+	if err != nil {
+		return err
+	}
+	start, err := target.Content.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	err = target.File.VerifyLengthHashesFromReader(target.Content)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, err = target.Content.Seek(start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = s.Put(ctx, name, sectionOf(target.Content, start, target.File.Length))
+		if err != nil {
+			return err
+		}
+	}
+	metadata.GetLogger().Info("Published target", "path", target.File.Path)
+	return nil
+}
+
+// PublishMetadata publishes the metadata to s, in the order described by
+// Publish and under the file names of consistent snapshots if the root
+// metadata enables them. Root metadata is always published as
+// "<version>.root.json", and the versions published before are kept for
+// clients to update their trusted root metadata one version after the
+// other.
+func (r *Repository) PublishMetadata(ctx context.Context, s storage.Storage) error {
+	if r.root == nil || r.snapshot == nil || r.timestamp == nil || r.targets[metadata.TARGETS] == nil {
+		return metadata.ErrValue{Msg: "root, timestamp, snapshot and targets metadata must be set"}
+	}
+	consistent := r.root.Signed.ConsistentSnapshot
+	// delegated targets metadata before the targets metadata delegating
+	// to it
+	for _, role := range sortedKeys(r.targets) {
+		if role == metadata.TARGETS {
+			continue
+		}
+		targets := r.targets[role]
+		err := putMetadata(ctx, s, role, targets, targets.Signed.Version, consistent)
+		if err != nil {
+			return err
+		}
+	}
+	targets := r.targets[metadata.TARGETS]
+	err := putMetadata(ctx, s, metadata.TARGETS, targets, targets.Signed.Version, consistent)
+	if err != nil {
+		return err
+	}
+	err = putMetadata(ctx, s, metadata.SNAPSHOT, r.snapshot, r.snapshot.Signed.Version, consistent)
+	if err != nil {
+		return err
+	}
+	err = putMetadata(ctx, s, metadata.ROOT, r.root, r.root.Signed.Version, true)
+	if err != nil {
+		return err
+	}
+	err = putMetadata(ctx, s, metadata.TIMESTAMP, r.timestamp, r.timestamp.Signed.Version, false)
+	if err != nil {
+		return err
+	}
+	metadata.GetLogger().Info("Published metadata", "version", r.timestamp.Signed.Version)
+	return nil
+}
+
+// putMetadata publishes meta to s, prefixing its file name with version if
+// versioned is set
+func putMetadata(ctx context.Context, s storage.Storage, role string, meta signable, version int64, versioned bool) error {
+	data, err := meta.ToBytes(true)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s.json", url.QueryEscape(role))
+	if versioned {
+		name = fmt.Sprintf("%d.%s", version, name)
+	}
+	return s.Put(ctx, name, bytes.NewReader(data))
+}
+
+// targetNames returns the slash-separated names under which targetFile is
+// published
+func targetNames(targetFile *metadata.TargetFiles, consistent bool) ([]string, error) {
+	if !consistent {
+		return []string{targetFile.Path}, nil
+	}
+	names := []string{}
+	dir, base := path.Split(targetFile.Path)
+	for _, algorithm := range sortedKeys(targetFile.Hashes) {
+		names = append(names, fmt.Sprintf("%s%s.%s", dir, targetFile.Hashes[algorithm], base))
+	}
+	if len(names) == 0 {
+		return nil, metadata.ErrValue{Msg: fmt.Sprintf("target file %s has no hashes", targetFile.Path)}
+	}
+	return names, nil
+}
+
+// sectionOf returns the n bytes of r following offset start, which r is at.
+// It is an io.ReadSeeker as well, so that storages such as S3Storage read
+// it twice rather than holding it in memory.
+func sectionOf(r io.ReadSeeker, start, n int64) io.ReadSeeker {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, start, n)
+	}
+	return &sectionReadSeeker{r: r, start: start, n: n}
+}
+
+// sectionReadSeeker is an io.SectionReader of an io.ReadSeeker which is not
+// an io.ReaderAt
+type sectionReadSeeker struct {
+	r     io.ReadSeeker
+	start int64
+	n     int64
+	off   int64
+}
+
+func (s *sectionReadSeeker) Read(p []byte) (int, error) {
+	if s.off >= s.n {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.n-s.off {
+		p = p[:s.n-s.off]
+	}
+	n, err := s.r.Read(p)
+	s.off += int64(n)
+	return n, err
+}
+
+func (s *sectionReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.off
+	case io.SeekEnd:
+		offset += s.n
+	default:
+		return 0, metadata.ErrValue{Msg: fmt.Sprintf("invalid whence %d", whence)}
+	}
+	if offset < 0 {
+		return 0, metadata.ErrValue{Msg: fmt.Sprintf("invalid offset %d", offset)}
+	}
+	_, err := s.r.Seek(s.start+offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	s.off = offset
+	return offset, nil
+}
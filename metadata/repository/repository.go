@@ -9,63 +9,87 @@
 //
 // SPDX-License-Identifier: BSD-2-Clause
 
+// Package repository maintains the metadata of a TUF repository: it adds
+// and removes target files, keeps the snapshot and timestamp metadata in
+// line with the targets metadata, signs the metadata which changed with a
+// new version and writes it out.
 package repository
 
 import (
+	"github.com/sigstore/sigstore/pkg/signature"
+
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
 )
 
-// repositoryType struct for storing metadata
-type repositoryType struct {
+// Repository struct for storing metadata
+type Repository struct {
 	root      *metadata.Metadata[metadata.RootType]
 	snapshot  *metadata.Metadata[metadata.SnapshotType]
 	timestamp *metadata.Metadata[metadata.TimestampType]
 	targets   map[string]*metadata.Metadata[metadata.TargetsType]
+	// signers sign the metadata of each role
+	signers map[string][]signature.Signer
+	// changed holds the roles changed since the last commit
+	changed     map[string]bool
+	metaOptions MetaFileOptions
 }
 
 // New creates an empty repository instance
-func New() *repositoryType {
-	return &repositoryType{
+func New() *Repository {
+	return &Repository{
 		targets: map[string]*metadata.Metadata[metadata.TargetsType]{},
+		signers: map[string][]signature.Signer{},
+		changed: map[string]bool{},
 	}
 }
 
 // Root returns metadata of type Root
-func (r *repositoryType) Root() *metadata.Metadata[metadata.RootType] {
+func (r *Repository) Root() *metadata.Metadata[metadata.RootType] {
 	return r.root
 }
 
 // SetRoot sets metadata of type Root
-func (r *repositoryType) SetRoot(meta *metadata.Metadata[metadata.RootType]) {
+func (r *Repository) SetRoot(meta *metadata.Metadata[metadata.RootType]) {
 	r.root = meta
 }
 
 // Snapshot returns metadata of type Snapshot
-func (r *repositoryType) Snapshot() *metadata.Metadata[metadata.SnapshotType] {
+func (r *Repository) Snapshot() *metadata.Metadata[metadata.SnapshotType] {
 	return r.snapshot
 }
 
 // SetSnapshot sets metadata of type Snapshot
-func (r *repositoryType) SetSnapshot(meta *metadata.Metadata[metadata.SnapshotType]) {
+func (r *Repository) SetSnapshot(meta *metadata.Metadata[metadata.SnapshotType]) {
 	r.snapshot = meta
 }
 
 // Timestamp returns metadata of type Timestamp
-func (r *repositoryType) Timestamp() *metadata.Metadata[metadata.TimestampType] {
+func (r *Repository) Timestamp() *metadata.Metadata[metadata.TimestampType] {
 	return r.timestamp
 }
 
 // SetTimestamp sets metadata of type Timestamp
-func (r *repositoryType) SetTimestamp(meta *metadata.Metadata[metadata.TimestampType]) {
+func (r *Repository) SetTimestamp(meta *metadata.Metadata[metadata.TimestampType]) {
 	r.timestamp = meta
 }
 
 // Targets returns metadata of type Targets
-func (r *repositoryType) Targets(name string) *metadata.Metadata[metadata.TargetsType] {
+func (r *Repository) Targets(name string) *metadata.Metadata[metadata.TargetsType] {
 	return r.targets[name]
 }
 
 // SetTargets sets metadata of type Targets
-func (r *repositoryType) SetTargets(name string, meta *metadata.Metadata[metadata.TargetsType]) {
+func (r *Repository) SetTargets(name string, meta *metadata.Metadata[metadata.TargetsType]) {
 	r.targets[name] = meta
 }
+
+// AddSigner adds a signer to those signing the metadata of role
+func (r *Repository) AddSigner(role string, signer signature.Signer) {
+	r.signers[role] = append(r.signers[role], signer)
+}
+
+// SetMetaFileOptions sets what the snapshot and timestamp metadata record
+// about the metadata files they list
+func (r *Repository) SetMetaFileOptions(options MetaFileOptions) {
+	r.metaOptions = options
+}
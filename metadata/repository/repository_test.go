@@ -12,10 +12,23 @@
 package repository
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/fetcher"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/updater"
+	"github.com/sigstore/sigstore/pkg/signature"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,3 +63,281 @@ func TestNewRepository(t *testing.T) {
 	assert.Equal(t, int64(1), repo.Snapshot().Signed.Version)
 	assert.Equal(t, metadata.SPECIFICATION_VERSION, repo.Snapshot().Signed.SpecVersion)
 }
+
+// newRepository creates a repository with a key and a signer for each
+// top-level role
+func newRepository(t *testing.T, expires time.Time) *Repository {
+	repo := New()
+	repo.SetRoot(metadata.Root(expires))
+	repo.SetTargets(metadata.TARGETS, metadata.Targets(expires))
+	repo.SetSnapshot(metadata.Snapshot(expires))
+	repo.SetTimestamp(metadata.Timestamp(expires))
+	for _, role := range []string{metadata.ROOT, metadata.TARGETS, metadata.SNAPSHOT, metadata.TIMESTAMP} {
+		_, private, err := ed25519.GenerateKey(nil)
+		assert.NoError(t, err)
+		key, err := metadata.KeyFromPublicKey(private.Public())
+		assert.NoError(t, err)
+		err = repo.Root().Signed.AddKey(key, role)
+		assert.NoError(t, err)
+		signer, err := signature.LoadSigner(private, crypto.Hash(0))
+		assert.NoError(t, err)
+		repo.AddSigner(role, signer)
+	}
+	return repo
+}
+
+// versions returns the versions of the top-level metadata
+func versions(repo *Repository) []int64 {
+	return []int64{
+		repo.Root().Signed.Version,
+		repo.Targets(metadata.TARGETS).Signed.Version,
+		repo.Snapshot().Signed.Version,
+		repo.Timestamp().Signed.Version,
+	}
+}
+
+func TestCommitAndWrite(t *testing.T) {
+	repoDir := t.TempDir()
+	metadataDir := filepath.Join(repoDir, "metadata")
+	targetsDir := filepath.Join(repoDir, "targets")
+	err := os.Mkdir(metadataDir, 0755)
+	assert.NoError(t, err)
+	repo := newRepository(t, time.Now().UTC().Truncate(time.Second).AddDate(0, 0, 30))
+	repo.SetMetaFileOptions(MetaFileOptions{Length: true, HashAlgorithms: []string{"sha256"}})
+
+	content := []byte("hello")
+	targetFile, err := metadata.TargetFile().FromBytes("dir/hello.txt", content, "sha256", "sha512")
+	assert.NoError(t, err)
+	err = repo.AddTarget(metadata.TARGETS, targetFile)
+	assert.NoError(t, err)
+	err = repo.Commit()
+	assert.NoError(t, err)
+	// metadata signed for the first time keeps its version
+	assert.Equal(t, []int64{1, 1, 1, 1}, versions(repo))
+	targetsMeta := repo.Snapshot().Signed.Meta["targets.json"]
+	assert.Positive(t, targetsMeta.Length)
+	assert.Len(t, targetsMeta.Hashes, 1)
+	err = repo.Write(metadataDir)
+	assert.NoError(t, err)
+	err = repo.WriteTarget(targetsDir, targetFile, bytes.NewReader(content))
+	assert.NoError(t, err)
+	for _, name := range []string{
+		"metadata/1.root.json",
+		"metadata/1.targets.json",
+		"metadata/1.snapshot.json",
+		"metadata/timestamp.json",
+		"targets/dir/" + hex.EncodeToString(targetFile.Hashes["sha256"]) + ".hello.txt",
+		"targets/dir/" + hex.EncodeToString(targetFile.Hashes["sha512"]) + ".hello.txt",
+	} {
+		assert.FileExists(t, filepath.Join(repoDir, filepath.FromSlash(name)))
+	}
+
+	// a client trusting the root metadata finds the target file
+	rootBytes, err := os.ReadFile(filepath.Join(metadataDir, "1.root.json"))
+	assert.NoError(t, err)
+	cfg, err := config.New("https://example.com/metadata", rootBytes)
+	assert.NoError(t, err)
+	cfg.RemoteTargetsURL = "https://example.com/targets"
+	cfg.Fetcher = fetcher.NewFSFetcher(os.DirFS(repoDir))
+	cfg.LocalMetadataDir = t.TempDir()
+	cfg.LocalTargetsDir = t.TempDir()
+	client, err := updater.New(cfg)
+	assert.NoError(t, err)
+	targetInfo, err := client.GetTargetInfo("dir/hello.txt")
+	assert.NoError(t, err)
+	_, data, err := client.DownloadTarget(targetInfo, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	// committing without changes changes nothing
+	err = repo.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 1, 1, 1}, versions(repo))
+
+	// changed metadata gets a new version, as do snapshot and timestamp
+	err = repo.RemoveTarget(metadata.TARGETS, "dir/hello.txt")
+	assert.NoError(t, err)
+	err = repo.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 2, 2}, versions(repo))
+	err = repo.Write(metadataDir)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(metadataDir, "2.targets.json"))
+	client, err = updater.New(cfg)
+	assert.NoError(t, err)
+	_, err = client.GetTargetInfo("dir/hello.txt")
+	assert.ErrorIs(t, err, metadata.ErrTargetNotFound{Path: "dir/hello.txt"})
+
+	// only the timestamp metadata changes when its expiry is extended
+	repo.Timestamp().Signed.Expires = repo.Timestamp().Signed.Expires.AddDate(0, 0, 1)
+	repo.MarkChanged(metadata.TIMESTAMP)
+	err = repo.Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 2, 3}, versions(repo))
+}
+
+func TestWriterErrors(t *testing.T) {
+	repo := newRepository(t, time.Now().UTC().AddDate(0, 0, 30))
+	targetFile, err := metadata.TargetFile().FromBytes("hello.txt", []byte("hello"))
+	assert.NoError(t, err)
+
+	err = repo.AddTarget("unknown", targetFile)
+	assert.ErrorIs(t, err, metadata.ErrValue{Msg: "unknown targets role unknown"})
+	err = repo.RemoveTarget(metadata.TARGETS, "missing.txt")
+	assert.ErrorIs(t, err, metadata.ErrTargetNotFound{Path: "missing.txt"})
+
+	// content not matching the target file is not written
+	targetsDir := t.TempDir()
+	err = repo.WriteTarget(targetsDir, targetFile, bytes.NewReader([]byte("hellO")))
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{})
+	entries, err := os.ReadDir(targetsDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	// nor is a target file outside of the targets directory
+	targetFile.Path = "../hello.txt"
+	err = repo.WriteTarget(targetsDir, targetFile, bytes.NewReader([]byte("hello")))
+	assert.ErrorContains(t, err, "target path ../hello.txt is not a local path")
+
+	// roles to sign must have signers
+	repo.SetTargets("delegated", metadata.Targets(time.Now().UTC().AddDate(0, 0, 30)))
+	err = repo.Commit()
+	assert.ErrorIs(t, err, metadata.ErrValue{Msg: "no signer for role delegated"})
+	assert.Empty(t, repo.Root().Signatures)
+
+	// a signer failing leaves the repository as it was
+	repo = newRepository(t, time.Now().UTC().AddDate(0, 0, 30))
+	err = repo.Commit()
+	assert.NoError(t, err)
+	targetsSignatures := repo.Targets(metadata.TARGETS).Signatures
+	repo.AddSigner(metadata.SNAPSHOT, failingSigner{})
+	err = repo.AddTarget(metadata.TARGETS, targetFile)
+	assert.NoError(t, err)
+	err = repo.Commit()
+	assert.ErrorIs(t, err, metadata.ErrUnsignedMetadata{})
+	assert.Equal(t, []int64{1, 1, 1, 1}, versions(repo))
+	assert.Equal(t, targetsSignatures, repo.Targets(metadata.TARGETS).Signatures)
+}
+
+// failingSigner is a signer failing to sign anything
+type failingSigner struct {
+	signature.Signer
+}
+
+func (failingSigner) SignMessage(message io.Reader, opts ...signature.SignOption) ([]byte, error) {
+	return nil, errors.New("signing failed")
+}
+
+// recordingStorage is a storage recording the names of the files put in it
+type recordingStorage struct {
+	names []string
+}
+
+func (s *recordingStorage) Put(ctx context.Context, name string, r io.Reader) error {
+	_, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	s.names = append(s.names, name)
+	return nil
+}
+
+func TestPublish(t *testing.T) {
+	expires := time.Now().UTC().AddDate(0, 0, 30)
+	repo := newRepository(t, expires)
+	delegated := metadata.Targets(expires)
+	repo.SetTargets("role1", delegated)
+	_, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	signer, err := signature.LoadSigner(private, crypto.Hash(0))
+	assert.NoError(t, err)
+	repo.AddSigner("role1", signer)
+	content := []byte("hello")
+	targetFile, err := metadata.TargetFile().FromBytes("dir/hello.txt", content, "sha256")
+	assert.NoError(t, err)
+	err = repo.AddTarget("role1", targetFile)
+	assert.NoError(t, err)
+	err = repo.Commit()
+	assert.NoError(t, err)
+
+	metadataStorage := &recordingStorage{}
+	targetsStorage := &recordingStorage{}
+	err = repo.Publish(context.Background(), metadataStorage, targetsStorage, Target{File: targetFile, Content: bytes.NewReader(content)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dir/" + hex.EncodeToString(targetFile.Hashes["sha256"]) + ".hello.txt"}, targetsStorage.names)
+	// the timestamp metadata is published last
+	assert.Equal(t, []string{"1.role1.json", "1.targets.json", "1.snapshot.json", "1.root.json", "timestamp.json"}, metadataStorage.names)
+
+	// no metadata is published after a target file fails to verify
+	metadataStorage = &recordingStorage{}
+	targetsStorage = &recordingStorage{}
+	err = repo.Publish(context.Background(), metadataStorage, targetsStorage, Target{File: targetFile, Content: bytes.NewReader([]byte("hellO"))})
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{})
+	assert.Empty(t, targetsStorage.names)
+	assert.Empty(t, metadataStorage.names)
+
+	// without consistent snapshots files are published under their names
+	repo.Root().Signed.ConsistentSnapshot = false
+	metadataStorage = &recordingStorage{}
+	targetsStorage = &recordingStorage{}
+	err = repo.Publish(context.Background(), metadataStorage, targetsStorage, Target{File: targetFile, Content: bytes.NewReader(content)})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dir/hello.txt"}, targetsStorage.names)
+	assert.Equal(t, []string{"role1.json", "targets.json", "snapshot.json", "1.root.json", "timestamp.json"}, metadataStorage.names)
+}
+
+// seekingStorage is a storage reading the files put in it twice, as
+// S3Storage does with an io.ReadSeeker
+type seekingStorage struct {
+	files map[string]string
+}
+
+func (s *seekingStorage) Put(ctx context.Context, name string, r io.Reader) error {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return metadata.ErrValue{Msg: name + " is not an io.ReadSeeker"}
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, rs)
+	if err != nil {
+		return err
+	}
+	_, err = rs.Seek(start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rs)
+	if err != nil {
+		return err
+	}
+	s.files[name] = string(data)
+	return nil
+}
+
+func TestPublishTargetSeekable(t *testing.T) {
+	repo := newRepository(t, time.Now().UTC().AddDate(0, 0, 30))
+	repo.Root().Signed.ConsistentSnapshot = false
+	targetFile, err := metadata.TargetFile().FromBytes("hello.txt", []byte("hello"), "sha256")
+	assert.NoError(t, err)
+
+	for _, tt := range []struct {
+		name    string
+		content io.ReadSeeker
+	}{
+		{name: "io.ReaderAt", content: bytes.NewReader([]byte("--hello"))},
+		// hide the io.ReaderAt of the bytes.Reader
+		{name: "io.ReadSeeker", content: struct{ io.ReadSeeker }{bytes.NewReader([]byte("--hello"))}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// the content is published from its current offset
+			_, err := tt.content.Seek(2, io.SeekStart)
+			assert.NoError(t, err)
+			s := &seekingStorage{files: map[string]string{}}
+			err = repo.PublishTarget(context.Background(), s, Target{File: targetFile, Content: tt.content})
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{"hello.txt": "hello"}, s.files)
+		})
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// S3Options configures an S3Storage
+type S3Options struct {
+	// Endpoint is the URL of the S3 API, such as
+	// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	// for a local MinIO server
+	Endpoint string
+	// Region is the region of the bucket, such as "eu-west-1". S3
+	// compatible servers usually accept "us-east-1".
+	Region string
+	// Bucket is the name of the bucket holding the files
+	Bucket string
+	// Prefix is prepended to the names of the files to get the keys of
+	// their objects, such as "metadata/"
+	Prefix string
+	// AccessKeyID and SecretAccessKey are the credentials signing the
+	// requests, and SessionToken the token of temporary credentials
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// VirtualHostedStyle addresses the bucket as a subdomain of the
+	// endpoint rather than as the first segment of the path
+	VirtualHostedStyle bool
+	// Client sends the requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// S3Storage implements a Storage in a bucket of Amazon S3 or of an S3
+// compatible object store such as MinIO. Objects are replaced atomically
+// by S3, so clients never download partially uploaded files.
+type S3Storage struct {
+	options  S3Options
+	endpoint *url.URL
+}
+
+// NewS3Storage creates an S3Storage writing to the bucket configured by
+// options
+func NewS3Storage(options S3Options) (*S3Storage, error) {
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, metadata.ErrValue{Msg: fmt.Sprintf("S3 endpoint %s is not an absolute URL", options.Endpoint)}
+	}
+	if options.Bucket == "" || options.Region == "" {
+		return nil, metadata.ErrValue{Msg: "S3 bucket and region must be set"}
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	return &S3Storage{options: options, endpoint: endpoint}, nil
+}
+
+// maxObjectSize is the largest object S3 accepts in a single PutObject
+// request, 5 GiB
+const maxObjectSize = 5 << 30
+
+// Put uploads the object of the file at name with a single PutObject
+// request, which S3 limits to files of up to 5 GiB. The content of r is
+// read twice if r is an io.ReadSeeker, and held in memory otherwise.
+func (s *S3Storage) Put(ctx context.Context, name string, r io.Reader) error {
+	_, err := localPath(name)
+	if err != nil {
+		return err
+	}
+	// the payload is hashed before uploading it, which reads it in full
+	// and lets an error reading it cancel the upload
+	body, size, payloadHash, err := payload(r)
+	if err != nil {
+		return err
+	}
+	if size > maxObjectSize {
+		return metadata.ErrValue{Msg: fmt.Sprintf("file %s is larger than the 5 GiB allowed by a single S3 upload", name)}
+	}
+	if size == 0 {
+		body = http.NoBody
+	}
+	objectURL := s.objectURL(s.options.Prefix + name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType(name))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.options.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.options.SessionToken)
+	}
+	s.sign(req, payloadHash, time.Now())
+	res, err := s.options.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return metadata.ErrUpload{
+			Msg:        fmt.Sprintf("failed to upload %s, %s", objectURL, responseError(res)),
+			URL:        objectURL.String(),
+			StatusCode: res.StatusCode,
+		}
+	}
+	metadata.GetLogger().Debug("Uploaded file", "path", name, "url", objectURL.String())
+	return nil
+}
+
+// objectURL returns the URL of the object with key
+func (s *S3Storage) objectURL(key string) *url.URL {
+	objectURL := *s.endpoint
+	objectPath := strings.TrimSuffix(objectURL.Path, "/") + "/"
+	if s.options.VirtualHostedStyle {
+		objectURL.Host = s.options.Bucket + "." + objectURL.Host
+	} else {
+		objectPath += s.options.Bucket + "/"
+	}
+	objectURL.Path = objectPath + key
+	// escape the path the way the signature expects it
+	objectURL.RawPath = uriEncode(objectURL.Path)
+	return &objectURL
+}
+
+// sign adds the Authorization header of AWS Signature Version 4 to req,
+// which signs the host and all the headers set on req
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.options.Region)
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+	key := []byte("AWS4" + s.options.SecretAccessKey)
+	for _, part := range []string{date, s.options.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		s.options.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes every byte of the path s but the unreserved characters
+// and the slashes
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// payload returns the content of r to upload along with its size and its
+// hex encoded SHA-256 hash. The content of an io.ReadSeeker is read twice
+// rather than held in memory.
+func payload(r io.Reader) (io.Reader, int64, string, error) {
+	hasher := sha256.New()
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		size, err := io.Copy(hasher, rs)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		_, err = rs.Seek(start, io.SeekStart)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		return io.LimitReader(rs, size), size, hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	hasher.Write(data)
+	return bytes.NewReader(data), int64(len(data)), hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// contentType returns the media type of the file at name
+func contentType(name string) string {
+	if path.Ext(name) == ".json" {
+		return "application/json"
+	}
+	return "application/octet-stream"
+}
+
+// responseError describes the error returned by S3 in res
+func responseError(res *http.Response) string {
+	var s3Error struct {
+		Code    string
+		Message string
+	}
+	err := xml.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&s3Error)
+	if err != nil || s3Error.Code == "" {
+		return fmt.Sprintf("http status code: %d", res.StatusCode)
+	}
+	return fmt.Sprintf("http status code: %d, %s: %s", res.StatusCode, s3Error.Code, s3Error.Message)
+}
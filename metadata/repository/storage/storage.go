@@ -0,0 +1,75 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package storage provides the places where a repository publishes its
+// metadata and target files for clients to download them, such as a
+// local directory served by a web server or an S3 bucket.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/store"
+)
+
+// Storage holds the files published by a repository
+type Storage interface {
+	// Put replaces the file at name, a slash-separated path relative to
+	// the storage, with the content read from r. Clients see either the
+	// previous content of the file or the new one, never a partial one.
+	// The file is replaced only if reading r up to io.EOF succeeds, so r
+	// can fail the write by returning an error.
+	Put(ctx context.Context, name string, r io.Reader) error
+}
+
+// FileStorage implements a Storage in a directory of the local file system
+type FileStorage struct {
+	dir string
+}
+
+// NewFileStorage creates a FileStorage writing files to dir
+func NewFileStorage(dir string) *FileStorage {
+	return &FileStorage{dir: dir}
+}
+
+// Put atomically writes the file at name in the directory of the storage,
+// creating the directories of name as needed
+func (s *FileStorage) Put(ctx context.Context, name string, r io.Reader) error {
+	localName, err := localPath(name)
+	if err != nil {
+		return err
+	}
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+	localName = filepath.Join(s.dir, localName)
+	err = os.MkdirAll(filepath.Dir(localName), 0755)
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(localName, r, 0644)
+}
+
+// localPath checks name is a path within the storage and converts it to a
+// path of the local file system
+func localPath(name string) (string, error) {
+	localName := filepath.FromSlash(name)
+	if !filepath.IsLocal(localName) {
+		return "", metadata.ErrValue{Msg: fmt.Sprintf("file name %s is not a local path", name)}
+	}
+	return localName, nil
+}
@@ -0,0 +1,323 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sigstore/sigstore/pkg/signature"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/repository/storage"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/store"
+)
+
+// MetaFileOptions selects what the snapshot and timestamp metadata record
+// about the metadata files they list, besides their version
+type MetaFileOptions struct {
+	// Length records the length of the metadata files
+	Length bool
+	// HashAlgorithms lists the algorithms of the hashes recorded, such as
+	// "sha256", none being recorded by default
+	HashAlgorithms []string
+}
+
+// signable is implemented by the metadata of all roles
+type signable interface {
+	Sign(signer signature.Signer) (*metadata.Signature, error)
+	ClearSignatures()
+	ToBytes(pretty bool) ([]byte, error)
+}
+
+// AddTarget adds targetFile to the metadata of the targets role named
+// role, replacing the target file with the same path if there is one
+func (r *Repository) AddTarget(role string, targetFile *metadata.TargetFiles) error {
+	targets := r.targets[role]
+	if targets == nil {
+		return metadata.ErrValue{Msg: fmt.Sprintf("unknown targets role %s", role)}
+	}
+	if targets.Signed.Targets == nil {
+		targets.Signed.Targets = map[string]*metadata.TargetFiles{}
+	}
+	targets.Signed.Targets[targetFile.Path] = targetFile
+	r.changed[role] = true
+	return nil
+}
+
+// RemoveTarget removes the target file at targetPath from the metadata of
+// the targets role named role
+func (r *Repository) RemoveTarget(role, targetPath string) error {
+	targets := r.targets[role]
+	if targets == nil {
+		return metadata.ErrValue{Msg: fmt.Sprintf("unknown targets role %s", role)}
+	}
+	if _, ok := targets.Signed.Targets[targetPath]; !ok {
+		return metadata.ErrTargetNotFound{Path: targetPath}
+	}
+	delete(targets.Signed.Targets, targetPath)
+	r.changed[role] = true
+	return nil
+}
+
+// MarkChanged marks the metadata of role as changed, so that the next
+// Commit gives it a new version and signs it again. This is needed after
+// changing metadata through its getter, e.g. to add a delegation or to
+// extend its expiry date.
+func (r *Repository) MarkChanged(role string) {
+	r.changed[role] = true
+}
+
+// Commit brings the metadata of the repository to a new consistent state
+// after some of it changed. The metadata of the changed roles, as well as
+// metadata which is not signed yet, is signed again by the signers of its
+// role. Metadata which was signed before gets a new version first. The
+// snapshot metadata is updated to list the current targets metadata, and
+// the timestamp metadata to list the current snapshot metadata, which
+// changes them as well if needed. If any signing fails, the metadata of
+// the repository is left unchanged.
+func (r *Repository) Commit() error {
+	if r.root == nil || r.snapshot == nil || r.timestamp == nil || r.targets[metadata.TARGETS] == nil {
+		return metadata.ErrValue{Msg: "root, timestamp, snapshot and targets metadata must be set"}
+	}
+	// check every role to sign has signers before changing anything
+	toSign := []string{}
+	if r.changed[metadata.ROOT] || len(r.root.Signatures) == 0 {
+		toSign = append(toSign, metadata.ROOT)
+	}
+	for _, role := range sortedKeys(r.targets) {
+		if r.changed[role] || len(r.targets[role].Signatures) == 0 {
+			toSign = append(toSign, role)
+		}
+	}
+	for _, role := range append(toSign, metadata.SNAPSHOT, metadata.TIMESTAMP) {
+		if len(r.signers[role]) == 0 {
+			return metadata.ErrValue{Msg: fmt.Sprintf("no signer for role %s", role)}
+		}
+	}
+	// sign copies of the metadata, so that a failure leaves the
+	// repository as it was
+	root := r.root
+	targets := maps.Clone(r.targets)
+	for _, role := range toSign {
+		if role == metadata.ROOT {
+			signed, err := copyMetadata(r.root)
+			if err != nil {
+				return err
+			}
+			err = r.sign(role, signed, len(signed.Signatures) > 0, &signed.Signed.Version)
+			if err != nil {
+				return err
+			}
+			root = signed
+			continue
+		}
+		signed, err := copyMetadata(r.targets[role])
+		if err != nil {
+			return err
+		}
+		err = r.sign(role, signed, len(signed.Signatures) > 0, &signed.Signed.Version)
+		if err != nil {
+			return err
+		}
+		targets[role] = signed
+	}
+	// list the targets metadata in the snapshot metadata
+	snapshotMeta := map[string]*metadata.MetaFiles{}
+	for role, meta := range targets {
+		metaFile, err := r.metaFile(meta, meta.Signed.Version)
+		if err != nil {
+			return err
+		}
+		snapshotMeta[fmt.Sprintf("%s.json", role)] = metaFile
+	}
+	snapshot := r.snapshot
+	if r.changed[metadata.SNAPSHOT] || len(r.snapshot.Signatures) == 0 || !sameMeta(r.snapshot.Signed.Meta, snapshotMeta) {
+		var err error
+		snapshot, err = copyMetadata(r.snapshot)
+		if err != nil {
+			return err
+		}
+		snapshot.Signed.Meta = snapshotMeta
+		err = r.sign(metadata.SNAPSHOT, snapshot, len(snapshot.Signatures) > 0, &snapshot.Signed.Version)
+		if err != nil {
+			return err
+		}
+	}
+	// list the snapshot metadata in the timestamp metadata
+	metaFile, err := r.metaFile(snapshot, snapshot.Signed.Version)
+	if err != nil {
+		return err
+	}
+	timestampMeta := map[string]*metadata.MetaFiles{fmt.Sprintf("%s.json", metadata.SNAPSHOT): metaFile}
+	timestamp := r.timestamp
+	if r.changed[metadata.TIMESTAMP] || len(r.timestamp.Signatures) == 0 || !sameMeta(r.timestamp.Signed.Meta, timestampMeta) {
+		timestamp, err = copyMetadata(r.timestamp)
+		if err != nil {
+			return err
+		}
+		timestamp.Signed.Meta = timestampMeta
+		err = r.sign(metadata.TIMESTAMP, timestamp, len(timestamp.Signatures) > 0, &timestamp.Signed.Version)
+		if err != nil {
+			return err
+		}
+	}
+	// everything is signed, update the metadata in place so that the
+	// metadata returned by the getters stays current
+	*r.root = *root
+	for role, meta := range targets {
+		*r.targets[role] = *meta
+	}
+	*r.snapshot = *snapshot
+	*r.timestamp = *timestamp
+	clear(r.changed)
+	return nil
+}
+
+// sign signs meta with the signers of role, after bumping its version if
+// it was signed already
+func (r *Repository) sign(role string, meta signable, signed bool, version *int64) error {
+	if signed {
+		*version++
+	}
+	meta.ClearSignatures()
+	for _, signer := range r.signers[role] {
+		_, err := meta.Sign(signer)
+		if err != nil {
+			return err
+		}
+	}
+	metadata.GetLogger().Info("Signed metadata", "role", role, "version", *version)
+	return nil
+}
+
+// copyMetadata returns a deep copy of meta
+func copyMetadata[T metadata.Roles](meta *metadata.Metadata[T]) (*metadata.Metadata[T], error) {
+	data, err := meta.ToBytes(false)
+	if err != nil {
+		return nil, err
+	}
+	return (&metadata.Metadata[T]{}).FromBytes(data)
+}
+
+// metaFile describes meta for the snapshot or timestamp metadata
+func (r *Repository) metaFile(meta signable, version int64) (*metadata.MetaFiles, error) {
+	metaFile := metadata.MetaFile(version)
+	if !r.metaOptions.Length && len(r.metaOptions.HashAlgorithms) == 0 {
+		return metaFile, nil
+	}
+	data, err := meta.ToBytes(true)
+	if err != nil {
+		return nil, err
+	}
+	if r.metaOptions.Length {
+		metaFile.Length = int64(len(data))
+	}
+	if len(r.metaOptions.HashAlgorithms) > 0 {
+		// compute the hashes the same way as those of target files
+		described, err := metadata.TargetFile().FromBytes("", data, r.metaOptions.HashAlgorithms...)
+		if err != nil {
+			return nil, err
+		}
+		metaFile.Hashes = described.Hashes
+	}
+	return metaFile, nil
+}
+
+// sameMeta reports whether two sets of meta files describe the same files
+func sameMeta(a, b map[string]*metadata.MetaFiles) bool {
+	return maps.EqualFunc(a, b, func(x, y *metadata.MetaFiles) bool {
+		return x.Version == y.Version && x.Length == y.Length &&
+			maps.EqualFunc(x.Hashes, y.Hashes, func(h, k metadata.HexBytes) bool {
+				return bytes.Equal(h, k)
+			})
+	})
+}
+
+// Write writes the metadata to dir, as PublishMetadata does to a
+// storage.FileStorage. Each file is replaced atomically, the timestamp
+// metadata last.
+func (r *Repository) Write(dir string) error {
+	return r.PublishMetadata(context.Background(), storage.NewFileStorage(dir))
+}
+
+// WriteTarget writes content, the content of targetFile, to targetsDir.
+// If the root metadata enables consistent snapshots, the content is
+// written under its path prefixed with each of its hashes, as in
+// "dir/<hash>.name", and under its path otherwise. The content is checked
+// against the length and hashes of targetFile, and the files are only
+// written if they match.
+func (r *Repository) WriteTarget(targetsDir string, targetFile *metadata.TargetFiles, content io.Reader) error {
+	if r.root == nil {
+		return metadata.ErrValue{Msg: "root metadata must be set"}
+	}
+	localPath := filepath.FromSlash(targetFile.Path)
+	if !filepath.IsLocal(localPath) {
+		return metadata.ErrValue{Msg: fmt.Sprintf("target path %s is not a local path", targetFile.Path)}
+	}
+	names, err := targetNames(targetFile, r.root.Signed.ConsistentSnapshot)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(targetsDir, filepath.Dir(localPath))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	// verify the content while writing it to a temporary file, which
+	// becomes the first file once it is verified and copied to the others
+	tmp, err := os.CreateTemp(dir, "tuf_tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = targetFile.VerifyLengthHashesFromReader(io.TeeReader(content, tmp))
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range names[1:] {
+		err = copyFile(tmp.Name(), filepath.Join(targetsDir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+	}
+	return store.CommitFile(tmp.Name(), filepath.Join(targetsDir, filepath.FromSlash(names[0])), 0644)
+}
+
+// copyFile atomically copies the file src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return store.WriteFileAtomic(dst, in, 0644)
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,401 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package schema validates the custom metadata of target files against a
+// JSON Schema.
+//
+// Only the structural keywords of JSON Schema are supported: type, enum,
+// const, properties, required, additionalProperties, items, minItems,
+// maxItems, minLength, maxLength, pattern, minimum and maximum. The
+// annotations $schema, $id, $comment, title, description, default and
+// examples are ignored. Schemas using any other keyword, such as $ref or
+// allOf, are rejected by Compile rather than partially enforced.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// annotations are the keywords which do not constrain the instances
+var annotations = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+}
+
+// types are the names of the JSON types
+var types = map[string]bool{
+	"null":    true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+	"number":  true,
+	"string":  true,
+	"integer": true,
+}
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	// reject is set by the false schema, which no instance validates
+	reject               bool
+	types                []string
+	enum                 []any
+	constant             any
+	hasConst             bool
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	items                *Schema
+	minItems             *int
+	maxItems             *int
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	minimum              *float64
+	maximum              *float64
+}
+
+// Compile parses a JSON Schema
+func Compile(data []byte) (*Schema, error) {
+	var raw any
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	return compile(raw, "#")
+}
+
+// MustCompile is like Compile but panics if the schema can not be parsed
+func MustCompile(data []byte) *Schema {
+	schema, err := Compile(data)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// compile parses the schema at location
+func compile(raw any, location string) (*Schema, error) {
+	switch raw := raw.(type) {
+	case bool:
+		return &Schema{reject: !raw}, nil
+	case map[string]any:
+		schema := &Schema{}
+		// go through the keywords in order for reproducible errors
+		keywords := make([]string, 0, len(raw))
+		for keyword := range raw {
+			keywords = append(keywords, keyword)
+		}
+		sort.Strings(keywords)
+		for _, keyword := range keywords {
+			err := schema.compileKeyword(keyword, raw[keyword], location+"/"+keyword)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("schema at %s is not an object or a boolean", location)
+	}
+}
+
+// compileKeyword parses the value of a keyword at location
+func (schema *Schema) compileKeyword(keyword string, value any, location string) error {
+	var err error
+	switch keyword {
+	case "type":
+		switch value := value.(type) {
+		case string:
+			schema.types = []string{value}
+		case []any:
+			for _, t := range value {
+				name, ok := t.(string)
+				if !ok {
+					return fmt.Errorf("invalid type at %s", location)
+				}
+				schema.types = append(schema.types, name)
+			}
+		default:
+			return fmt.Errorf("invalid type at %s", location)
+		}
+		for _, name := range schema.types {
+			if !types[name] {
+				return fmt.Errorf("unknown type %q at %s", name, location)
+			}
+		}
+	case "enum":
+		values, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("enum at %s is not an array", location)
+		}
+		schema.enum = values
+	case "const":
+		schema.constant = value
+		schema.hasConst = true
+	case "properties":
+		properties, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("properties at %s is not an object", location)
+		}
+		schema.properties = map[string]*Schema{}
+		for name, property := range properties {
+			schema.properties[name], err = compile(property, location+"/"+name)
+			if err != nil {
+				return err
+			}
+		}
+	case "required":
+		names, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("required at %s is not an array", location)
+		}
+		for _, name := range names {
+			name, ok := name.(string)
+			if !ok {
+				return fmt.Errorf("required at %s is not an array of strings", location)
+			}
+			schema.required = append(schema.required, name)
+		}
+	case "additionalProperties":
+		schema.additionalProperties, err = compile(value, location)
+	case "items":
+		schema.items, err = compile(value, location)
+	case "minItems":
+		schema.minItems, err = compileCount(value, location)
+	case "maxItems":
+		schema.maxItems, err = compileCount(value, location)
+	case "minLength":
+		schema.minLength, err = compileCount(value, location)
+	case "maxLength":
+		schema.maxLength, err = compileCount(value, location)
+	case "pattern":
+		pattern, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("pattern at %s is not a string", location)
+		}
+		schema.pattern, err = regexp.Compile(pattern)
+	case "minimum":
+		schema.minimum, err = compileNumber(value, location)
+	case "maximum":
+		schema.maximum, err = compileNumber(value, location)
+	default:
+		if !annotations[keyword] {
+			return fmt.Errorf("unsupported keyword %q at %s", keyword, location)
+		}
+	}
+	return err
+}
+
+// compileCount parses a non-negative integer at location
+func compileCount(value any, location string) (*int, error) {
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, fmt.Errorf("value at %s is not a non-negative integer", location)
+	}
+	count := int(number)
+	return &count, nil
+}
+
+// compileNumber parses a number at location
+func compileNumber(value any, location string) (*float64, error) {
+	number, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("value at %s is not a number", location)
+	}
+	return &number, nil
+}
+
+// Validate checks that custom validates against the schema, a nil custom
+// being the JSON null. It can be used as the Validate function of a
+// config.CustomValidator.
+func (schema *Schema) Validate(custom *json.RawMessage) error {
+	var instance any
+	if custom != nil {
+		err := json.Unmarshal(*custom, &instance)
+		if err != nil {
+			return err
+		}
+	}
+	return schema.validate(instance, "")
+}
+
+// validate checks instance at location, a JSON pointer
+func (schema *Schema) validate(instance any, location string) error {
+	if schema.reject {
+		return fmt.Errorf("%s: no value is allowed", pointer(location))
+	}
+	if len(schema.types) > 0 && !hasType(instance, schema.types) {
+		return fmt.Errorf("%s: expected %s, got %s", pointer(location), strings.Join(schema.types, " or "), typeOf(instance))
+	}
+	if schema.enum != nil && !contains(schema.enum, instance) {
+		return fmt.Errorf("%s: value is not one of the allowed values", pointer(location))
+	}
+	if schema.hasConst && !reflect.DeepEqual(schema.constant, instance) {
+		return fmt.Errorf("%s: value is not the allowed value", pointer(location))
+	}
+	switch instance := instance.(type) {
+	case map[string]any:
+		return schema.validateObject(instance, location)
+	case []any:
+		return schema.validateArray(instance, location)
+	case string:
+		return schema.validateString(instance, location)
+	case float64:
+		return schema.validateNumber(instance, location)
+	}
+	return nil
+}
+
+// validateObject checks the properties of an object
+func (schema *Schema) validateObject(instance map[string]any, location string) error {
+	for _, name := range schema.required {
+		if _, ok := instance[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", pointer(location), name)
+		}
+	}
+	names := make([]string, 0, len(instance))
+	for name := range instance {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := schema.properties[name]
+		if !ok {
+			property = schema.additionalProperties
+		}
+		if property == nil {
+			continue
+		}
+		err := property.validate(instance[name], location+"/"+escape(name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateArray checks the items of an array
+func (schema *Schema) validateArray(instance []any, location string) error {
+	if schema.minItems != nil && len(instance) < *schema.minItems {
+		return fmt.Errorf("%s: expected at least %d items, got %d", pointer(location), *schema.minItems, len(instance))
+	}
+	if schema.maxItems != nil && len(instance) > *schema.maxItems {
+		return fmt.Errorf("%s: expected at most %d items, got %d", pointer(location), *schema.maxItems, len(instance))
+	}
+	if schema.items == nil {
+		return nil
+	}
+	for i, item := range instance {
+		err := schema.items.validate(item, fmt.Sprintf("%s/%d", location, i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateString checks the length and the pattern of a string
+func (schema *Schema) validateString(instance string, location string) error {
+	length := utf8.RuneCountInString(instance)
+	if schema.minLength != nil && length < *schema.minLength {
+		return fmt.Errorf("%s: expected at least %d characters, got %d", pointer(location), *schema.minLength, length)
+	}
+	if schema.maxLength != nil && length > *schema.maxLength {
+		return fmt.Errorf("%s: expected at most %d characters, got %d", pointer(location), *schema.maxLength, length)
+	}
+	if schema.pattern != nil && !schema.pattern.MatchString(instance) {
+		return fmt.Errorf("%s: value does not match pattern %q", pointer(location), schema.pattern)
+	}
+	return nil
+}
+
+// validateNumber checks the bounds of a number
+func (schema *Schema) validateNumber(instance float64, location string) error {
+	if schema.minimum != nil && instance < *schema.minimum {
+		return fmt.Errorf("%s: expected at least %v, got %v", pointer(location), *schema.minimum, instance)
+	}
+	if schema.maximum != nil && instance > *schema.maximum {
+		return fmt.Errorf("%s: expected at most %v, got %v", pointer(location), *schema.maximum, instance)
+	}
+	return nil
+}
+
+// hasType reports whether instance is of any of the JSON types
+func hasType(instance any, types []string) bool {
+	for _, name := range types {
+		if name == typeOf(instance) {
+			return true
+		}
+		// integers are numbers as well
+		if name == "number" && typeOf(instance) == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON type of instance, integers being told apart
+// from other numbers
+func typeOf(instance any) string {
+	switch instance := instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if instance == math.Trunc(instance) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", instance)
+	}
+}
+
+// contains reports whether values holds instance
+func contains(values []any, instance any) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, instance) {
+			return true
+		}
+	}
+	return false
+}
+
+// escape escapes a property name in a JSON pointer
+func escape(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// pointer returns the JSON pointer at location, "/" being the root
+func pointer(location string) string {
+	if location == "" {
+		return "/"
+	}
+	return location
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const releaseSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "release",
+	"type": "object",
+	"required": ["version", "channel"],
+	"properties": {
+		"version": {"type": "string", "pattern": "^[0-9]+\\.[0-9]+\\.[0-9]+$"},
+		"channel": {"enum": ["stable", "beta"]},
+		"build": {"type": "integer", "minimum": 1},
+		"ratio": {"type": "number", "maximum": 1},
+		"tags": {"type": "array", "items": {"type": "string", "minLength": 1, "maxLength": 8}, "maxItems": 2},
+		"format": {"const": 2},
+		"notes": {"type": ["string", "null"]}
+	},
+	"additionalProperties": false
+}`
+
+func raw(s string) *json.RawMessage {
+	custom := json.RawMessage(s)
+	return &custom
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(releaseSchema))
+	assert.NoError(t, err)
+	for _, tt := range []struct {
+		name    string
+		custom  *json.RawMessage
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			custom: raw(`{"version":"1.2.3","channel":"stable","build":7,"ratio":0.5,"tags":["a","b"],"format":2,"notes":null}`),
+		},
+		{
+			name:    "missing custom metadata",
+			custom:  nil,
+			wantErr: "/: expected object, got null",
+		},
+		{
+			name:    "missing required property",
+			custom:  raw(`{"version":"1.2.3"}`),
+			wantErr: `/: missing required property "channel"`,
+		},
+		{
+			name:    "additional property",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","extra":true}`),
+			wantErr: "/extra: no value is allowed",
+		},
+		{
+			name:    "pattern",
+			custom:  raw(`{"version":"latest","channel":"beta"}`),
+			wantErr: `/version: value does not match pattern`,
+		},
+		{
+			name:    "enum",
+			custom:  raw(`{"version":"1.2.3","channel":"nightly"}`),
+			wantErr: "/channel: value is not one of the allowed values",
+		},
+		{
+			name:    "integer",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","build":1.5}`),
+			wantErr: "/build: expected integer, got number",
+		},
+		{
+			name:    "minimum",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","build":0}`),
+			wantErr: "/build: expected at least 1, got 0",
+		},
+		{
+			name:    "maximum",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","ratio":2}`),
+			wantErr: "/ratio: expected at most 1, got 2",
+		},
+		{
+			name:    "item",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","tags":["a",""]}`),
+			wantErr: "/tags/1: expected at least 1 characters, got 0",
+		},
+		{
+			name:    "length in characters",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","tags":["ünïcödé!"]}`),
+			wantErr: "",
+		},
+		{
+			name:    "max items",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","tags":["a","b","c"]}`),
+			wantErr: "/tags: expected at most 2 items, got 3",
+		},
+		{
+			name:    "const",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","format":1}`),
+			wantErr: "/format: value is not the allowed value",
+		},
+		{
+			name:    "type union",
+			custom:  raw(`{"version":"1.2.3","channel":"beta","notes":1}`),
+			wantErr: "/notes: expected string or null, got integer",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate(tt.custom)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// invalid JSON does not validate
+	err = schema.Validate(raw(`{`))
+	assert.Error(t, err)
+}
+
+func TestCompile(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{name: "true schema", schema: `true`},
+		{name: "empty schema", schema: `{}`},
+		{name: "invalid JSON", schema: `{`, wantErr: "unexpected end of JSON input"},
+		{name: "not a schema", schema: `1`, wantErr: "schema at # is not an object or a boolean"},
+		{name: "unsupported keyword", schema: `{"properties":{"a":{"$ref":"#"}}}`, wantErr: `unsupported keyword "$ref" at #/properties/a/$ref`},
+		{name: "unknown type", schema: `{"type":"float"}`, wantErr: `unknown type "float" at #/type`},
+		{name: "invalid count", schema: `{"minLength":-1}`, wantErr: "value at #/minLength is not a non-negative integer"},
+		{name: "invalid pattern", schema: `{"pattern":"("}`, wantErr: "missing closing )"},
+		{name: "invalid required", schema: `{"required":[1]}`, wantErr: "required at #/required is not an array of strings"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]byte(tt.schema))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// the false schema rejects everything
+	schema := MustCompile([]byte(`false`))
+	assert.ErrorContains(t, schema.Validate(raw(`{}`)), "/: no value is allowed")
+	assert.Panics(t, func() { MustCompile([]byte(`{"allOf":[]}`)) })
+}
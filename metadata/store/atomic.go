@@ -0,0 +1,89 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// WriteFileAtomic writes the content of r to a temporary file in the
+// directory of name, which replaces name with the given permissions once
+// the whole content was written and synced to disk. Readers of name see
+// either its previous content or the new one, even after a power loss.
+func WriteFileAtomic(name string, r io.Reader, perm fs.FileMode) error {
+	log := metadata.GetLogger()
+
+	// the temporary file lives in the destination directory, so the
+	// final rename does not cross file systems
+	file, err := os.CreateTemp(filepath.Dir(name), "tuf_tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = renameSyncedFile(file.Name(), name, perm)
+	}
+	if err != nil {
+		// delete the temporary file if there was an error while writing
+		errRemove := os.Remove(file.Name())
+		if errRemove != nil && !os.IsNotExist(errRemove) {
+			log.Info("Failed to delete temporary file", "path", file.Name())
+		}
+		return err
+	}
+	return nil
+}
+
+// CommitFile renames the complete file at tmpName to name with the given
+// permissions. The content of the file is synced to disk first, and the
+// directory of name after the rename, so that name is never seen with a
+// partially written content.
+func CommitFile(tmpName, name string, perm fs.FileMode) error {
+	file, err := os.OpenFile(tmpName, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	return renameSyncedFile(tmpName, name, perm)
+}
+
+// renameSyncedFile renames the file at tmpName, whose content is synced
+// to disk already, to name with the given permissions and syncs the
+// directory of name
+func renameSyncedFile(tmpName, name string, perm fs.FileMode) error {
+	err := os.Chmod(tmpName, perm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpName, name)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
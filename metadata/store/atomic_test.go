@@ -0,0 +1,113 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "timestamp.json")
+	// nothing is written to the working directory
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { _ = os.Chdir(wd) }()
+
+	for _, tt := range []struct {
+		name        string
+		r           io.Reader
+		perm        fs.FileMode
+		wantErr     string
+		wantContent []byte
+	}{
+		{
+			name:        "new file",
+			r:           bytes.NewReader([]byte("first")),
+			perm:        0644,
+			wantContent: []byte("first"),
+		},
+		{
+			name:        "replaced file",
+			r:           bytes.NewReader([]byte("second")),
+			perm:        0600,
+			wantContent: []byte("second"),
+		},
+		{
+			name:        "failed write",
+			r:           io.MultiReader(bytes.NewReader([]byte("partial")), iotest.ErrReader(errors.New("broken"))),
+			perm:        0644,
+			wantErr:     "broken",
+			wantContent: []byte("second"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WriteFileAtomic(name, tt.r, tt.perm)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				info, err := os.Stat(name)
+				assert.NoError(t, err)
+				if runtime.GOOS != "windows" {
+					assert.Equal(t, tt.perm, info.Mode().Perm())
+				}
+			}
+			data, err := os.ReadFile(name)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantContent, data)
+			// the temporary file is gone
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+			cwd, err := os.ReadDir(".")
+			assert.NoError(t, err)
+			assert.Empty(t, cwd)
+		})
+	}
+
+	// a missing directory fails without creating anything
+	err = WriteFileAtomic(filepath.Join(dir, "missing", "root.json"), bytes.NewReader(nil), 0644)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCommitFile(t *testing.T) {
+	dir := t.TempDir()
+	tmpName := filepath.Join(dir, "file.txt.partial")
+	name := filepath.Join(dir, "file.txt")
+	assert.NoError(t, os.WriteFile(tmpName, []byte("content"), 0600))
+
+	assert.NoError(t, CommitFile(tmpName, name, 0644))
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("content"), data)
+	info, err := os.Stat(name)
+	assert.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, fs.FileMode(0644), info.Mode().Perm())
+	}
+	_, err = os.Stat(tmpName)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.ErrorIs(t, CommitFile(tmpName, name, 0644), fs.ErrNotExist)
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileStore implements PathStore and Locker, keeping metadata files in one
+// directory and target files in another one
+type FileStore struct {
+	metadataDir string
+	targetsDir  string
+}
+
+// NewFileStore creates a FileStore using the given directories, which
+// must already exist
+func NewFileStore(metadataDir, targetsDir string) *FileStore {
+	return &FileStore{
+		metadataDir: metadataDir,
+		targetsDir:  targetsDir,
+	}
+}
+
+// ReadMetadata reads "<metadataDir>/<roleName>.json"
+func (s *FileStore) ReadMetadata(roleName string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.metadataDir, metadataFileName(roleName)))
+}
+
+// WriteMetadata writes "<metadataDir>/<roleName>.json"
+func (s *FileStore) WriteMetadata(roleName string, data []byte) error {
+	return WriteFileAtomic(filepath.Join(s.metadataDir, metadataFileName(roleName)), bytes.NewReader(data), 0644)
+}
+
+// OpenTarget opens the file returned by TargetPath
+func (s *FileStore) OpenTarget(targetPath string) (io.ReadCloser, error) {
+	return os.Open(s.TargetPath(targetPath))
+}
+
+// WriteTarget writes the file returned by TargetPath
+func (s *FileStore) WriteTarget(targetPath string, r io.Reader) error {
+	return WriteFileAtomic(s.TargetPath(targetPath), r, 0644)
+}
+
+// Lock locks the ".lock" file of metadataDir, so several processes can
+// share the same directories
+func (s *FileStore) Lock(ctx context.Context) (func() error, error) {
+	file, err := LockFile(ctx, filepath.Join(s.metadataDir, ".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return UnlockFile(file) }, nil
+}
+
+// TargetPath returns the path of the target file in targetsDir
+func (s *FileStore) TargetPath(targetPath string) string {
+	return filepath.Join(s.targetsDir, targetFileName(targetPath))
+}
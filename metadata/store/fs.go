@@ -0,0 +1,66 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// FSStore implements a read-only Store on top of file systems such as an
+// embed.FS, using the same file names as FileStore. Writing to it fails
+// with metadata.ErrReadOnly, which the Updater handles by not caching
+// what it downloaded.
+type FSStore struct {
+	metadataFS fs.FS
+	targetsFS  fs.FS
+}
+
+// NewFSStore creates an FSStore reading metadata files from metadataFS and
+// target files from targetsFS. Either of them can be nil if there are no
+// such files, e.g. fs.Sub can be used to pick the directories of an
+// embed.FS holding them.
+func NewFSStore(metadataFS, targetsFS fs.FS) *FSStore {
+	return &FSStore{
+		metadataFS: metadataFS,
+		targetsFS:  targetsFS,
+	}
+}
+
+// ReadMetadata reads "<roleName>.json" from metadataFS
+func (s *FSStore) ReadMetadata(roleName string) ([]byte, error) {
+	if s.metadataFS == nil {
+		return nil, fmt.Errorf("metadata %s: %w", roleName, fs.ErrNotExist)
+	}
+	return fs.ReadFile(s.metadataFS, metadataFileName(roleName))
+}
+
+// WriteMetadata fails with metadata.ErrReadOnly
+func (s *FSStore) WriteMetadata(roleName string, data []byte) error {
+	return metadata.ErrReadOnly{Msg: fmt.Sprintf("can not write metadata %s", roleName)}
+}
+
+// OpenTarget opens the target file at targetPath in targetsFS
+func (s *FSStore) OpenTarget(targetPath string) (io.ReadCloser, error) {
+	if s.targetsFS == nil {
+		return nil, fmt.Errorf("target %s: %w", targetPath, fs.ErrNotExist)
+	}
+	return s.targetsFS.Open(targetFileName(targetPath))
+}
+
+// WriteTarget fails with metadata.ErrReadOnly without reading r
+func (s *FSStore) WriteTarget(targetPath string, r io.Reader) error {
+	return metadata.ErrReadOnly{Msg: fmt.Sprintf("can not write target %s", targetPath)}
+}
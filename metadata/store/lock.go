@@ -0,0 +1,136 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPollInterval is the time between two attempts to lock a file
+// locked by another process
+const lockPollInterval = 50 * time.Millisecond
+
+// Locker is implemented by stores which can be shared between processes.
+// Locks are advisory file locks taken with LockFile. On platforms other
+// than Linux, the BSDs, macOS, illumos and Windows, files can not be
+// locked and locking is a no-op which always succeeds at once. On Windows,
+// files committed by CommitLockedFile, such as partial target downloads,
+// are briefly unlocked before they are renamed, see CommitLockedFile.
+type Locker interface {
+	// Lock waits until the store is locked for the exclusive use of the
+	// caller, or until ctx is done. The returned function releases it.
+	Lock(ctx context.Context) (unlock func() error, err error)
+}
+
+// LockFile opens the file name with the given flag and permissions and
+// waits until it holds an advisory lock on it, or until ctx is done. The
+// lock excludes other processes as well as other open files of the same
+// process, and is released by UnlockFile. If name was replaced or removed
+// while waiting for the lock, the new file at name is locked instead.
+func LockFile(ctx context.Context, name string, flag int, perm fs.FileMode) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		err = waitLock(ctx, file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		// make sure the locked file is still the one at name, as the
+		// previous owner of the lock may have renamed or removed it
+		locked, err := file.Stat()
+		if err != nil {
+			_ = UnlockFile(file)
+			return nil, err
+		}
+		current, err := os.Stat(name)
+		if err == nil && os.SameFile(locked, current) {
+			return file, nil
+		}
+		_ = UnlockFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// UnlockFile releases the lock taken by LockFile and closes file
+func UnlockFile(file *os.File) error {
+	err := unlockFile(file)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// CommitLockedFile is like CommitFile for a file locked by LockFile,
+// which is renamed to name before its lock is released wherever the
+// platform allows it. The file is closed in any case.
+//
+// Windows does not allow it: the lock is released first, so another
+// process waiting in LockFile for the same file may lock it right before
+// it is renamed, and then write to the file at name. Processes sharing
+// such files on Windows must not rely on the lock to exclude each other
+// at that point.
+func CommitLockedFile(file *os.File, name string, perm fs.FileMode) error {
+	tmpName := file.Name()
+	err := file.Sync()
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if err != nil || !renameOpenFiles {
+		// the file must be closed first, which leaves a short window for
+		// another process to lock it before it is renamed, and to keep
+		// writing to it once renamed
+		if errUnlock := UnlockFile(file); err == nil {
+			err = errUnlock
+		}
+		if err != nil {
+			return err
+		}
+		err = os.Rename(tmpName, name)
+	} else {
+		err = os.Rename(tmpName, name)
+		if errUnlock := UnlockFile(file); err == nil {
+			err = errUnlock
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// waitLock polls for the lock of file until it is granted or ctx is done
+func waitLock(ctx context.Context, file *os.File) error {
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to lock %s: %w", file.Name(), ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
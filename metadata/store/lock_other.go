@@ -0,0 +1,30 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !(darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd || windows)
+
+package store
+
+import "os"
+
+// renameOpenFiles reports whether locked files can be renamed
+const renameOpenFiles = true
+
+// tryLockFile always succeeds, as files can not be locked on this
+// platform, which makes locking a no-op
+func tryLockFile(file *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile does nothing, as files can not be locked on this platform
+func unlockFile(file *os.File) error {
+	return nil
+}
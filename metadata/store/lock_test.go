@@ -0,0 +1,77 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.partial")
+	file, err := LockFile(context.Background(), name, os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+
+	// the lock excludes other open files, even in the same process
+	ctx, cancel := context.WithTimeout(context.Background(), 2*lockPollInterval)
+	defer cancel()
+	_, err = LockFile(ctx, name, os.O_RDWR|os.O_CREATE, 0600)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the lock is granted as soon as it is released
+	locked := make(chan *os.File)
+	go func() {
+		other, err := LockFile(context.Background(), name, os.O_RDWR|os.O_CREATE, 0600)
+		assert.NoError(t, err)
+		locked <- other
+	}()
+	_, err = file.Write([]byte("content"))
+	assert.NoError(t, err)
+	// committing the file replaces it, so the waiting call locks a new file
+	assert.NoError(t, CommitLockedFile(file, filepath.Join(filepath.Dir(name), "file"), 0644))
+	select {
+	case other := <-locked:
+		info, err := other.Stat()
+		assert.NoError(t, err)
+		assert.Zero(t, info.Size())
+		assert.NoError(t, UnlockFile(other))
+	case <-time.After(10 * time.Second):
+		t.Fatal("lock not granted")
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(name), "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("content"), data)
+}
+
+func TestFileStoreLock(t *testing.T) {
+	metadataDir := t.TempDir()
+	s := NewFileStore(metadataDir, t.TempDir())
+	unlock, err := s.Lock(context.Background())
+	assert.NoError(t, err)
+
+	// another store sharing the directory waits for the lock
+	other := NewFileStore(metadataDir, t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*lockPollInterval)
+	defer cancel()
+	_, err = other.Lock(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, unlock())
+	unlock, err = other.Lock(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, unlock())
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// MemoryStore implements Store, keeping everything in memory. It is safe
+// for concurrent use.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	metadata map[string][]byte
+	targets  map[string][]byte
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		metadata: map[string][]byte{},
+		targets:  map[string][]byte{},
+	}
+}
+
+// ReadMetadata returns a copy of the metadata of roleName
+func (s *MemoryStore) ReadMetadata(roleName string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.metadata[roleName]
+	if !ok {
+		return nil, fmt.Errorf("metadata %s: %w", roleName, fs.ErrNotExist)
+	}
+	return bytes.Clone(data), nil
+}
+
+// WriteMetadata keeps a copy of data as the metadata of roleName
+func (s *MemoryStore) WriteMetadata(roleName string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metadata[roleName] = bytes.Clone(data)
+	return nil
+}
+
+// OpenTarget returns the content of the target file at targetPath
+func (s *MemoryStore) OpenTarget(targetPath string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.targets[targetPath]
+	if !ok {
+		return nil, fmt.Errorf("target %s: %w", targetPath, fs.ErrNotExist)
+	}
+	// the content is never modified in place, so it can be shared
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// WriteTarget keeps the content read from r as the target file at
+// targetPath once r is fully read
+func (s *MemoryStore) WriteTarget(targetPath string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[targetPath] = data
+	return nil
+}
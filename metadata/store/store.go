@@ -0,0 +1,56 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"io"
+	"net/url"
+)
+
+// Store keeps the local copies of the trusted metadata and of the target
+// files downloaded by the Updater. Nothing read from a Store is trusted
+// as is, the Updater verifies it just like anything downloaded.
+type Store interface {
+	// ReadMetadata returns the metadata of roleName. The error wraps
+	// fs.ErrNotExist if the store has none.
+	ReadMetadata(roleName string) ([]byte, error)
+	// WriteMetadata replaces the metadata of roleName with data
+	WriteMetadata(roleName string, data []byte) error
+	// OpenTarget returns the content of the target file at targetPath.
+	// The error wraps fs.ErrNotExist if the store has none.
+	OpenTarget(targetPath string) (io.ReadCloser, error)
+	// WriteTarget replaces the target file at targetPath with the content
+	// read from r. The target file is replaced only if reading r up to
+	// io.EOF succeeds, so r can fail the write by returning an error.
+	WriteTarget(targetPath string, r io.Reader) error
+}
+
+// PathStore is implemented by stores keeping target files on the local
+// file system, which lets the Updater resume interrupted downloads
+type PathStore interface {
+	Store
+	// TargetPath returns the path of the file holding the target file
+	// at targetPath
+	TargetPath(targetPath string) string
+}
+
+// metadataFileName returns the name of the file holding the metadata
+// of roleName
+func metadataFileName(roleName string) string {
+	return url.QueryEscape(roleName) + ".json"
+}
+
+// targetFileName returns the name of the file holding the target file at
+// targetPath, which is flat as directories in targetPath are escaped
+func targetFileName(targetPath string) string {
+	return url.QueryEscape(targetPath)
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+func TestWritableStores(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		newStore func(t *testing.T) Store
+	}{
+		{
+			name: "file store",
+			newStore: func(t *testing.T) Store {
+				return NewFileStore(t.TempDir(), t.TempDir())
+			},
+		},
+		{
+			name: "memory store",
+			newStore: func(t *testing.T) Store {
+				return NewMemoryStore()
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.newStore(t)
+
+			_, err := s.ReadMetadata("role1")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+			_, err = s.OpenTarget("dir/file.txt")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+
+			data := []byte("metadata")
+			assert.NoError(t, s.WriteMetadata("role1", data))
+			// the store keeps its own copy
+			data[0] = 'M'
+			read, err := s.ReadMetadata("role1")
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("metadata"), read)
+			assert.NoError(t, s.WriteMetadata("role1", []byte("new metadata")))
+			read, err = s.ReadMetadata("role1")
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("new metadata"), read)
+
+			assert.NoError(t, s.WriteTarget("dir/file.txt", bytes.NewReader([]byte("target"))))
+			assert.Equal(t, []byte("target"), readTarget(t, s, "dir/file.txt"))
+			// a failing reader leaves the previous target file untouched
+			err = s.WriteTarget("dir/file.txt", io.MultiReader(bytes.NewReader([]byte("partial")), iotest.ErrReader(errors.New("broken"))))
+			assert.ErrorContains(t, err, "broken")
+			assert.Equal(t, []byte("target"), readTarget(t, s, "dir/file.txt"))
+		})
+	}
+}
+
+func TestFileStoreLayout(t *testing.T) {
+	metadataDir, targetsDir := t.TempDir(), t.TempDir()
+	s := NewFileStore(metadataDir, targetsDir)
+
+	assert.NoError(t, s.WriteMetadata("delegated/role", []byte("metadata")))
+	data, err := os.ReadFile(filepath.Join(metadataDir, "delegated%2Frole.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("metadata"), data)
+
+	assert.Equal(t, filepath.Join(targetsDir, "dir%2Ffile.txt"), s.TargetPath("dir/file.txt"))
+	assert.NoError(t, s.WriteTarget("dir/file.txt", bytes.NewReader([]byte("target"))))
+	data, err = os.ReadFile(s.TargetPath("dir/file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("target"), data)
+
+	// no temporary file is left behind
+	for _, dir := range []string{metadataDir, targetsDir} {
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	}
+}
+
+func TestFSStore(t *testing.T) {
+	s := NewFSStore(fstest.MapFS{
+		"root.json":             {Data: []byte("root")},
+		"delegated%2Frole.json": {Data: []byte("delegated")},
+	}, fstest.MapFS{
+		"dir%2Ffile.txt": {Data: []byte("target")},
+	})
+
+	data, err := s.ReadMetadata("root")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("root"), data)
+	data, err = s.ReadMetadata("delegated/role")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("delegated"), data)
+	_, err = s.ReadMetadata("timestamp")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, []byte("target"), readTarget(t, s, "dir/file.txt"))
+	_, err = s.OpenTarget("missing.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.ErrorIs(t, s.WriteMetadata("root", []byte("new root")), metadata.ErrReadOnly{})
+	assert.ErrorIs(t, s.WriteTarget("dir/file.txt", bytes.NewReader(nil)), metadata.ErrReadOnly{})
+
+	// either file system can be omitted
+	s = NewFSStore(nil, nil)
+	_, err = s.ReadMetadata("root")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = s.OpenTarget("dir/file.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func readTarget(t *testing.T, s Store, targetPath string) []byte {
+	in, err := s.OpenTarget(targetPath)
+	assert.NoError(t, err)
+	if err != nil {
+		return nil
+	}
+	defer in.Close()
+	data, err := io.ReadAll(in)
+	assert.NoError(t, err)
+	return data
+}
@@ -13,18 +13,45 @@ package trustedmetadata
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
 )
 
-// TrustedMetadata struct for storing trusted metadata
+// TrustedMetadata struct for storing trusted metadata. It is not safe for
+// concurrent use, the Updater guards the sets it uses and replaces them as
+// a whole on refresh.
 type TrustedMetadata struct {
 	Root      *metadata.Metadata[metadata.RootType]
 	Snapshot  *metadata.Metadata[metadata.SnapshotType]
 	Timestamp *metadata.Metadata[metadata.TimestampType]
 	Targets   map[string]*metadata.Metadata[metadata.TargetsType]
 	RefTime   time.Time
+	// ExpiryPolicy, if set, decides whether expired metadata which is
+	// otherwise valid may still be trusted, for the roles KeepCached was
+	// called for
+	ExpiryPolicy ExpiryPolicy
+	// Degraded maps the roles whose cached metadata is trusted although
+	// it could not be updated, as allowed by KeepCached, to the time
+	// their metadata expires or expired
+	Degraded map[string]time.Time
+	// keepCached holds the roles KeepCached was called for
+	keepCached map[string]bool
+}
+
+// ExpiryPolicy decides whether the metadata of roleName, which expired at
+// expires, may still be trusted at refTime. It is only asked about cached
+// metadata passing every other check, which could not be updated.
+type ExpiryPolicy func(roleName string, expires, refTime time.Time) bool
+
+// GracePeriods returns an ExpiryPolicy trusting the metadata of the roles
+// in periods for the given duration after they expired
+func GracePeriods(periods map[string]time.Duration) ExpiryPolicy {
+	return func(roleName string, expires, refTime time.Time) bool {
+		period, ok := periods[roleName]
+		return ok && !refTime.After(expires.Add(period))
+	}
 }
 
 // New creates a new TrustedMetadata instance which ensures that the
@@ -54,7 +81,7 @@ func (trusted *TrustedMetadata) UpdateRoot(rootData []byte) (*metadata.Metadata[
 	if trusted.Timestamp != nil {
 		return nil, metadata.ErrRuntime{Msg: "cannot update root after timestamp"}
 	}
-	log.Info("Updating root")
+	log.Debug("Updating root", "role", metadata.ROOT)
 	// generate root metadata
 	newRoot, err := metadata.Root().FromBytes(rootData)
 	if err != nil {
@@ -71,7 +98,12 @@ func (trusted *TrustedMetadata) UpdateRoot(rootData []byte) (*metadata.Metadata[
 	}
 	// verify version
 	if newRoot.Signed.Version != trusted.Root.Signed.Version+1 {
-		return nil, metadata.ErrBadVersionNumber{Msg: fmt.Sprintf("bad version number, expected %d, got %d", trusted.Root.Signed.Version+1, newRoot.Signed.Version)}
+		return nil, metadata.ErrBadVersionNumber{
+			Msg:      fmt.Sprintf("bad version number, expected %d, got %d", trusted.Root.Signed.Version+1, newRoot.Signed.Version),
+			Role:     metadata.ROOT,
+			Expected: trusted.Root.Signed.Version + 1,
+			Actual:   newRoot.Signed.Version,
+		}
 	}
 	// verify that new root is signed by itself
 	err = newRoot.VerifyDelegate(metadata.ROOT, newRoot)
@@ -80,7 +112,7 @@ func (trusted *TrustedMetadata) UpdateRoot(rootData []byte) (*metadata.Metadata[
 	}
 	// save root if verified
 	trusted.Root = newRoot
-	log.Info("Updated root", "version", trusted.Root.Signed.Version)
+	log.Info("Updated root", "role", metadata.ROOT, "version", trusted.Root.Signed.Version)
 	return trusted.Root, nil
 }
 
@@ -97,12 +129,13 @@ func (trusted *TrustedMetadata) UpdateTimestamp(timestampData []byte) (*metadata
 		return nil, metadata.ErrRuntime{Msg: "cannot update timestamp after snapshot"}
 	}
 	// client workflow 5.3.10: Make sure final root is not expired.
-	if trusted.Root.Signed.IsExpired(trusted.RefTime) {
-		// no need to check for 5.3.11 (fast forward attack recovery):
-		// timestamp/snapshot can not yet be loaded at this point
-		return nil, metadata.ErrExpiredMetadata{Msg: "final root.json is expired"}
+	// no need to check for 5.3.11 (fast forward attack recovery):
+	// timestamp/snapshot can not yet be loaded at this point
+	err := trusted.checkExpiry(metadata.ROOT, trusted.Root.Signed.Expires, "final root.json is expired")
+	if err != nil {
+		return nil, err
 	}
-	log.Info("Updating timestamp")
+	log.Debug("Updating timestamp", "role", metadata.TIMESTAMP)
 	newTimestamp, err := metadata.Timestamp().FromBytes(timestampData)
 	if err != nil {
 		return nil, err
@@ -121,25 +154,40 @@ func (trusted *TrustedMetadata) UpdateTimestamp(timestampData []byte) (*metadata
 	if trusted.Timestamp != nil {
 		// prevent rolling back timestamp version
 		if newTimestamp.Signed.Version < trusted.Timestamp.Signed.Version {
-			return nil, metadata.ErrBadVersionNumber{Msg: fmt.Sprintf("new timestamp version %d must be >= %d", newTimestamp.Signed.Version, trusted.Timestamp.Signed.Version)}
+			return nil, metadata.ErrBadVersionNumber{
+				Msg:      fmt.Sprintf("new timestamp version %d must be >= %d", newTimestamp.Signed.Version, trusted.Timestamp.Signed.Version),
+				Role:     metadata.TIMESTAMP,
+				Expected: trusted.Timestamp.Signed.Version,
+				Actual:   newTimestamp.Signed.Version,
+			}
 		}
 		// keep using old timestamp if versions are equal
 		if newTimestamp.Signed.Version == trusted.Timestamp.Signed.Version {
-			log.Info("New timestamp version equals the old one", "new", newTimestamp.Signed.Version, "old", trusted.Timestamp.Signed.Version)
-			return nil, metadata.ErrEqualVersionNumber{Msg: fmt.Sprintf("new timestamp version %d equals the old one %d", newTimestamp.Signed.Version, trusted.Timestamp.Signed.Version)}
+			log.Debug("New timestamp version equals the old one", "version", newTimestamp.Signed.Version)
+			return nil, metadata.ErrEqualVersionNumber{
+				Msg:      fmt.Sprintf("new timestamp version %d equals the old one %d", newTimestamp.Signed.Version, trusted.Timestamp.Signed.Version),
+				Role:     metadata.TIMESTAMP,
+				Expected: trusted.Timestamp.Signed.Version + 1,
+				Actual:   newTimestamp.Signed.Version,
+			}
 		}
 		// prevent rolling back snapshot version
 		snapshotMeta := trusted.Timestamp.Signed.Meta[fmt.Sprintf("%s.json", metadata.SNAPSHOT)]
 		newSnapshotMeta := newTimestamp.Signed.Meta[fmt.Sprintf("%s.json", metadata.SNAPSHOT)]
 		if newSnapshotMeta.Version < snapshotMeta.Version {
-			return nil, metadata.ErrBadVersionNumber{Msg: fmt.Sprintf("new snapshot version %d must be >= %d", newSnapshotMeta.Version, snapshotMeta.Version)}
+			return nil, metadata.ErrBadVersionNumber{
+				Msg:      fmt.Sprintf("new snapshot version %d must be >= %d", newSnapshotMeta.Version, snapshotMeta.Version),
+				Role:     metadata.SNAPSHOT,
+				Expected: snapshotMeta.Version,
+				Actual:   newSnapshotMeta.Version,
+			}
 		}
 	}
 	// expiry not checked to allow old timestamp to be used for rollback
 	// protection of new timestamp: expiry is checked in UpdateSnapshot()
 	// save root if verified
 	trusted.Timestamp = newTimestamp
-	log.Info("Updated timestamp", "version", trusted.Timestamp.Signed.Version)
+	log.Info("Updated timestamp", "role", metadata.TIMESTAMP, "version", trusted.Timestamp.Signed.Version)
 
 	// timestamp is loaded: error if it is not valid _final_ timestamp
 	err = trusted.checkFinalTimestamp()
@@ -152,10 +200,7 @@ func (trusted *TrustedMetadata) UpdateTimestamp(timestampData []byte) (*metadata
 
 // checkFinalTimestamp verifies if trusted timestamp is not expired
 func (trusted *TrustedMetadata) checkFinalTimestamp() error {
-	if trusted.Timestamp.Signed.IsExpired(trusted.RefTime) {
-		return metadata.ErrExpiredMetadata{Msg: "timestamp.json is expired"}
-	}
-	return nil
+	return trusted.checkExpiry(metadata.TIMESTAMP, trusted.Timestamp.Signed.Expires, "timestamp.json is expired")
 }
 
 // UpdateSnapshot verifies and loads “snapshotData“ as new snapshot metadata.
@@ -175,7 +220,7 @@ func (trusted *TrustedMetadata) UpdateSnapshot(snapshotData []byte, isTrusted bo
 	if trusted.Targets[metadata.TARGETS] != nil {
 		return nil, metadata.ErrRuntime{Msg: "cannot update snapshot after targets"}
 	}
-	log.Info("Updating snapshot")
+	log.Debug("Updating snapshot", "role", metadata.SNAPSHOT)
 
 	// snapshot cannot be loaded if final timestamp is expired
 	err := trusted.checkFinalTimestamp()
@@ -218,7 +263,12 @@ func (trusted *TrustedMetadata) UpdateSnapshot(snapshotData []byte, isTrusted bo
 			}
 			// prevent rollback of any metadata versions
 			if newFileInfo.Version < info.Version {
-				return nil, metadata.ErrBadVersionNumber{Msg: fmt.Sprintf("expected %s version %d, got %d", name, newFileInfo.Version, info.Version)}
+				return nil, metadata.ErrBadVersionNumber{
+					Msg:      fmt.Sprintf("expected %s version %d, got %d", name, newFileInfo.Version, info.Version),
+					Role:     strings.TrimSuffix(name, ".json"),
+					Expected: info.Version,
+					Actual:   newFileInfo.Version,
+				}
 			}
 		}
 	}
@@ -226,7 +276,7 @@ func (trusted *TrustedMetadata) UpdateSnapshot(snapshotData []byte, isTrusted bo
 	// expiry not checked to allow old snapshot to be used for rollback
 	// protection of new snapshot: it is checked when targets is updated
 	trusted.Snapshot = newSnapshot
-	log.Info("Updated snapshot", "version", trusted.Snapshot.Signed.Version)
+	log.Info("Updated snapshot", "role", metadata.SNAPSHOT, "version", trusted.Snapshot.Signed.Version)
 
 	// snapshot is loaded, but we error if it's not valid _final_ snapshot
 	err = trusted.checkFinalSnapshot()
@@ -239,12 +289,18 @@ func (trusted *TrustedMetadata) UpdateSnapshot(snapshotData []byte, isTrusted bo
 
 // checkFinalSnapshot verifies if it's not expired and snapshot version matches timestamp meta version
 func (trusted *TrustedMetadata) checkFinalSnapshot() error {
-	if trusted.Snapshot.Signed.IsExpired(trusted.RefTime) {
-		return metadata.ErrExpiredMetadata{Msg: "snapshot.json is expired"}
+	err := trusted.checkExpiry(metadata.SNAPSHOT, trusted.Snapshot.Signed.Expires, "snapshot.json is expired")
+	if err != nil {
+		return err
 	}
 	snapshotMeta := trusted.Timestamp.Signed.Meta[fmt.Sprintf("%s.json", metadata.SNAPSHOT)]
 	if trusted.Snapshot.Signed.Version != snapshotMeta.Version {
-		return metadata.ErrBadVersionNumber{Msg: fmt.Sprintf("expected %d, got %d", snapshotMeta.Version, trusted.Snapshot.Signed.Version)}
+		return metadata.ErrBadVersionNumber{
+			Msg:      fmt.Sprintf("expected %d, got %d", snapshotMeta.Version, trusted.Snapshot.Signed.Version),
+			Role:     metadata.SNAPSHOT,
+			Expected: snapshotMeta.Version,
+			Actual:   trusted.Snapshot.Signed.Version,
+		}
 	}
 	return nil
 }
@@ -281,7 +337,7 @@ func (trusted *TrustedMetadata) UpdateDelegatedTargets(targetsData []byte, roleN
 	if !ok {
 		return nil, metadata.ErrRuntime{Msg: "cannot load targets before delegator"}
 	}
-	log.Info("Updating delegated role", "role", roleName, "delegator", delegatorName)
+	log.Debug("Updating delegated role", "role", roleName, "delegator", delegatorName)
 	// Verify against the hashes in snapshot, if any
 	meta, ok := trusted.Snapshot.Signed.Meta[fmt.Sprintf("%s.json", roleName)]
 	if !ok {
@@ -313,17 +369,74 @@ func (trusted *TrustedMetadata) UpdateDelegatedTargets(targetsData []byte, roleN
 	}
 	// check versions
 	if newDelegate.Signed.Version != meta.Version {
-		return nil, metadata.ErrBadVersionNumber{Msg: fmt.Sprintf("expected %s version %d, got %d", roleName, meta.Version, newDelegate.Signed.Version)}
+		return nil, metadata.ErrBadVersionNumber{
+			Msg:      fmt.Sprintf("expected %s version %d, got %d", roleName, meta.Version, newDelegate.Signed.Version),
+			Role:     roleName,
+			Expected: meta.Version,
+			Actual:   newDelegate.Signed.Version,
+		}
 	}
 	// check expiration
-	if newDelegate.Signed.IsExpired(trusted.RefTime) {
-		return nil, metadata.ErrExpiredMetadata{Msg: fmt.Sprintf("new %s is expired", roleName)}
+	err = trusted.checkExpiry(roleName, newDelegate.Signed.Expires, fmt.Sprintf("new %s is expired", roleName))
+	if err != nil {
+		return nil, err
 	}
 	trusted.Targets[roleName] = newDelegate
 	log.Info("Updated role", "role", roleName, "version", trusted.Targets[roleName].Signed.Version)
 	return trusted.Targets[roleName], nil
 }
 
+// KeepCached marks the metadata of roleName as kept from the cache because
+// it could not be updated, which reports it in Degraded and lets
+// ExpiryPolicy trust it once expired. The caller must never mark freshly
+// downloaded metadata. The expiry of the root, timestamp or snapshot
+// metadata already loaded is checked again, targets metadata has to be
+// loaded again.
+func (trusted *TrustedMetadata) KeepCached(roleName string) error {
+	if trusted.keepCached == nil {
+		trusted.keepCached = map[string]bool{}
+	}
+	trusted.keepCached[roleName] = true
+	switch {
+	case roleName == metadata.ROOT:
+		return trusted.checkExpiry(metadata.ROOT, trusted.Root.Signed.Expires, "final root.json is expired")
+	case roleName == metadata.TIMESTAMP && trusted.Timestamp != nil:
+		return trusted.checkFinalTimestamp()
+	case roleName == metadata.SNAPSHOT && trusted.Snapshot != nil:
+		return trusted.checkFinalSnapshot()
+	}
+	return nil
+}
+
+// checkExpiry fails with an ErrExpiredMetadata holding msg if the metadata
+// of roleName expired before RefTime, unless ExpiryPolicy trusts it anyway
+// as allowed by KeepCached. Degraded tells which roles are kept from the
+// cache.
+func (trusted *TrustedMetadata) checkExpiry(roleName string, expires time.Time, msg string) error {
+	log := metadata.GetLogger()
+
+	expired := trusted.RefTime.After(expires)
+	if !trusted.keepCached[roleName] {
+		if expired {
+			return metadata.ErrExpiredMetadata{Msg: msg, Role: roleName, Expires: expires}
+		}
+		delete(trusted.Degraded, roleName)
+		return nil
+	}
+	if expired {
+		err := metadata.ErrExpiredMetadata{Msg: msg, Role: roleName, Expires: expires}
+		if trusted.ExpiryPolicy == nil || !trusted.ExpiryPolicy(roleName, expires, trusted.RefTime) {
+			return err
+		}
+		log.Error(err, "Trusting expired metadata as allowed by the expiry policy, trust is degraded", "role", roleName, "expires", expires)
+	}
+	if trusted.Degraded == nil {
+		trusted.Degraded = map[string]time.Time{}
+	}
+	trusted.Degraded[roleName] = expires
+	return nil
+}
+
 // loadTrustedRoot verifies and loads "data" as trusted root metadata.
 // Note that an expired initial root is considered valid: expiry is
 // only checked for the final root in “UpdateTimestamp()“.
@@ -346,6 +459,6 @@ func (trusted *TrustedMetadata) loadTrustedRoot(rootData []byte) error {
 	}
 	// save root if verified
 	trusted.Root = newRoot
-	log.Info("Loaded trusted root", "version", trusted.Root.Signed.Version)
+	log.Info("Loaded trusted root", "role", metadata.ROOT, "version", trusted.Root.Signed.Version)
 	return nil
 }
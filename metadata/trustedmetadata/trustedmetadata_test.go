@@ -688,3 +688,49 @@ func TestUpdateTargetsExpiredMewTarget(t *testing.T) {
 	_, err = trustedSet.UpdateTargets(targets)
 	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{Msg: "new targets is expired"})
 }
+
+func TestExpiryPolicy(t *testing.T) {
+	expires := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	modifyTimestampExpiry := func(timestamp *metadata.Metadata[metadata.TimestampType]) {
+		timestamp.Signed.Expires = expires
+	}
+	timestamp, err := modifyTimestamptMetadata(modifyTimestampExpiry)
+	assert.NoError(t, err)
+
+	// freshly loaded metadata is never trusted once expired
+	trustedSet, err := New(allRoles[metadata.ROOT])
+	assert.NoError(t, err)
+	trustedSet.ExpiryPolicy = GracePeriods(map[string]time.Duration{metadata.TIMESTAMP: 24 * time.Hour})
+	trustedSet.RefTime = expires.Add(12 * time.Hour)
+	_, err = trustedSet.UpdateTimestamp(timestamp)
+	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{Msg: "timestamp.json is expired"})
+	assert.Empty(t, trustedSet.Degraded)
+
+	// kept metadata is trusted within its grace period only
+	err = trustedSet.KeepCached(metadata.TIMESTAMP)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{metadata.TIMESTAMP: expires}, trustedSet.Degraded)
+	_, err = trustedSet.UpdateSnapshot(allRoles[metadata.SNAPSHOT], false)
+	assert.NoError(t, err)
+
+	trustedSet, err = New(allRoles[metadata.ROOT])
+	assert.NoError(t, err)
+	trustedSet.ExpiryPolicy = GracePeriods(map[string]time.Duration{metadata.TIMESTAMP: 24 * time.Hour})
+	trustedSet.RefTime = expires.Add(36 * time.Hour)
+	_, err = trustedSet.UpdateTimestamp(timestamp)
+	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{Msg: "timestamp.json is expired"})
+	err = trustedSet.KeepCached(metadata.TIMESTAMP)
+	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{Msg: "timestamp.json is expired"})
+	assert.Empty(t, trustedSet.Degraded)
+
+	// cached metadata which is not expired is reported as kept as well
+	trustedSet, err = New(allRoles[metadata.ROOT])
+	assert.NoError(t, err)
+	trustedSet.ExpiryPolicy = GracePeriods(map[string]time.Duration{})
+	cached, err := trustedSet.UpdateTimestamp(allRoles[metadata.TIMESTAMP])
+	assert.NoError(t, err)
+	assert.Empty(t, trustedSet.Degraded)
+	err = trustedSet.KeepCached(metadata.TIMESTAMP)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{metadata.TIMESTAMP: cached.Signed.Expires}, trustedSet.Degraded)
+}
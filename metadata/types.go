@@ -156,6 +156,13 @@ type DelegatedRole struct {
 	UnrecognizedFields map[string]any `json:"-"`
 }
 
+// RoleResult names a delegated role responsible for a target path and
+// tells whether the delegation to it is terminating
+type RoleResult struct {
+	Name        string
+	Terminating bool
+}
+
 // SuccinctRoles represents a delegation graph that covers all targets,
 // distributing them uniformly over the delegated roles (i.e. bins) in the graph.
 type SuccinctRoles struct {
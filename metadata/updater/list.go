@@ -0,0 +1,260 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
+)
+
+// globChars are the characters turning a pattern of ListTargets into a
+// glob pattern
+const globChars = "*?[\\"
+
+// ListedTarget is a target file found by ListTargets
+type ListedTarget struct {
+	// Role is the name of the role whose metadata lists the target file
+	Role string
+	// TargetFile is the information about the target file, as returned
+	// by GetTargetInfo
+	TargetFile *metadata.TargetFiles
+}
+
+// ListTargets returns the target files whose path matches pattern, sorted
+// by path. A pattern holding any of the characters "*?[\" is a glob
+// pattern matching paths just like the paths of a delegated role do, i.e.
+// "*" does not match "/". Any other pattern is a prefix, with the empty
+// pattern listing every target file.
+//
+// Every delegated role which may hold matching target files is loaded,
+// including each bin of succinct hash bin delegations, within the limit
+// of MaxDelegations roles from the configuration. ListTargets fails with
+// ErrTooManyDelegations rather than return an incomplete list if more roles
+// are left to visit. A target file is listed with the role GetTargetInfo
+// would find it in, so the target files of roles which are not reached
+// because of terminating delegations are left out. As a side-effect the
+// metadata of these roles is downloaded as needed. ListTargets fails if
+// the custom metadata of a listed target file does not validate, as
+// GetTargetInfo does.
+func (update *Updater) ListTargets(pattern string) ([]ListedTarget, error) {
+	return update.ListTargetsContext(context.Background(), pattern)
+}
+
+// ListTargetsContext is like ListTargets but aborts the implicit refresh
+// and the loading of delegated metadata as soon as ctx is done.
+func (update *Updater) ListTargetsContext(ctx context.Context, pattern string) ([]ListedTarget, error) {
+	// do a Refresh() in case there's no trusted targets.json yet
+	if update.trustedTargets(update.trustedSet(), metadata.TARGETS) == nil {
+		err := update.refreshOnce(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	trusted := update.trustedSet()
+	paths, loaded, err := update.collectTargetPaths(ctx, trusted, newTargetPattern(pattern))
+	if err != nil {
+		return nil, err
+	}
+	// a target file may be listed by several roles, keep the one found by
+	// the same walk as GetTargetInfo
+	listed := []ListedTarget{}
+	for _, targetPath := range paths {
+		role, target := update.findLoadedTarget(loaded, targetPath)
+		if target == nil {
+			continue
+		}
+		err = update.validateCustom(target, role)
+		if err != nil {
+			return nil, err
+		}
+		listed = append(listed, ListedTarget{Role: role, TargetFile: target})
+	}
+	return listed, nil
+}
+
+// collectTargetPaths walks the roles which may hold target files matching
+// pattern and returns the sorted paths of the matching target files they
+// list, along with the metadata of the roles it loaded
+func (update *Updater) collectTargetPaths(ctx context.Context, trusted *trustedmetadata.TrustedMetadata, pattern targetPattern) ([]string, map[string]*metadata.Metadata[metadata.TargetsType], error) {
+	delegationsToVisit := []roleParentTuple{{
+		Role:   metadata.TARGETS,
+		Parent: metadata.ROOT,
+	}}
+	loaded := map[string]*metadata.Metadata[metadata.TargetsType]{}
+	var prefetcher *metadataPrefetcher
+	if update.cfg.PrefetchDelegations {
+		prefetcher = update.newMetadataPrefetcher(ctx, trusted)
+		defer prefetcher.close()
+	}
+	cacheLock := &lazyCacheLock{update: update}
+	defer cacheLock.release()
+	found := map[string]bool{}
+	// pre-order depth-first traversal, as in preOrderDepthFirstWalk
+	for len(loaded) <= update.cfg.MaxDelegations && len(delegationsToVisit) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		delegation := delegationsToVisit[len(delegationsToVisit)-1]
+		delegationsToVisit = delegationsToVisit[:len(delegationsToVisit)-1]
+		if loaded[delegation.Role] != nil {
+			continue
+		}
+		targets, err := update.loadTargetsLocked(ctx, trusted, delegation, prefetcher, cacheLock)
+		if err != nil {
+			return nil, nil, err
+		}
+		for targetPath := range targets.Signed.Targets {
+			if pattern.match(targetPath) {
+				found[targetPath] = true
+			}
+		}
+		loaded[delegation.Role] = targets
+		if targets.Signed.Delegations == nil {
+			continue
+		}
+		childRolesToVisit := []roleParentTuple{}
+		if targets.Signed.Delegations.Roles != nil {
+			for _, child := range targets.Signed.Delegations.Roles {
+				if pattern.mayDelegate(child) {
+					childRolesToVisit = append(childRolesToVisit, roleParentTuple{Role: child.Name, Parent: delegation.Role})
+				}
+			}
+		} else if targets.Signed.Delegations.SuccinctRoles != nil {
+			// the bin of a target file depends on the hash of its path,
+			// any bin may hold matching target files
+			for _, child := range targets.Signed.Delegations.SuccinctRoles.GetRoles() {
+				childRolesToVisit = append(childRolesToVisit, roleParentTuple{Role: child, Parent: delegation.Role})
+			}
+		}
+		for _, child := range childRolesToVisit {
+			if loaded[child.Role] == nil {
+				prefetcher.prefetch(child.Role)
+			}
+		}
+		reverseSlice(childRolesToVisit)
+		delegationsToVisit = append(delegationsToVisit, childRolesToVisit...)
+	}
+	// the list would miss the target files of the roles left to visit
+	left := map[string]bool{}
+	for _, delegation := range delegationsToVisit {
+		if loaded[delegation.Role] == nil {
+			left[delegation.Role] = true
+		}
+	}
+	if len(left) > 0 {
+		return nil, nil, metadata.ErrTooManyDelegations{Max: update.cfg.MaxDelegations, Left: len(left)}
+	}
+	paths := make([]string, 0, len(found))
+	for targetPath := range found {
+		paths = append(paths, targetPath)
+	}
+	sort.Strings(paths)
+	return paths, loaded, nil
+}
+
+// findLoadedTarget returns the role GetTargetInfo finds targetPath in and
+// its target file, or a nil target file if it is not found. It walks the
+// roles in loaded the way preOrderDepthFirstWalk does, without loading
+// any metadata.
+func (update *Updater) findLoadedTarget(loaded map[string]*metadata.Metadata[metadata.TargetsType], targetPath string) (string, *metadata.TargetFiles) {
+	rolesToVisit := []string{metadata.TARGETS}
+	visitedRoleNames := map[string]bool{}
+	for len(visitedRoleNames) <= update.cfg.MaxDelegations && len(rolesToVisit) > 0 {
+		role := rolesToVisit[len(rolesToVisit)-1]
+		rolesToVisit = rolesToVisit[:len(rolesToVisit)-1]
+		targets := loaded[role]
+		if visitedRoleNames[role] || targets == nil {
+			continue
+		}
+		target, ok := targets.Signed.Targets[targetPath]
+		if ok {
+			return role, target
+		}
+		visitedRoleNames[role] = true
+		if targets.Signed.Delegations == nil {
+			continue
+		}
+		childRolesToVisit := []string{}
+		for _, child := range targets.Signed.Delegations.GetOrderedRolesForTarget(targetPath) {
+			childRolesToVisit = append(childRolesToVisit, child.Name)
+			if child.Terminating {
+				rolesToVisit = []string{}
+				break
+			}
+		}
+		reverseSlice(childRolesToVisit)
+		rolesToVisit = append(rolesToVisit, childRolesToVisit...)
+	}
+	return "", nil
+}
+
+// targetPattern is a pattern of ListTargets
+type targetPattern struct {
+	pattern string
+	glob    bool
+}
+
+// newTargetPattern parses a pattern of ListTargets
+func newTargetPattern(pattern string) targetPattern {
+	return targetPattern{
+		pattern: pattern,
+		glob:    strings.ContainsAny(pattern, globChars),
+	}
+}
+
+// match reports whether targetPath matches the pattern
+func (p targetPattern) match(targetPath string) bool {
+	if !p.glob {
+		return strings.HasPrefix(targetPath, p.pattern)
+	}
+	// match the way the paths of delegated roles do
+	role := metadata.DelegatedRole{Paths: []string{p.pattern}}
+	ok, err := role.IsDelegatedPath(targetPath)
+	return err == nil && ok
+}
+
+// mayDelegate reports whether role may be trusted for target paths
+// matching the pattern. It errs on the side of visiting role.
+func (p targetPattern) mayDelegate(role metadata.DelegatedRole) bool {
+	if len(role.Paths) == 0 {
+		// hash prefixes tell nothing about the paths
+		return true
+	}
+	patternLiteral := literalPrefix(p.pattern)
+	patternSegments := strings.Count(p.pattern, "/") + 1
+	for _, rolePath := range role.Paths {
+		roleLiteral := literalPrefix(rolePath)
+		if !strings.HasPrefix(roleLiteral, patternLiteral) && !strings.HasPrefix(patternLiteral, roleLiteral) {
+			continue
+		}
+		// a path matches a glob pattern only if they have as many
+		// segments, and has at least as many segments as a prefix
+		roleSegments := strings.Count(rolePath, "/") + 1
+		if roleSegments == patternSegments || (!p.glob && roleSegments > patternSegments) {
+			return true
+		}
+	}
+	return false
+}
+
+// literalPrefix returns the part of a pattern before its first glob
+// character
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, globChars); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// mirrorSet is an ordered list of base URLs serving the same files.
+// It keeps track of how each of them performed, in order to try the
+// fastest ones first if preferFastest is set.
+type mirrorSet struct {
+	mu            sync.Mutex
+	urls          []string
+	preferFastest bool
+	stats         map[string]*mirrorStats
+}
+
+// mirrorStats describes how a mirror performed so far
+type mirrorStats struct {
+	// latency is a moving average of the successful attempts
+	latency time.Duration
+	// failures counts the attempts failed since the last successful one
+	failures int
+}
+
+// newMirrorSet creates a mirror set out of the non-empty urls
+func newMirrorSet(preferFastest bool, urls ...string) *mirrorSet {
+	mirrors := &mirrorSet{
+		preferFastest: preferFastest,
+		stats:         map[string]*mirrorStats{},
+	}
+	for _, u := range urls {
+		if u != "" {
+			mirrors.urls = append(mirrors.urls, u)
+			mirrors.stats[u] = &mirrorStats{}
+		}
+	}
+	return mirrors
+}
+
+// ordered returns the mirrors in the order they should be tried. Unless
+// the fastest mirrors are preferred, this is the configured order.
+// Otherwise mirrors which failed last time come last, and the others are
+// sorted by latency. Mirrors not tried yet come first so that they get
+// their latency measured.
+func (m *mirrorSet) ordered() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	urls := append([]string{}, m.urls...)
+	if m.preferFastest {
+		sort.SliceStable(urls, func(i, j int) bool {
+			a, b := m.stats[urls[i]], m.stats[urls[j]]
+			if (a.failures > 0) != (b.failures > 0) {
+				return b.failures > 0
+			}
+			return a.latency < b.latency
+		})
+	}
+	return urls
+}
+
+// observe records the outcome of an attempt made against a mirror
+func (m *mirrorSet) observe(url string, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats, ok := m.stats[url]
+	if !ok {
+		return
+	}
+	if err != nil {
+		stats.failures++
+		return
+	}
+	stats.failures = 0
+	if stats.latency == 0 {
+		stats.latency = elapsed
+	} else {
+		stats.latency = (7*stats.latency + 3*elapsed) / 10
+	}
+}
+
+// errNoFailover stops tryMirrors from trying the next mirror, when the
+// wrapped error can not be recovered from by downloading again
+type errNoFailover struct {
+	err error
+}
+
+func (e errNoFailover) Error() string {
+	return e.err.Error()
+}
+
+func (e errNoFailover) Unwrap() error {
+	return e.err
+}
+
+// tryMirrors calls attempt with the URL of fileName on each mirror in turn
+// until it succeeds. If all of them fail, the errors of all attempts are
+// returned joined, or as is if there is a single mirror.
+func (update *Updater) tryMirrors(ctx context.Context, mirrors *mirrorSet, fileName string, attempt func(fullURL string) error) error {
+	log := metadata.GetLogger()
+
+	urls := mirrors.ordered()
+	errs := make([]error, 0, len(urls))
+	for _, baseURL := range urls {
+		start := time.Now()
+		err := attempt(ensureTrailingSlash(baseURL) + fileName)
+		mirrors.observe(baseURL, time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+		var errStop errNoFailover
+		if errors.As(err, &errStop) {
+			return errStop.err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if len(urls) > 1 {
+			log.Info("Failed to use mirror", "url", baseURL, "path", fileName, "error", err.Error())
+		}
+		errs = append(errs, err)
+	}
+	switch len(errs) {
+	case 0:
+		return metadata.ErrValue{Msg: "no mirror configured to download " + fileName}
+	case 1:
+		return errs[0]
+	default:
+		return errors.Join(errs...)
+	}
+}
+
+// anyNotFound reports whether err, or any of the errors joined in it,
+// is a 404 or 403 HTTP error
+func anyNotFound(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if anyNotFound(e) {
+				return true
+			}
+		}
+		return false
+	}
+	var errHTTP metadata.ErrDownloadHTTP
+	return errors.As(err, &errHTTP) && (errHTTP.StatusCode == http.StatusNotFound || errHTTP.StatusCode == http.StatusForbidden)
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/fetcher"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/store"
+)
+
+// NewOffline verifies a bundle of metadata without network access and
+// returns an Updater trusting it. The bundle holds the metadata files in
+// a "metadata" directory and the target files, if any, in a "targets"
+// directory, as served by a repository (see the bundle package).
+//
+// Unlike UnsafeLocalMode, the whole client workflow is run against the
+// bundle, from the root chain starting at trustedRoot down to the
+// top-level targets metadata, checking the expiry of the metadata against
+// refTime instead of the current time. The metadata of delegated roles is
+// verified by GetTargetInfo and the target files by DownloadTarget, with
+// an empty targetBaseURL. Nothing is cached.
+func NewOffline(trustedRoot []byte, bundle fs.FS, refTime time.Time) (*Updater, error) {
+	cfg, err := config.New("metadata", trustedRoot)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Fetcher = fetcher.NewFSFetcher(bundle)
+	cfg.RemoteTargetsURL = "targets"
+	cfg.Store = store.NewMemoryStore()
+	cfg.DisableLocalCache = true
+	cfg.Clock = config.FixedClock(refTime)
+	update, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = update.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	return update, nil
+}
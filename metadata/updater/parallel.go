@@ -0,0 +1,194 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
+)
+
+// DownloadTargets downloads the target files specified by targetFiles to
+// LocalTargetsDir, or to the configured store, the same way DownloadTarget
+// does, running up to MaxConcurrentDownloads downloads at the same time. It
+// returns the paths of the downloaded target files in the order of
+// targetFiles. If some of the downloads failed, their path is empty and
+// their errors are returned joined together.
+func (update *Updater) DownloadTargets(targetFiles []*metadata.TargetFiles, targetBaseURL string) ([]string, error) {
+	return update.DownloadTargetsContext(context.Background(), targetFiles, targetBaseURL)
+}
+
+// DownloadTargetsContext is like DownloadTargets but aborts the downloads
+// as soon as ctx is done.
+func (update *Updater) DownloadTargetsContext(ctx context.Context, targetFiles []*metadata.TargetFiles, targetBaseURL string) ([]string, error) {
+	paths := make([]string, len(targetFiles))
+	errs := make([]error, len(targetFiles))
+	// a target file listed more than once is downloaded only once, as
+	// concurrent downloads would share the same partial file
+	first := map[string]int{}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(update.cfg.MaxConcurrentDownloads, 1), len(targetFiles)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				paths[i], errs[i] = update.downloadTargetToStore(ctx, targetFiles[i], targetBaseURL)
+				if errs[i] != nil {
+					errs[i] = fmt.Errorf("failed to download target %s: %w", targetFiles[i].Path, errs[i])
+				}
+			}
+		}()
+	}
+	for i, targetFile := range targetFiles {
+		if _, ok := first[targetFile.Path]; !ok {
+			first[targetFile.Path] = i
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	for i, targetFile := range targetFiles {
+		if j := first[targetFile.Path]; j != i {
+			paths[i] = paths[j]
+		}
+	}
+	return paths, errors.Join(errs...)
+}
+
+// downloadTargetToStore downloads targetFile to LocalTargetsDir or to the
+// configured store. The returned path is empty if the store does not keep
+// target files on disk.
+func (update *Updater) downloadTargetToStore(ctx context.Context, targetFile *metadata.TargetFiles, targetBaseURL string) (string, error) {
+	filePath, err := update.generateTargetFilePath(targetFile)
+	if err != nil {
+		return "", err
+	}
+	if filePath == "" {
+		_, _, err = update.DownloadTargetContext(ctx, targetFile, "", targetBaseURL)
+		return "", err
+	}
+	return update.DownloadTargetToFileContext(ctx, targetFile, filePath, targetBaseURL)
+}
+
+// metadataPrefetcher downloads the metadata of delegated roles before the
+// walk of the delegations gets to them. The downloaded metadata is not
+// trusted in any way, it is only verified once the walk reaches its role.
+// A nil metadataPrefetcher prefetches nothing.
+type metadataPrefetcher struct {
+	update  *Updater
+	trusted *trustedmetadata.TrustedMetadata
+	ctx     context.Context
+	cancel  context.CancelFunc
+	slots   chan struct{}
+	wg      sync.WaitGroup
+	results map[string]*prefetchResult
+}
+
+// prefetchResult is the outcome of downloading the metadata of a role,
+// available once done is closed
+type prefetchResult struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// newMetadataPrefetcher creates a prefetcher for the delegated roles of
+// the trusted metadata set, running up to MaxConcurrentDownloads downloads
+// at the same time
+func (update *Updater) newMetadataPrefetcher(ctx context.Context, trusted *trustedmetadata.TrustedMetadata) *metadataPrefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+	return &metadataPrefetcher{
+		update:  update,
+		trusted: trusted,
+		ctx:     ctx,
+		cancel:  cancel,
+		slots:   make(chan struct{}, max(update.cfg.MaxConcurrentDownloads, 1)),
+		results: map[string]*prefetchResult{},
+	}
+}
+
+// prefetch starts downloading the metadata of roleName in the background,
+// unless it is already trusted, cached locally or being downloaded
+func (p *metadataPrefetcher) prefetch(roleName string) {
+	if p == nil || p.results[roleName] != nil || p.update.trustedTargets(p.trusted, roleName) != nil || p.isCached(roleName) {
+		return
+	}
+	length, version := targetsMetaInfo(p.update.cfg, p.trusted, roleName)
+	result := &prefetchResult{done: make(chan struct{})}
+	p.results[roleName] = result
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(result.done)
+		select {
+		case p.slots <- struct{}{}:
+			defer func() { <-p.slots }()
+		case <-p.ctx.Done():
+			result.err = p.ctx.Err()
+			return
+		}
+		// any mirror serving something will do, the verification
+		// and the failover happen when the role is loaded
+		result.data, result.err = p.update.downloadMetadata(p.ctx, roleName, length, version, func([]byte) error { return nil })
+	}()
+}
+
+// isCached reports whether the locally cached metadata of roleName has the
+// version listed in the trusted snapshot, which makes downloading it useless
+func (p *metadataPrefetcher) isCached(roleName string) bool {
+	if p.update.cfg.DisableLocalCache {
+		return false
+	}
+	data, err := p.update.loadLocalMetadata(roleName)
+	if err != nil {
+		return false
+	}
+	cached, err := metadata.Targets().FromBytes(data)
+	if err != nil {
+		return false
+	}
+	metaInfo, ok := p.trusted.Snapshot.Signed.Meta[fmt.Sprintf("%s.json", roleName)]
+	return ok && cached.Signed.Version == metaInfo.Version
+}
+
+// take waits for the metadata of roleName to be downloaded and returns it,
+// or returns nil if it was not prefetched or its download failed
+func (p *metadataPrefetcher) take(roleName string) []byte {
+	if p == nil {
+		return nil
+	}
+	result, ok := p.results[roleName]
+	if !ok {
+		return nil
+	}
+	select {
+	case <-result.done:
+	case <-p.ctx.Done():
+		return nil
+	}
+	if result.err != nil {
+		metadata.GetLogger().Info("Failed to prefetch role", "role", roleName, "error", result.err.Error())
+		return nil
+	}
+	return result.data
+}
+
+// close stops the downloads still running and waits for them to return
+func (p *metadataPrefetcher) close() {
+	p.cancel()
+	p.wg.Wait()
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
+)
+
+// Provenance records why a target file is trusted: the role listing it,
+// the chain of delegations leading to that role and the versions of the
+// top-level metadata it was verified with
+type Provenance struct {
+	// Role is the name of the role whose metadata lists the target file
+	Role string
+	// Chain is the chain of delegations from the top-level targets role,
+	// delegated by root, down to Role
+	Chain []DelegationStep
+	// RootVersion is the version of the trusted root metadata
+	RootVersion int64
+	// TimestampVersion is the version of the trusted timestamp metadata
+	TimestampVersion int64
+	// SnapshotVersion is the version of the trusted snapshot metadata
+	SnapshotVersion int64
+}
+
+// DelegationStep is a delegation of a Provenance chain
+type DelegationStep struct {
+	// Role is the name of the delegated role
+	Role string
+	// Delegator is the name of the role delegating to Role
+	Delegator string
+	// Version is the version of the trusted metadata of Role
+	Version int64
+	// KeyIDs are the sorted IDs of the keys of Role whose signatures met
+	// the threshold set by Delegator
+	KeyIDs []string
+}
+
+// GetTargetInfoWithProvenance is like GetTargetInfo but also returns the
+// provenance of the target file, for auditing why it is trusted.
+func (update *Updater) GetTargetInfoWithProvenance(targetPath string) (*metadata.TargetFiles, *Provenance, error) {
+	return update.GetTargetInfoWithProvenanceContext(context.Background(), targetPath)
+}
+
+// GetTargetInfoWithProvenanceContext is like GetTargetInfoWithProvenance
+// but aborts the implicit refresh and the loading of delegated metadata as
+// soon as ctx is done.
+func (update *Updater) GetTargetInfoWithProvenanceContext(ctx context.Context, targetPath string) (*metadata.TargetFiles, *Provenance, error) {
+	// do a Refresh() in case there's no trusted targets.json yet
+	if update.trustedTargets(update.trustedSet(), metadata.TARGETS) == nil {
+		err := update.refreshOnce(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	trusted := update.trustedSet()
+	target, chain, err := update.preOrderDepthFirstWalk(ctx, trusted, targetPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if target == nil {
+		return nil, nil, metadata.ErrTargetNotFound{Path: targetPath}
+	}
+	err = update.validateCustom(target, chain[len(chain)-1].Role)
+	if err != nil {
+		return nil, nil, err
+	}
+	provenance, err := update.provenance(trusted, chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	return target, provenance, nil
+}
+
+// provenance builds the provenance of a target file found at the end of
+// chain. The signatures of each delegated role are verified again to tell
+// which keys met the threshold.
+func (update *Updater) provenance(trusted *trustedmetadata.TrustedMetadata, chain []roleParentTuple) (*Provenance, error) {
+	provenance := &Provenance{
+		Role:             chain[len(chain)-1].Role,
+		Chain:            make([]DelegationStep, 0, len(chain)),
+		RootVersion:      trusted.Root.Signed.Version,
+		TimestampVersion: trusted.Timestamp.Signed.Version,
+		SnapshotVersion:  trusted.Snapshot.Signed.Version,
+	}
+	for _, delegation := range chain {
+		delegated := update.trustedTargets(trusted, delegation.Role)
+		var keyIDs []string
+		var err error
+		if delegation.Parent == metadata.ROOT {
+			keyIDs, err = trusted.Root.VerifyDelegateKeyIDs(delegation.Role, delegated)
+		} else {
+			keyIDs, err = update.trustedTargets(trusted, delegation.Parent).VerifyDelegateKeyIDs(delegation.Role, delegated)
+		}
+		if err != nil {
+			return nil, err
+		}
+		provenance.Chain = append(provenance.Chain, DelegationStep{
+			Role:      delegation.Role,
+			Delegator: delegation.Parent,
+			Version:   delegated.Signed.Version,
+			KeyIDs:    keyIDs,
+		})
+	}
+	return provenance, nil
+}
@@ -12,20 +12,26 @@
 package updater
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"maps"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
 	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/fetcher"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/instrumentation"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/store"
 	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
 )
 
@@ -51,9 +57,26 @@ import (
 //     target file is already locally cached.
 //   - DownloadTarget() downloads a target file and ensures it is
 //     verified correct by the metadata.
+//
+// Refresh(), GetTargetInfo() and DownloadTarget() have RefreshContext(),
+// GetTargetInfoContext() and DownloadTargetContext() counterparts which
+// abort the network operations as soon as the given context is done.
+//
+// An Updater is safe for concurrent use. Refresh() builds a new trusted
+// metadata set on the side and swaps it in atomically once it is complete,
+// so concurrent lookups see either the previous set or the new one but
+// never a mix of both. Refreshes run one at a time.
 type Updater struct {
+	cfg             *config.UpdaterConfig
+	store           store.Store
+	metadataMirrors *mirrorSet
+	targetsMirrors  *mirrorSet
+	// mu guards trusted, which is replaced as a whole by a refresh, and
+	// the delegated targets metadata loaded into it by lookups
+	mu      sync.RWMutex
 	trusted *trustedmetadata.TrustedMetadata
-	cfg     *config.UpdaterConfig
+	// refreshMu serializes refreshes
+	refreshMu sync.Mutex
 }
 
 type roleParentTuple struct {
@@ -64,8 +87,8 @@ type roleParentTuple struct {
 // New creates a new Updater instance and loads trusted root metadata
 func New(config *config.UpdaterConfig) (*Updater, error) {
 	// make sure the trusted root metadata and remote URL were provided
-	if len(config.LocalTrustedRoot) == 0 || len(config.RemoteMetadataURL) == 0 {
-		return nil, fmt.Errorf("no initial trusted root metadata or remote URL provided")
+	if len(config.LocalTrustedRoot) == 0 || (len(config.RemoteMetadataURL) == 0 && len(config.MetadataMirrorURLs) == 0) {
+		return nil, metadata.ErrValue{Msg: "no initial trusted root metadata or remote URL provided"}
 	}
 	// create a new trusted metadata instance using the trusted root.json
 	trustedMetadataSet, err := trustedmetadata.New(config.LocalTrustedRoot)
@@ -76,13 +99,29 @@ func New(config *config.UpdaterConfig) (*Updater, error) {
 	updater := &Updater{
 		cfg:     config,
 		trusted: trustedMetadataSet, // save trusted metadata set
+		// the remote URLs come first, followed by their mirrors
+		metadataMirrors: newMirrorSet(config.PreferFastestMirror, append([]string{config.RemoteMetadataURL}, config.MetadataMirrorURLs...)...),
+		targetsMirrors:  newMirrorSet(config.PreferFastestMirror, append([]string{config.RemoteTargetsURL}, config.TargetsMirrorURLs...)...),
+	}
+	trustedMetadataSet.RefTime = updater.now()
+	trustedMetadataSet.ExpiryPolicy = config.ExpiryPolicy
+	if config.Store != nil {
+		updater.store = config.Store
+	} else {
+		// default to caching in LocalMetadataDir and LocalTargetsDir
+		updater.store = store.NewFileStore(config.LocalMetadataDir, config.LocalTargetsDir)
+		// ensure paths exist, doesn't do anything if caching is disabled
+		err = updater.cfg.EnsurePathsExist()
+		if err != nil {
+			return nil, err
+		}
 	}
-	// ensure paths exist, doesn't do anything if caching is disabled
-	err = updater.cfg.EnsurePathsExist()
+	// persist the initial root metadata to the local metadata folder
+	unlock, err := updater.lockCache(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	// persist the initial root metadata to the local metadata folder
+	defer unlock()
 	err = updater.persistMetadata(metadata.ROOT, updater.cfg.LocalTrustedRoot)
 	if err != nil {
 		return nil, err
@@ -95,7 +134,9 @@ func New(config *config.UpdaterConfig) (*Updater, error) {
 // Downloads, verifies, and loads metadata for the top-level roles in the
 // specified order (root -> timestamp -> snapshot -> targets) implementing
 // all the checks required in the TUF client workflow.
-// A Refresh() can be done only once during the lifetime of an Updater.
+// Refresh() can be called again at any time, e.g. from a background loop,
+// to pick up newer metadata. Lookups keep using the previous metadata
+// until the refresh completes, and keep using it if the refresh fails.
 // If Refresh() has not been explicitly called before the first
 // GetTargetInfo() call, it will be done implicitly at that time.
 // The metadata for delegated roles is not updated by Refresh():
@@ -107,28 +148,117 @@ func New(config *config.UpdaterConfig) (*Updater, error) {
 // the cached files on disk are used. If the cached data is not complete,
 // this call will fail.
 func (update *Updater) Refresh() error {
+	return update.RefreshContext(context.Background())
+}
+
+// RefreshContext is like Refresh but aborts as soon as ctx is done.
+// A deadline set on ctx applies to the whole refresh, in addition to the
+// per-file DownloadTimeout from the configuration.
+func (update *Updater) RefreshContext(ctx context.Context) error {
+	update.refreshMu.Lock()
+	defer update.refreshMu.Unlock()
+	return update.refresh(ctx)
+}
+
+// refresh runs the client workflow on a shadow Updater, whose trusted
+// metadata set replaces the current one once it is complete. The caller
+// must hold refreshMu.
+func (update *Updater) refresh(ctx context.Context) (err error) {
+	ctx, end := update.instrument().StartStep(ctx, instrumentation.StepRefresh, "")
+	defer func() { end(err) }()
+	current := update.trustedSet()
+	shadow := &Updater{
+		cfg:             update.cfg,
+		store:           update.store,
+		metadataMirrors: update.metadataMirrors,
+		targetsMirrors:  update.targetsMirrors,
+		trusted:         nextTrustedSet(current, update.now()),
+	}
 	if update.cfg.UnsafeLocalMode {
-		return update.unsafeLocalRefresh()
+		err := shadow.unsafeLocalRefresh()
+		if err != nil {
+			return err
+		}
+	} else {
+		unlock, err := update.lockCache(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		err = shadow.onlineRefresh(ctx)
+		if err != nil {
+			return err
+		}
 	}
-	return update.onlineRefresh()
+	err = checkRollback(current, shadow.trusted)
+	if err != nil {
+		return err
+	}
+	update.mu.Lock()
+	defer update.mu.Unlock()
+	update.trusted = shadow.trusted
+	return nil
+}
+
+// nextTrustedSet returns the trusted metadata set a refresh starts from.
+// The first refresh starts from the set created by New, later ones from
+// the current trusted root alone. Either way, the expiry of the metadata
+// is checked against refTime.
+func nextTrustedSet(current *trustedmetadata.TrustedMetadata, refTime time.Time) *trustedmetadata.TrustedMetadata {
+	if current.Timestamp == nil {
+		next := *current
+		next.Targets = maps.Clone(current.Targets)
+		next.Degraded = maps.Clone(current.Degraded)
+		next.RefTime = refTime
+		return &next
+	}
+	return &trustedmetadata.TrustedMetadata{
+		Root:         current.Root,
+		Targets:      map[string]*metadata.Metadata[metadata.TargetsType]{},
+		RefTime:      refTime,
+		ExpiryPolicy: current.ExpiryPolicy,
+	}
+}
+
+// checkRollback makes sure a refresh did not go back to older timestamp
+// or snapshot metadata than the current trusted ones, which the local
+// cache would not catch if it is disabled
+func checkRollback(current, next *trustedmetadata.TrustedMetadata) error {
+	if current.Timestamp != nil && next.Timestamp.Signed.Version < current.Timestamp.Signed.Version {
+		return metadata.ErrBadVersionNumber{
+			Msg:      fmt.Sprintf("new timestamp version %d must be >= %d", next.Timestamp.Signed.Version, current.Timestamp.Signed.Version),
+			Role:     metadata.TIMESTAMP,
+			Expected: current.Timestamp.Signed.Version,
+			Actual:   next.Timestamp.Signed.Version,
+		}
+	}
+	if current.Snapshot != nil && next.Snapshot.Signed.Version < current.Snapshot.Signed.Version {
+		return metadata.ErrBadVersionNumber{
+			Msg:      fmt.Sprintf("new snapshot version %d must be >= %d", next.Snapshot.Signed.Version, current.Snapshot.Signed.Version),
+			Role:     metadata.SNAPSHOT,
+			Expected: current.Snapshot.Signed.Version,
+			Actual:   next.Snapshot.Signed.Version,
+		}
+	}
+	return nil
 }
 
 // onlineRefresh implements the TUF client workflow as described for
 // the Refresh function.
-func (update *Updater) onlineRefresh() error {
-	err := update.loadRoot()
+func (update *Updater) onlineRefresh(ctx context.Context) error {
+	err := update.loadRoot(ctx)
 	if err != nil {
 		return err
 	}
-	err = update.loadTimestamp()
+	err = update.loadTimestamp(ctx)
 	if err != nil {
 		return err
 	}
-	err = update.loadSnapshot()
+	err = update.loadSnapshot(ctx)
 	if err != nil {
 		return err
 	}
-	_, err = update.loadTargets(metadata.TARGETS, metadata.ROOT)
+	_, err = update.loadTargets(ctx, update.trusted, metadata.TARGETS, metadata.ROOT, nil)
 	if err != nil {
 		return err
 	}
@@ -143,8 +273,7 @@ func (update *Updater) onlineRefresh() error {
 func (update *Updater) unsafeLocalRefresh() error {
 	// Root is already loaded
 	// load timestamp
-	var p = filepath.Join(update.cfg.LocalMetadataDir, metadata.TIMESTAMP)
-	data, err := update.loadLocalMetadata(p)
+	data, err := update.loadLocalMetadata(metadata.TIMESTAMP)
 	if err != nil {
 		return err
 	}
@@ -154,8 +283,7 @@ func (update *Updater) unsafeLocalRefresh() error {
 	}
 
 	// load snapshot
-	p = filepath.Join(update.cfg.LocalMetadataDir, metadata.SNAPSHOT)
-	data, err = update.loadLocalMetadata(p)
+	data, err = update.loadLocalMetadata(metadata.SNAPSHOT)
 	if err != nil {
 		return err
 	}
@@ -165,8 +293,7 @@ func (update *Updater) unsafeLocalRefresh() error {
 	}
 
 	// targets
-	p = filepath.Join(update.cfg.LocalMetadataDir, metadata.TARGETS)
-	data, err = update.loadLocalMetadata(p)
+	data, err = update.loadLocalMetadata(metadata.TARGETS)
 	if err != nil {
 		return err
 	}
@@ -186,19 +313,86 @@ func (update *Updater) unsafeLocalRefresh() error {
 // GetTargetInfo(), the refresh will be done implicitly.
 // As a side-effect this method downloads all the additional (delegated
 // targets) metadata it needs to return the target information.
+// It fails with ErrTargetNotFound if no trusted role lists targetPath.
+// Target files whose custom metadata fails the CustomValidators of the
+// configuration are rejected with ErrCustomMetadata.
 func (update *Updater) GetTargetInfo(targetPath string) (*metadata.TargetFiles, error) {
+	return update.GetTargetInfoContext(context.Background(), targetPath)
+}
+
+// GetTargetInfoContext is like GetTargetInfo but aborts the implicit
+// refresh and the loading of delegated metadata as soon as ctx is done.
+func (update *Updater) GetTargetInfoContext(ctx context.Context, targetPath string) (*metadata.TargetFiles, error) {
 	// do a Refresh() in case there's no trusted targets.json yet
-	if update.trusted.Targets[metadata.TARGETS] == nil {
-		err := update.Refresh()
+	if update.trustedTargets(update.trustedSet(), metadata.TARGETS) == nil {
+		err := update.refreshOnce(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return update.preOrderDepthFirstWalk(targetPath)
+	target, chain, err := update.preOrderDepthFirstWalk(ctx, update.trustedSet(), targetPath)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, metadata.ErrTargetNotFound{Path: targetPath}
+	}
+	err = update.validateCustom(target, chain[len(chain)-1].Role)
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// validateCustom checks the custom metadata of target, listed by roleName,
+// with the custom validators of the configuration applying to it
+func (update *Updater) validateCustom(target *metadata.TargetFiles, roleName string) error {
+	for _, validator := range update.cfg.CustomValidators {
+		if validator.Role != "" && validator.Role != roleName {
+			continue
+		}
+		if len(validator.Paths) > 0 {
+			role := metadata.DelegatedRole{Paths: validator.Paths}
+			ok, err := role.IsDelegatedPath(target.Path)
+			if err != nil || !ok {
+				continue
+			}
+		}
+		err := validator.Validate(target.Custom)
+		if err != nil {
+			return metadata.ErrCustomMetadata{
+				Msg:  fmt.Sprintf("target %s listed by %s: %v", target.Path, roleName, err),
+				Path: target.Path,
+				Role: roleName,
+			}
+		}
+	}
+	return nil
+}
+
+// refreshOnce refreshes the metadata unless a concurrent call did it
+func (update *Updater) refreshOnce(ctx context.Context) error {
+	update.refreshMu.Lock()
+	defer update.refreshMu.Unlock()
+	if update.trustedTargets(update.trustedSet(), metadata.TARGETS) != nil {
+		return nil
+	}
+	return update.refresh(ctx)
 }
 
-// DownloadTarget downloads the target file specified by targetFile
+// DownloadTarget downloads the target file specified by targetFile.
+// Unless the local cache is disabled, the target file is written to disk
+// the same way DownloadTargetToFile does, resuming interrupted downloads.
+// If filePath is empty and the configured store does not keep target files
+// on disk, the target file is written to the store and the returned path
+// is empty.
 func (update *Updater) DownloadTarget(targetFile *metadata.TargetFiles, filePath, targetBaseURL string) (string, []byte, error) {
+	return update.DownloadTargetContext(context.Background(), targetFile, filePath, targetBaseURL)
+}
+
+// DownloadTargetContext is like DownloadTarget but aborts the download
+// as soon as ctx is done.
+func (update *Updater) DownloadTargetContext(ctx context.Context, targetFile *metadata.TargetFiles, filePath, targetBaseURL string) (string, []byte, error) {
 	log := metadata.GetLogger()
 
 	var err error
@@ -208,16 +402,260 @@ func (update *Updater) DownloadTarget(targetFile *metadata.TargetFiles, filePath
 			return "", nil, err
 		}
 	}
-	if targetBaseURL == "" {
-		if update.cfg.RemoteTargetsURL == "" {
-			return "", nil, metadata.ErrValue{Msg: "targetBaseURL must be set in either DownloadTarget() or the Updater struct"}
+	// persist the target file through a resumable download unless
+	// the cache is disabled or the store does not use files
+	if !update.cfg.DisableLocalCache && filePath != "" {
+		filePath, err = update.DownloadTargetToFileContext(ctx, targetFile, filePath, targetBaseURL)
+		if err != nil {
+			return "", nil, err
 		}
-		targetBaseURL = ensureTrailingSlash(update.cfg.RemoteTargetsURL)
-	} else {
-		targetBaseURL = ensureTrailingSlash(targetBaseURL)
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return "", nil, err
+		}
+		return filePath, data, nil
+	}
+	mirrors, err := update.targetMirrors(targetBaseURL)
+	if err != nil {
+		return "", nil, err
+	}
+	var data []byte
+	err = update.tryMirrors(ctx, mirrors, update.targetFileName(targetFile), func(fullURL string) error {
+		// stream the target file so that DownloadTimeout applies to
+		// stalls rather than to the whole transfer
+		body, err := update.downloadStream(ctx, fullURL, targetFile.Length)
+		if err != nil {
+			return err
+		}
+		downloaded, err := io.ReadAll(body)
+		if errClose := body.Close(); err == nil {
+			err = errClose
+		}
+		if err != nil {
+			return err
+		}
+		update.instrument().Downloaded(ctx, instrumentation.Target, int64(len(downloaded)))
+		err = targetFile.VerifyLengthHashes(downloaded)
+		if err != nil {
+			update.instrument().VerificationFailed(ctx, instrumentation.Target, err)
+			return err
+		}
+		data = downloaded
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	log.Info("Downloaded target", "path", targetFile.Path)
+	if !update.cfg.DisableLocalCache {
+		err = update.persistTarget(targetFile.Path, data)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return filePath, data, nil
+}
+
+// DownloadTargetTo downloads the target file specified by targetFile and
+// streams it to w, verifying its length and hashes while it is written.
+// The content is never held in memory as a whole. Since w receives the
+// data before the verification is complete, whatever was written to it
+// must be discarded if an error is returned. For the same reason, the
+// next mirror is only tried if nothing was written to w yet.
+func (update *Updater) DownloadTargetTo(targetFile *metadata.TargetFiles, w io.Writer, targetBaseURL string) error {
+	return update.DownloadTargetToContext(context.Background(), targetFile, w, targetBaseURL)
+}
+
+// DownloadTargetToContext is like DownloadTargetTo but aborts the download
+// as soon as ctx is done.
+func (update *Updater) DownloadTargetToContext(ctx context.Context, targetFile *metadata.TargetFiles, w io.Writer, targetBaseURL string) error {
+	log := metadata.GetLogger()
+
+	mirrors, err := update.targetMirrors(targetBaseURL)
+	if err != nil {
+		return err
+	}
+	written := &countingWriter{w: w}
+	err = update.tryMirrors(ctx, mirrors, update.targetFileName(targetFile), func(fullURL string) error {
+		body, err := update.downloadStream(ctx, fullURL, targetFile.Length)
+		if err != nil {
+			return err
+		}
+		body = update.countTargetDownload(ctx, body)
+		defer body.Close()
+		// everything read by the verification is copied to w on the way
+		err = targetFile.VerifyLengthHashesFromReader(io.TeeReader(body, written))
+		update.reportTargetVerification(ctx, err)
+		if err != nil && written.n > 0 {
+			return errNoFailover{err: err}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Downloaded target", "path", targetFile.Path)
+	return nil
+}
+
+// DownloadTargetToFile downloads the target file specified by targetFile
+// and streams it to a partial file next to filePath, named after it with
+// the ".%partial-" prefix. The partial file is renamed to filePath only
+// once its length and hashes are verified.
+// If the configured fetcher implements fetcher.RangeFetcher, a partial
+// file left behind by an interrupted download is resumed instead of
+// downloaded again. If filePath is empty, the target is stored in
+// LocalTargetsDir, or wherever the configured store keeps target files on
+// disk. It returns the path of the downloaded target file.
+func (update *Updater) DownloadTargetToFile(targetFile *metadata.TargetFiles, filePath, targetBaseURL string) (string, error) {
+	return update.DownloadTargetToFileContext(context.Background(), targetFile, filePath, targetBaseURL)
+}
+
+// DownloadTargetToFileContext is like DownloadTargetToFile but aborts the
+// download as soon as ctx is done.
+func (update *Updater) DownloadTargetToFileContext(ctx context.Context, targetFile *metadata.TargetFiles, filePath, targetBaseURL string) (string, error) {
+	log := metadata.GetLogger()
+
+	var err error
+	if filePath == "" {
+		filePath, err = update.generateTargetFilePath(targetFile)
+		if err != nil {
+			return "", err
+		}
+		if filePath == "" {
+			return "", metadata.ErrValue{Msg: "filePath must be set if the store does not keep target files on disk"}
+		}
+	}
+	mirrors, err := update.targetMirrors(targetBaseURL)
+	if err != nil {
+		return "", err
+	}
+	// the partial file lives in the destination folder, so the final
+	// rename does not cross file systems. It stays locked until it is
+	// renamed, so other processes do not download to it at the same time.
+	partialPath := partialFilePath(filePath)
+	lockCtx, cancel := update.lockContext(ctx)
+	defer cancel()
+	partial, err := store.LockFile(lockCtx, partialPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return "", err
+	}
+	err = update.tryMirrors(ctx, mirrors, update.targetFileName(targetFile), func(fullURL string) error {
+		err := update.resumeDownload(ctx, targetFile, fullURL, partial)
+		var errMismatch metadata.ErrLengthOrHashMismatch
+		if errors.As(err, &errMismatch) {
+			// drop the content of the partial file, it is not trusted
+			errTruncate := partial.Truncate(0)
+			if errTruncate != nil {
+				log.Info("Failed to truncate partial file", "path", partialPath)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		// keep the partial file only if there is something to resume
+		if info, errStat := partial.Stat(); errStat == nil && info.Size() == 0 {
+			_ = os.Remove(partialPath)
+		}
+		_ = store.UnlockFile(partial)
+		return "", err
+	}
+	// verification passed, move the target file in place
+	err = store.CommitLockedFile(partial, filePath, 0644)
+	if err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// partialFilePrefix prefixes the name of the partial file of a target
+// download. No target file stored under its URL encoded path can have a
+// name starting with it, since "%" is only ever followed by two hex digits
+// in a URL encoded path.
+const partialFilePrefix = ".%partial-"
+
+// partialFilePath returns the path of the partial file of a download to
+// filePath
+func partialFilePath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), partialFilePrefix+filepath.Base(filePath))
+}
+
+// resumeDownload appends the missing content of targetFile to the partial
+// file and verifies the length and hashes of the complete file.
+// The content already present is verified too. If it turns out not to
+// belong to targetFile, e.g. because the target file changed since the
+// download was interrupted, the download starts over from the beginning
+// once.
+func (update *Updater) resumeDownload(ctx context.Context, targetFile *metadata.TargetFiles, fullURL string, partial *os.File) error {
+	info, err := partial.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size()
+	if offset >= targetFile.Length {
+		// nothing left to resume, start again from the beginning
+		offset = 0
+	}
+	start, err := update.downloadFrom(ctx, targetFile, fullURL, partial, offset)
+	if start > 0 && errors.Is(err, metadata.ErrLengthOrHashMismatch{}) {
+		metadata.GetLogger().Info("Restarting target download, the resumed content does not match", "path", targetFile.Path)
+		_, err = update.downloadFrom(ctx, targetFile, fullURL, partial, 0)
+	}
+	update.reportTargetVerification(ctx, err)
+	return err
+}
+
+// downloadFrom downloads targetFile to the partial file starting at offset
+// and verifies the complete file. It returns the offset the download
+// actually started at, the content of the partial file up to that offset
+// being kept.
+func (update *Updater) downloadFrom(ctx context.Context, targetFile *metadata.TargetFiles, fullURL string, partial *os.File, offset int64) (int64, error) {
+	log := metadata.GetLogger()
+
+	body, start, err := update.downloadRange(ctx, fullURL, offset, targetFile.Length)
+	if err != nil {
+		return 0, err
+	}
+	body = update.countTargetDownload(ctx, body)
+	defer body.Close()
+	if start > 0 {
+		log.Info("Resuming target download", "path", targetFile.Path, "offset", start)
 	}
+	// drop whatever the server did not resume from, e.g. when it
+	// ignored the requested range and sent the whole file
+	err = partial.Truncate(start)
+	if err != nil {
+		return start, err
+	}
+	// verify the content already on disk followed by the downloaded
+	// content, which is appended to the partial file on the way
+	content := io.MultiReader(io.NewSectionReader(partial, 0, start), io.TeeReader(body, partial))
+	err = targetFile.VerifyLengthHashesFromReader(content)
+	if err != nil {
+		return start, err
+	}
+	log.Info("Downloaded target", "path", targetFile.Path)
+	return start, nil
+}
+
+// targetMirrors returns the mirrors to download target files from, which
+// is targetBaseURL alone if it is set
+func (update *Updater) targetMirrors(targetBaseURL string) (*mirrorSet, error) {
+	if targetBaseURL != "" {
+		return newMirrorSet(false, targetBaseURL), nil
+	}
+	if len(update.targetsMirrors.urls) == 0 {
+		return nil, metadata.ErrValue{Msg: "targetBaseURL must be set in either DownloadTarget() or the Updater struct"}
+	}
+	return update.targetsMirrors, nil
+}
+
+// targetFileName builds the path of targetFile relative to the targets
+// URL, taking consistent snapshots and hash-prefixed target file names
+// into account
+func (update *Updater) targetFileName(targetFile *metadata.TargetFiles) string {
 	targetFilePath := targetFile.Path
-	consistentSnapshot := update.trusted.Root.Signed.ConsistentSnapshot
+	consistentSnapshot := update.trustedSet().Root.Signed.ConsistentSnapshot
 	if consistentSnapshot && update.cfg.PrefixTargetsWithHash {
 		hashes := ""
 		// get first hex value of hashes
@@ -234,25 +672,54 @@ func (update *Updater) DownloadTarget(targetFile *metadata.TargetFiles, filePath
 			targetFilePath = fmt.Sprintf("%s/%s.%s", dirName, hashes, baseName)
 		}
 	}
-	fullURL := fmt.Sprintf("%s%s", targetBaseURL, targetFilePath)
-	data, err := update.cfg.Fetcher.DownloadFile(fullURL, targetFile.Length, time.Second*15)
-	if err != nil {
-		return "", nil, err
-	}
-	err = targetFile.VerifyLengthHashes(data)
-	if err != nil {
-		return "", nil, err
-	}
+	return targetFilePath
+}
 
-	// do not persist the target file if cache is disabled
-	if !update.cfg.DisableLocalCache {
-		err = os.WriteFile(filePath, data, 0644)
-		if err != nil {
-			return "", nil, err
-		}
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read from a stream and reports them
+// once it is closed
+type countingReader struct {
+	io.ReadCloser
+	n      int64
+	report func(n int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	c.report(c.n)
+	return c.ReadCloser.Close()
+}
+
+// countTargetDownload reports the bytes read from body as downloaded for
+// a target file once body is closed
+func (update *Updater) countTargetDownload(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	return &countingReader{ReadCloser: body, report: func(n int64) {
+		update.instrument().Downloaded(ctx, instrumentation.Target, n)
+	}}
+}
+
+// reportTargetVerification reports err if the content of a downloaded
+// target file failed the verification, rather than its download
+func (update *Updater) reportTargetVerification(ctx context.Context, err error) {
+	if errors.Is(err, metadata.ErrLengthOrHashMismatch{}) {
+		update.instrument().VerificationFailed(ctx, instrumentation.Target, err)
 	}
-	log.Info("Downloaded target", "path", targetFile.Path)
-	return filePath, data, nil
 }
 
 // FindCachedTarget checks whether a local file is an up to date target
@@ -272,61 +739,76 @@ func (update *Updater) FindCachedTarget(targetFile *metadata.TargetFiles, filePa
 	} else {
 		targetFilePath = filePath
 	}
-	// get file content
-	data, err := readFile(targetFilePath)
+	// get file content, from the store if it does not use files
+	var data []byte
+	if targetFilePath == "" {
+		data, err = update.readStoredTarget(targetFile.Path)
+	} else {
+		data, err = readFile(targetFilePath)
+	}
 	if err != nil {
 		// do not want to return err, instead we say that there's no cached target available
+		update.instrument().CachedTarget(context.Background(), false)
 		return "", nil, nil
 	}
 	// verify if the length and hashes of this target file match the expected values
 	err = targetFile.VerifyLengthHashes(data)
 	if err != nil {
 		// do not want to return err, instead we say that there's no cached target available
+		update.instrument().CachedTarget(context.Background(), false)
 		return "", nil, nil
 	}
 	// if all okay, return its path
+	update.instrument().CachedTarget(context.Background(), true)
 	return targetFilePath, data, nil
 }
 
 // loadTimestamp load local and remote timestamp metadata
-func (update *Updater) loadTimestamp() error {
+func (update *Updater) loadTimestamp(ctx context.Context) (err error) {
+	ctx, end := update.instrument().StartStep(ctx, instrumentation.StepLoadTimestamp, metadata.TIMESTAMP)
+	defer func() { end(err) }()
 	log := metadata.GetLogger()
 	// try to read local timestamp
-	data, err := update.loadLocalMetadata(filepath.Join(update.cfg.LocalMetadataDir, metadata.TIMESTAMP))
+	data, err := update.loadLocalMetadata(metadata.TIMESTAMP)
 	if err != nil {
 		// this means there's no existing local timestamp so we should proceed downloading it without the need to UpdateTimestamp
-		log.Info("Local timestamp does not exist")
+		log.Debug("Local timestamp does not exist", "role", metadata.TIMESTAMP)
 	} else {
 		// local timestamp exists, let's try to verify it and load it to the trusted metadata set
 		_, err := update.trusted.UpdateTimestamp(data)
 		if err != nil {
 			if errors.Is(err, metadata.ErrRepository{}) {
 				// local timestamp is not valid, proceed downloading from remote; note that this error type includes several other subset errors
-				log.Info("Local timestamp is not valid")
+				log.Debug("Local timestamp is not valid", "role", metadata.TIMESTAMP, "error", err.Error())
 			} else {
 				// another error
 				return err
 			}
+		} else {
+			// all okay, local timestamp exists and it is valid, nevertheless proceed with downloading from remote
+			log.Debug("Local timestamp is valid", "role", metadata.TIMESTAMP)
 		}
-		log.Info("Local timestamp is valid")
-		// all okay, local timestamp exists and it is valid, nevertheless proceed with downloading from remote
 	}
 	// load from remote (whether local load succeeded or not)
-	data, err = update.downloadMetadata(metadata.TIMESTAMP, update.cfg.TimestampMaxLength, "")
-	if err != nil {
-		return err
-	}
-	// try to verify and load the newly downloaded timestamp
-	_, err = update.trusted.UpdateTimestamp(data)
-	if err != nil {
+	unchanged := false
+	data, err = update.downloadMetadata(ctx, metadata.TIMESTAMP, update.cfg.TimestampMaxLength, "", func(data []byte) error {
+		// try to verify and load the newly downloaded timestamp
+		_, err := update.trusted.UpdateTimestamp(data)
 		if errors.Is(err, metadata.ErrEqualVersionNumber{}) {
 			// if the new timestamp version is the same as current, discard the
 			// new timestamp; this is normal and it shouldn't raise any error
+			unchanged = true
 			return nil
-		} else {
-			// another error
-			return err
 		}
+		return err
+	})
+	if err != nil && update.trusted.Timestamp != nil {
+		// keep the local timestamp through an outage of the repository, as
+		// far as the expiry policy allows it
+		return update.keepCached(ctx, update.trusted, metadata.TIMESTAMP, err, nil)
+	}
+	if err != nil || unchanged {
+		return err
 	}
 	// proceed with persisting the new timestamp
 	err = update.persistMetadata(metadata.TIMESTAMP, data)
@@ -337,13 +819,15 @@ func (update *Updater) loadTimestamp() error {
 }
 
 // loadSnapshot load local (and if needed remote) snapshot metadata
-func (update *Updater) loadSnapshot() error {
+func (update *Updater) loadSnapshot(ctx context.Context) (err error) {
+	ctx, end := update.instrument().StartStep(ctx, instrumentation.StepLoadSnapshot, metadata.SNAPSHOT)
+	defer func() { end(err) }()
 	log := metadata.GetLogger()
 	// try to read local snapshot
-	data, err := update.loadLocalMetadata(filepath.Join(update.cfg.LocalMetadataDir, metadata.SNAPSHOT))
+	data, err := update.loadLocalMetadata(metadata.SNAPSHOT)
 	if err != nil {
 		// this means there's no existing local snapshot so we should proceed downloading it without the need to UpdateSnapshot
-		log.Info("Local snapshot does not exist")
+		log.Debug("Local snapshot does not exist", "role", metadata.SNAPSHOT)
 	} else {
 		// successfully read a local snapshot metadata, so let's try to verify and load it to the trusted metadata set
 		_, err = update.trusted.UpdateSnapshot(data, true)
@@ -351,21 +835,21 @@ func (update *Updater) loadSnapshot() error {
 			// this means snapshot verification/loading failed
 			if errors.Is(err, metadata.ErrRepository{}) {
 				// local snapshot is not valid, proceed downloading from remote; note that this error type includes several other subset errors
-				log.Info("Local snapshot is not valid")
+				log.Debug("Local snapshot is not valid", "role", metadata.SNAPSHOT, "error", err.Error())
 			} else {
 				// another error
 				return err
 			}
 		} else {
 			// this means snapshot verification/loading succeeded
-			log.Info("Local snapshot is valid: not downloading new one")
+			log.Debug("Local snapshot is valid: not downloading new one", "role", metadata.SNAPSHOT)
 			return nil
 		}
 	}
 	// local snapshot does not exist or is invalid, update from remote
-	log.Info("Failed to load local snapshot")
+	log.Debug("Failed to load local snapshot", "role", metadata.SNAPSHOT)
 	if update.trusted.Timestamp == nil {
-		return fmt.Errorf("trusted timestamp not set")
+		return metadata.ErrRuntime{Msg: "trusted timestamp not set"}
 	}
 	// extract the snapshot meta from the trusted timestamp metadata
 	snapshotMeta := update.trusted.Timestamp.Signed.Meta[fmt.Sprintf("%s.json", metadata.SNAPSHOT)]
@@ -379,13 +863,16 @@ func (update *Updater) loadSnapshot() error {
 	if update.trusted.Root.Signed.ConsistentSnapshot {
 		version = strconv.FormatInt(snapshotMeta.Version, 10)
 	}
-	// download snapshot metadata
-	data, err = update.downloadMetadata(metadata.SNAPSHOT, length, version)
-	if err != nil {
+	// download, verify and load the new snapshot metadata
+	data, err = update.downloadMetadata(ctx, metadata.SNAPSHOT, length, version, func(data []byte) error {
+		_, err := update.trusted.UpdateSnapshot(data, false)
 		return err
+	})
+	if err != nil && update.trusted.Snapshot != nil {
+		// keep the local snapshot through an outage of the repository, as
+		// far as the expiry policy allows it
+		return update.keepCached(ctx, update.trusted, metadata.SNAPSHOT, err, nil)
 	}
-	// verify and load the new snapshot
-	_, err = update.trusted.UpdateSnapshot(data, false)
 	if err != nil {
 		return err
 	}
@@ -398,62 +885,73 @@ func (update *Updater) loadSnapshot() error {
 }
 
 // loadTargets load local (and if needed remote) metadata for roleName
-func (update *Updater) loadTargets(roleName, parentName string) (*metadata.Metadata[metadata.TargetsType], error) {
+// into the trusted metadata set. Metadata downloaded in advance by
+// prefetcher is used if it verifies.
+func (update *Updater) loadTargets(ctx context.Context, trusted *trustedmetadata.TrustedMetadata, roleName, parentName string, prefetcher *metadataPrefetcher) (_ *metadata.Metadata[metadata.TargetsType], err error) {
 	log := metadata.GetLogger()
 	// avoid loading "roleName" more than once during "GetTargetInfo"
-	role, ok := update.trusted.Targets[roleName]
-	if ok {
+	role := update.trustedTargets(trusted, roleName)
+	if role != nil {
 		return role, nil
 	}
+	ctx, end := update.instrument().StartStep(ctx, instrumentation.StepLoadTargets, roleName)
+	defer func() { end(err) }()
 	// try to read local targets
-	data, err := update.loadLocalMetadata(filepath.Join(update.cfg.LocalMetadataDir, roleName))
+	local, err := update.loadLocalMetadata(roleName)
 	if err != nil {
 		// this means there's no existing local target file so we should proceed downloading it without the need to UpdateDelegatedTargets
-		log.Info("Local role does not exist", "role", roleName)
+		log.Debug("Local role does not exist", "role", roleName)
 	} else {
 		// successfully read a local targets metadata, so let's try to verify and load it to the trusted metadata set
-		delegatedTargets, err := update.trusted.UpdateDelegatedTargets(data, roleName, parentName)
+		delegatedTargets, err := update.updateDelegatedTargets(trusted, local, roleName, parentName)
 		if err != nil {
 			// this means targets verification/loading failed
 			if errors.Is(err, metadata.ErrRepository{}) {
 				// local target file is not valid, proceed downloading from remote; note that this error type includes several other subset errors
-				log.Info("Local role is not valid", "role", roleName)
+				log.Debug("Local role is not valid", "role", roleName, "error", err.Error())
 			} else {
 				// another error
 				return nil, err
 			}
 		} else {
 			// this means targets verification/loading succeeded
-			log.Info("Local role is valid: not downloading new one", "role", roleName)
+			log.Debug("Local role is valid: not downloading new one", "role", roleName)
 			return delegatedTargets, nil
 		}
 	}
 	// local "roleName" does not exist or is invalid, update from remote
-	log.Info("Failed to load local role", "role", roleName)
-	if update.trusted.Snapshot == nil {
-		return nil, fmt.Errorf("trusted snapshot not set")
+	log.Debug("Failed to load local role", "role", roleName)
+	if trusted.Snapshot == nil {
+		return nil, metadata.ErrRuntime{Msg: "trusted snapshot not set"}
 	}
-	// extract the targets meta from the trusted snapshot metadata
-	metaInfo := update.trusted.Snapshot.Signed.Meta[fmt.Sprintf("%s.json", roleName)]
-	// extract the length of the target metadata to be downloaded
-	length := metaInfo.Length
-	if length == 0 {
-		length = update.cfg.TargetsMaxLength
-	}
-	// extract which target metadata version should be downloaded in case of consistent snapshots
-	version := ""
-	if update.trusted.Root.Signed.ConsistentSnapshot {
-		version = strconv.FormatInt(metaInfo.Version, 10)
+	length, version := targetsMetaInfo(update.cfg, trusted, roleName)
+	// download, verify and load the new target metadata
+	var delegatedTargets *metadata.Metadata[metadata.TargetsType]
+	verify := func(data []byte) error {
+		delegatedTargets, err = update.updateDelegatedTargets(trusted, data, roleName, parentName)
+		return err
 	}
-	// download targets metadata
-	data, err = update.downloadMetadata(roleName, length, version)
-	if err != nil {
-		return nil, err
+	data := prefetcher.take(roleName)
+	if data != nil {
+		err = verify(data)
+		if err != nil {
+			log.Info("Prefetched role is not valid", "role", roleName, "error", err.Error())
+			update.instrument().VerificationFailed(ctx, instrumentation.Metadata, err)
+		}
 	}
-	// verify and load the new target metadata
-	delegatedTargets, err := update.trusted.UpdateDelegatedTargets(data, roleName, parentName)
-	if err != nil {
-		return nil, err
+	if data == nil || err != nil {
+		data, err = update.downloadMetadata(ctx, roleName, length, version, verify)
+		if err != nil && local != nil {
+			// keep the local role through an outage of the repository, as
+			// far as the expiry policy allows it
+			err = update.keepCached(ctx, trusted, roleName, err, func() error { return verify(local) })
+			if err == nil {
+				return delegatedTargets, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 	// persist the new target metadata
 	err = update.persistMetadata(roleName, data)
@@ -463,41 +961,90 @@ func (update *Updater) loadTargets(roleName, parentName string) (*metadata.Metad
 	return delegatedTargets, nil
 }
 
+// updateDelegatedTargets verifies and loads the metadata of roleName into
+// the trusted metadata set, which lookups may be reading concurrently
+func (update *Updater) updateDelegatedTargets(trusted *trustedmetadata.TrustedMetadata, data []byte, roleName, parentName string) (*metadata.Metadata[metadata.TargetsType], error) {
+	update.mu.Lock()
+	defer update.mu.Unlock()
+	return trusted.UpdateDelegatedTargets(data, roleName, parentName)
+}
+
+// trustedTargets returns the targets metadata of roleName already loaded
+// into the trusted metadata set, if any
+func (update *Updater) trustedTargets(trusted *trustedmetadata.TrustedMetadata, roleName string) *metadata.Metadata[metadata.TargetsType] {
+	update.mu.RLock()
+	defer update.mu.RUnlock()
+	return trusted.Targets[roleName]
+}
+
+// trustedSet returns the current trusted metadata set
+func (update *Updater) trustedSet() *trustedmetadata.TrustedMetadata {
+	update.mu.RLock()
+	defer update.mu.RUnlock()
+	return update.trusted
+}
+
+// targetsMetaInfo returns the maximum length of the targets metadata of
+// roleName, and its version if consistent snapshots are used, according
+// to the trusted snapshot metadata
+func targetsMetaInfo(cfg *config.UpdaterConfig, trusted *trustedmetadata.TrustedMetadata, roleName string) (int64, string) {
+	// extract the targets meta from the trusted snapshot metadata
+	metaInfo := trusted.Snapshot.Signed.Meta[fmt.Sprintf("%s.json", roleName)]
+	// extract the length of the target metadata to be downloaded
+	length := metaInfo.Length
+	if length == 0 {
+		length = cfg.TargetsMaxLength
+	}
+	// extract which target metadata version should be downloaded in case of consistent snapshots
+	version := ""
+	if trusted.Root.Signed.ConsistentSnapshot {
+		version = strconv.FormatInt(metaInfo.Version, 10)
+	}
+	return length, version
+}
+
 // loadRoot load remote root metadata. Sequentially load and
 // persist on local disk every newer root metadata version
 // available on the remote
-func (update *Updater) loadRoot() error {
+func (update *Updater) loadRoot(ctx context.Context) (err error) {
+	ctx, end := update.instrument().StartStep(ctx, instrumentation.StepLoadRoot, metadata.ROOT)
+	defer func() { end(err) }()
 	// calculate boundaries
 	lowerBound := update.trusted.Root.Signed.Version + 1
 	upperBound := lowerBound + update.cfg.MaxRootRotations
 
 	// loop until we find the latest available version of root (download -> verify -> load -> persist)
 	for nextVersion := lowerBound; nextVersion < upperBound; nextVersion++ {
-		data, err := update.downloadMetadata(metadata.ROOT, update.cfg.RootMaxLength, strconv.FormatInt(nextVersion, 10))
+		verifyFailed := false
+		data, err := update.downloadMetadata(ctx, metadata.ROOT, update.cfg.RootMaxLength, strconv.FormatInt(nextVersion, 10), func(data []byte) error {
+			// downloading root metadata succeeded, so let's try to verify and load it
+			_, err := update.trusted.UpdateRoot(data)
+			verifyFailed = verifyFailed || err != nil
+			return err
+		})
 		if err != nil {
-			// downloading the root metadata failed for some reason
-			var tmpErr metadata.ErrDownloadHTTP
-			if errors.As(err, &tmpErr) {
-				if tmpErr.StatusCode != http.StatusNotFound && tmpErr.StatusCode != http.StatusForbidden {
-					// unexpected HTTP status code
-					return err
-				}
-				// 404/403 means current root is newest available, so we can stop the loop and move forward
+			// 404/403 means current root is newest available, so we can stop
+			// the loop and move forward. All mirrors are tried first, so a
+			// mirror lagging behind does not hide a newer root served by the
+			// others, while a root failing verification is never skipped.
+			if !verifyFailed && anyNotFound(err) {
 				break
 			}
-			// some other error ocurred
-			return err
-		} else {
-			// downloading root metadata succeeded, so let's try to verify and load it
-			_, err = update.trusted.UpdateRoot(data)
-			if err != nil {
-				return err
-			}
-			// persist root metadata to disk
-			err = update.persistMetadata(metadata.ROOT, data)
-			if err != nil {
-				return err
+			if !verifyFailed {
+				// keep the current root through an outage of the
+				// repository, as far as the expiry policy allows it
+				err = update.keepCached(ctx, update.trusted, metadata.ROOT, err, nil)
+				if err == nil {
+					break
+				}
 			}
+			// unexpected HTTP status code or some other error ocurred
+			return err
+		}
+		// persist root metadata to disk
+		err = update.persistMetadata(metadata.ROOT, data)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -505,8 +1052,11 @@ func (update *Updater) loadRoot() error {
 
 // preOrderDepthFirstWalk interrogates the tree of target delegations
 // in order of appearance (which implicitly order trustworthiness),
-// and returns the matching target found in the most trusted role.
-func (update *Updater) preOrderDepthFirstWalk(targetFilePath string) (*metadata.TargetFiles, error) {
+// and returns the matching target found in the most trusted role along
+// with the chain of delegations from the top-level targets role down to
+// that role, or a nil target if there is none.
+// Delegated roles which are not loaded yet are loaded into trusted.
+func (update *Updater) preOrderDepthFirstWalk(ctx context.Context, trusted *trustedmetadata.TrustedMetadata, targetFilePath string) (*metadata.TargetFiles, []roleParentTuple, error) {
 	log := metadata.GetLogger()
 	// list of delegations to be interrogated. A (role, parent role) pair
 	// is needed to load and verify the delegated targets metadata
@@ -515,44 +1065,69 @@ func (update *Updater) preOrderDepthFirstWalk(targetFilePath string) (*metadata.
 		Parent: metadata.ROOT,
 	}}
 	visitedRoleNames := map[string]bool{}
+	// the chain of delegations leading to each visited role
+	chains := map[string][]roleParentTuple{}
+	// download the metadata of sibling roles ahead of their verification
+	var prefetcher *metadataPrefetcher
+	if update.cfg.PrefetchDelegations {
+		prefetcher = update.newMetadataPrefetcher(ctx, trusted)
+		defer prefetcher.close()
+	}
+	cacheLock := &lazyCacheLock{update: update}
+	defer cacheLock.release()
+	// the length of the deepest chain of delegations visited
+	depth := 0
 	// pre-order depth-first traversal of the graph of target delegations
 	for len(visitedRoleNames) <= update.cfg.MaxDelegations && len(delegationsToVisit) > 0 {
+		// stop walking if the caller is no longer interested in the result
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
 		// pop the role name from the top of the stack
 		delegation := delegationsToVisit[len(delegationsToVisit)-1]
 		delegationsToVisit = delegationsToVisit[:len(delegationsToVisit)-1]
 		// skip any visited current role to prevent cycles
 		_, ok := visitedRoleNames[delegation.Role]
 		if ok {
-			log.Info("Skipping visited current role", "role", delegation.Role)
+			log.Debug("Skipping visited current role", "role", delegation.Role)
 			continue
 		}
 		// the metadata for delegation.Role must be downloaded/updated before
 		// its targets, delegations, and child roles can be inspected
-		targets, err := update.loadTargets(delegation.Role, delegation.Parent)
+		targets, err := update.loadTargetsLocked(ctx, trusted, delegation, prefetcher, cacheLock)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		chain := append(append([]roleParentTuple{}, chains[delegation.Parent]...), delegation)
+		depth = max(depth, len(chain))
 		target, ok := targets.Signed.Targets[targetFilePath]
 		if ok {
-			log.Info("Found target in current role", "role", delegation.Role)
-			return target, nil
+			log.Debug("Found target in current role", "role", delegation.Role, "path", targetFilePath)
+			update.instrument().DelegationWalk(ctx, depth, true)
+			return target, chain, nil
 		}
 		// after pre-order check, add current role to set of visited roles
 		visitedRoleNames[delegation.Role] = true
+		chains[delegation.Role] = chain
 		if targets.Signed.Delegations != nil {
 			childRolesToVisit := []roleParentTuple{}
 			// note that this may be a slow operation if there are many
 			// delegated roles
-			roles := targets.Signed.Delegations.GetRolesForTarget(targetFilePath)
-			for child, terminating := range roles {
-				log.Info("Adding child role", "role", child)
-				childRolesToVisit = append(childRolesToVisit, roleParentTuple{Role: child, Parent: delegation.Role})
-				if terminating {
-					log.Info("Not backtracking to other roles")
+			roles := targets.Signed.Delegations.GetOrderedRolesForTarget(targetFilePath)
+			for _, child := range roles {
+				log.Debug("Adding child role", "role", child.Name)
+				childRolesToVisit = append(childRolesToVisit, roleParentTuple{Role: child.Name, Parent: delegation.Role})
+				if child.Terminating {
+					log.Debug("Not backtracking to other roles", "role", child.Name)
 					delegationsToVisit = []roleParentTuple{}
 					break
 				}
 			}
+			for _, child := range childRolesToVisit {
+				if !visitedRoleNames[child.Role] {
+					prefetcher.prefetch(child.Role)
+				}
+			}
 			// push childRolesToVisit in reverse order of appearance
 			// onto delegationsToVisit. Roles are popped from the end of
 			// the list
@@ -566,10 +1141,86 @@ func (update *Updater) preOrderDepthFirstWalk(targetFilePath string) (*metadata.
 			"allowed-delegations", update.cfg.MaxDelegations)
 	}
 	// if this point is reached then target is not found, return nil
-	return nil, fmt.Errorf("target %s not found", targetFilePath)
+	update.instrument().DelegationWalk(ctx, depth, false)
+	return nil, nil, nil
+}
+
+// loadTargetsLocked returns the trusted metadata of delegation.Role,
+// loading it into trusted with cacheLock held if it is not loaded yet
+func (update *Updater) loadTargetsLocked(ctx context.Context, trusted *trustedmetadata.TrustedMetadata, delegation roleParentTuple, prefetcher *metadataPrefetcher, cacheLock *lazyCacheLock) (*metadata.Metadata[metadata.TargetsType], error) {
+	targets := update.trustedTargets(trusted, delegation.Role)
+	if targets != nil {
+		return targets, nil
+	}
+	err := cacheLock.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return update.loadTargets(ctx, trusted, delegation.Role, delegation.Parent, prefetcher)
+}
+
+// lazyCacheLock locks the local cache on first use only, so that walking
+// roles which are loaded already does not wait for other processes. The
+// cache is locked once metadata has to be loaded, as it may then be
+// persisted.
+type lazyCacheLock struct {
+	update *Updater
+	unlock func()
+}
+
+// lock locks the local cache unless it is locked already
+func (l *lazyCacheLock) lock(ctx context.Context) error {
+	if l.unlock != nil {
+		return nil
+	}
+	unlock, err := l.update.lockCache(ctx)
+	if err != nil {
+		return err
+	}
+	l.unlock = unlock
+	return nil
+}
+
+// release unlocks the local cache if it was locked
+func (l *lazyCacheLock) release() {
+	if l.unlock != nil {
+		l.unlock()
+	}
 }
 
-// persistMetadata writes metadata to disk atomically to avoid data loss
+// lockCache locks the local cache for the exclusive use of this Updater
+// if the store can be shared with other processes. The returned function
+// releases the lock.
+func (update *Updater) lockCache(ctx context.Context) (func(), error) {
+	log := metadata.GetLogger()
+	locker, ok := update.store.(store.Locker)
+	if !ok || update.cfg.DisableLocalCache {
+		return func() {}, nil
+	}
+	ctx, cancel := update.lockContext(ctx)
+	defer cancel()
+	unlock, err := locker.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		err := unlock()
+		if err != nil {
+			log.Info("Failed to unlock the local cache", "error", err.Error())
+		}
+	}, nil
+}
+
+// lockContext limits the wait for a lock to LockTimeout if one is set
+func (update *Updater) lockContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if update.cfg.LockTimeout > 0 {
+		return context.WithTimeout(ctx, update.cfg.LockTimeout)
+	}
+	return ctx, func() {}
+}
+
+// persistMetadata writes metadata to the store. A read-only store is
+// not an error, the metadata is simply not cached.
 func (update *Updater) persistMetadata(roleName string, data []byte) error {
 	log := metadata.GetLogger()
 	// do not persist the metadata if we have disabled local caching
@@ -577,48 +1228,201 @@ func (update *Updater) persistMetadata(roleName string, data []byte) error {
 		return nil
 	}
 	// caching enabled, proceed with persisting the metadata locally
-	fileName := filepath.Join(update.cfg.LocalMetadataDir, fmt.Sprintf("%s.json", url.QueryEscape(roleName)))
-	cwd, err := os.Getwd()
-	if err != nil {
-		return err
+	err := update.store.WriteMetadata(roleName, data)
+	if errors.Is(err, metadata.ErrReadOnly{}) {
+		log.Debug("Not caching metadata in a read-only store", "role", roleName)
+		return nil
+	}
+	return err
+}
+
+// persistTarget writes the content of a target file to the store, which
+// is not an error if the store is read-only
+func (update *Updater) persistTarget(targetPath string, data []byte) error {
+	log := metadata.GetLogger()
+	err := update.store.WriteTarget(targetPath, bytes.NewReader(data))
+	if errors.Is(err, metadata.ErrReadOnly{}) {
+		log.Debug("Not caching target in a read-only store", "path", targetPath)
+		return nil
 	}
-	// create a temporary file
-	file, err := os.CreateTemp(cwd, "tuf_tmp")
+	return err
+}
+
+// readStoredTarget reads the content of a target file from the store
+func (update *Updater) readStoredTarget(targetPath string) ([]byte, error) {
+	in, err := update.store.OpenTarget(targetPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// write the data content to the temporary file
-	err = os.WriteFile(file.Name(), data, 0644)
+	defer in.Close()
+	return io.ReadAll(in)
+}
+
+// downloadMetadata download a metadata file and return it as bytes once
+// verify accepted it. Each metadata mirror is tried in turn until one of
+// them serves metadata passing the verification.
+func (update *Updater) downloadMetadata(ctx context.Context, roleName string, length int64, version string, verify func([]byte) error) ([]byte, error) {
+	// build the file name
+	var fileName string
+	if version == "" {
+		fileName = fmt.Sprintf("%s.json", url.QueryEscape(roleName))
+	} else {
+		fileName = fmt.Sprintf("%s.%s.json", version, url.QueryEscape(roleName))
+	}
+	var data []byte
+	err := update.tryMirrors(ctx, update.metadataMirrors, fileName, func(urlPath string) error {
+		downloaded, err := update.downloadFile(ctx, urlPath, length)
+		if err != nil {
+			return err
+		}
+		update.instrument().Downloaded(ctx, instrumentation.Metadata, int64(len(downloaded)))
+		err = verify(downloaded)
+		if err != nil {
+			update.instrument().VerificationFailed(ctx, instrumentation.Metadata, err)
+			return err
+		}
+		data = downloaded
+		return nil
+	})
 	if err != nil {
-		// delete the temporary file if there was an error while writing
-		errRemove := os.Remove(file.Name())
-		if errRemove != nil {
-			log.Info("Failed to delete temporary file", "name", file.Name())
+		return nil, err
+	}
+	return data, nil
+}
+
+// downloadFile downloads urlPath using the configured fetcher, limiting
+// the download to DownloadTimeout if one is set
+func (update *Updater) downloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	if update.cfg.DownloadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, update.cfg.DownloadTimeout)
+		defer cancel()
+	}
+	return update.cfg.Fetcher.DownloadFile(ctx, urlPath, maxLength)
+}
+
+// downloadStream is like downloadFile but returns the content as a stream.
+// Fetchers which do not implement fetcher.StreamFetcher are served from
+// memory. DownloadTimeout limits the time to get the response and then the
+// time spent waiting for more data, rather than the whole transfer, so
+// that large target files can take as long as they need. Closing the
+// stream stops the timeout.
+func (update *Updater) downloadStream(ctx context.Context, urlPath string, maxLength int64) (io.ReadCloser, error) {
+	streamFetcher, ok := update.cfg.Fetcher.(fetcher.StreamFetcher)
+	if !ok {
+		data, err := update.downloadFile(ctx, urlPath, maxLength)
+		if err != nil {
+			return nil, err
 		}
-		return err
+		return io.NopCloser(bytes.NewReader(data)), nil
 	}
-	// if all okay, rename the temporary file to the desired one
-	err = os.Rename(file.Name(), fileName)
+	ctx, timeout := update.idleTimeout(ctx)
+	body, err := streamFetcher.DownloadFileStream(ctx, urlPath, maxLength)
 	if err != nil {
-		return err
+		err = timeout.err(err)
+		timeout.stop()
+		return nil, err
 	}
-	return nil
+	return &idleTimeoutReader{ReadCloser: body, timeout: timeout}, nil
 }
 
-// downloadMetadata download a metadata file and return it as bytes
-func (update *Updater) downloadMetadata(roleName string, length int64, version string) ([]byte, error) {
-	urlPath := ensureTrailingSlash(update.cfg.RemoteMetadataURL)
-	// build urlPath
-	if version == "" {
-		urlPath = fmt.Sprintf("%s%s.json", urlPath, url.QueryEscape(roleName))
-	} else {
-		urlPath = fmt.Sprintf("%s%s.%s.json", urlPath, version, url.QueryEscape(roleName))
+// downloadRange is like downloadStream but resumes the download at offset
+// if the configured fetcher implements fetcher.RangeFetcher. It returns the
+// offset the stream starts at, which is 0 for any other fetcher.
+func (update *Updater) downloadRange(ctx context.Context, urlPath string, offset, maxLength int64) (io.ReadCloser, int64, error) {
+	rangeFetcher, ok := update.cfg.Fetcher.(fetcher.RangeFetcher)
+	if !ok || offset == 0 {
+		body, err := update.downloadStream(ctx, urlPath, maxLength)
+		return body, 0, err
+	}
+	ctx, timeout := update.idleTimeout(ctx)
+	body, start, err := rangeFetcher.DownloadFileRange(ctx, urlPath, offset, maxLength)
+	if err != nil {
+		err = timeout.err(err)
+		timeout.stop()
+		return nil, 0, err
+	}
+	return &idleTimeoutReader{ReadCloser: body, timeout: timeout}, start, nil
+}
+
+// idleTimeout returns a context which is canceled once DownloadTimeout
+// passes without the returned timeout being reset
+func (update *Updater) idleTimeout(ctx context.Context) (context.Context, *idleTimeout) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := &idleTimeout{ctx: ctx, cancel: cancel, duration: update.cfg.DownloadTimeout}
+	if t.duration > 0 {
+		t.timer = time.AfterFunc(t.duration, func() {
+			cancel(fmt.Errorf("no data received for %s: %w", t.duration, context.DeadlineExceeded))
+		})
+	}
+	return ctx, t
+}
+
+// idleTimeout cancels a download which stalls for too long
+type idleTimeout struct {
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	duration time.Duration
+	timer    *time.Timer
+}
+
+// reset restarts the timeout once data was received
+func (t *idleTimeout) reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.duration)
+	}
+}
+
+// stop stops the timeout and releases its context
+func (t *idleTimeout) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
 	}
-	return update.cfg.Fetcher.DownloadFile(urlPath, length, time.Second*15)
+	t.cancel(nil)
 }
 
-// generateTargetFilePath generates path from TargetFiles
+// err returns the reason for the cancellation of the download instead of
+// err if it was canceled
+func (t *idleTimeout) err(err error) error {
+	if cause := context.Cause(t.ctx); cause != nil && !errors.Is(err, cause) {
+		return fmt.Errorf("%w: %w", cause, err)
+	}
+	return err
+}
+
+// idleTimeoutReader resets the timeout of a stream whenever data is read
+// and stops it once the stream is closed
+type idleTimeoutReader struct {
+	io.ReadCloser
+	timeout *idleTimeout
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.timeout.reset()
+	}
+	if err != nil && err != io.EOF {
+		err = r.timeout.err(err)
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	defer r.timeout.stop()
+	return r.ReadCloser.Close()
+}
+
+// generateTargetFilePath generates path from TargetFiles. The path is
+// empty if the configured store does not keep target files on disk.
 func (update *Updater) generateTargetFilePath(tf *metadata.TargetFiles) (string, error) {
+	if update.cfg.Store != nil {
+		pathStore, ok := update.store.(store.PathStore)
+		if !ok {
+			return "", nil
+		}
+		return pathStore.TargetPath(tf.Path), nil
+	}
 	// LocalTargetsDir can be omitted if caching is disabled
 	if update.cfg.LocalTargetsDir == "" && !update.cfg.DisableLocalCache {
 		return "", metadata.ErrValue{Msg: "LocalTargetsDir must be set if filepath is not given"}
@@ -627,19 +1431,75 @@ func (update *Updater) generateTargetFilePath(tf *metadata.TargetFiles) (string,
 	return url.JoinPath(update.cfg.LocalTargetsDir, url.QueryEscape(tf.Path))
 }
 
-// loadLocalMetadata reads a local <roleName>.json file and returns its bytes
+// loadLocalMetadata reads the cached metadata of roleName from the store
 func (update *Updater) loadLocalMetadata(roleName string) ([]byte, error) {
-	return readFile(fmt.Sprintf("%s.json", roleName))
+	return update.store.ReadMetadata(roleName)
 }
 
 // GetTopLevelTargets returns the top-level target files
 func (update *Updater) GetTopLevelTargets() map[string]*metadata.TargetFiles {
-	return update.trusted.Targets[metadata.TARGETS].Signed.Targets
+	return update.trustedTargets(update.trustedSet(), metadata.TARGETS).Signed.Targets
+}
+
+// DegradedRoles returns the roles whose cached metadata is trusted
+// although it could not be updated, as the ExpiryPolicy of the
+// configuration allowed it, mapped to the time their metadata expires or
+// expired. It is empty as long as trust is not degraded.
+func (update *Updater) DegradedRoles() map[string]time.Time {
+	update.mu.RLock()
+	defer update.mu.RUnlock()
+	return maps.Clone(update.trusted.Degraded)
 }
 
-// GetTrustedMetadataSet returns the trusted metadata set
+// GetTrustedMetadataSet returns a copy of the current trusted metadata
+// set, which is not affected by later refreshes and lookups
 func (update *Updater) GetTrustedMetadataSet() trustedmetadata.TrustedMetadata {
-	return *update.trusted
+	update.mu.RLock()
+	defer update.mu.RUnlock()
+	trusted := *update.trusted
+	trusted.Targets = maps.Clone(update.trusted.Targets)
+	trusted.Degraded = maps.Clone(update.trusted.Degraded)
+	return trusted
+}
+
+// keepCached keeps the cached metadata of roleName in trusted although
+// downloading its update failed with err, which is returned otherwise. The
+// role is then reported by DegradedRoles.
+// Only an ExpiryPolicy allows it, and only if nothing invalid was
+// downloaded; the policy then decides whether the cached metadata is still
+// trusted once expired. reload, if set, loads the cached metadata again.
+func (update *Updater) keepCached(ctx context.Context, trusted *trustedmetadata.TrustedMetadata, roleName string, err error, reload func() error) error {
+	if update.cfg.ExpiryPolicy == nil || ctx.Err() != nil || errors.Is(err, metadata.ErrRepository{}) {
+		return err
+	}
+	update.mu.Lock()
+	keepErr := trusted.KeepCached(roleName)
+	update.mu.Unlock()
+	if keepErr == nil && reload != nil {
+		keepErr = reload()
+	}
+	if keepErr != nil {
+		return errors.Join(err, keepErr)
+	}
+	metadata.GetLogger().Error(err, "Failed to update metadata, keeping the cached one as allowed by the expiry policy, trust is degraded", "role", roleName)
+	return nil
+}
+
+// instrument returns the configured Instrumentation, if any
+func (update *Updater) instrument() instrumentation.Instrumentation {
+	if update.cfg.Instrumentation == nil {
+		return instrumentation.Nop{}
+	}
+	return update.cfg.Instrumentation
+}
+
+// now returns the reference time the expiry of the metadata is checked
+// against, from the configured Clock if any
+func (update *Updater) now() time.Time {
+	if update.cfg.Clock != nil {
+		return update.cfg.Clock().UTC()
+	}
+	return time.Now().UTC()
 }
 
 // ensureTrailingSlash ensures url ends with a slash
@@ -0,0 +1,203 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/fetcher"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// publishingFetcher keeps the simulator from publishing new metadata
+// while it serves a download
+type publishingFetcher struct {
+	mu *sync.RWMutex
+}
+
+func (f publishingFetcher) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return simulator.Sim.DownloadFile(ctx, urlPath, maxLength)
+}
+
+var _ fetcher.Fetcher = publishingFetcher{}
+
+func TestConcurrentLookupsAndRefreshes(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	addDelegatedRoles("delegated.txt", false)
+	contents := [][]byte{}
+	for i := 0; i < 5; i++ {
+		contents = append(contents, []byte(fmt.Sprintf("content of version %d", i)))
+	}
+	publishTarget(contents[0], "top.txt")
+
+	var publishing sync.RWMutex
+	for _, cacheDisabled := range []bool{false, true} {
+		updaterConfig, err := loadUpdaterConfig()
+		assert.NoError(t, err)
+		updaterConfig.Fetcher = publishingFetcher{mu: &publishing}
+		updaterConfig.DisableLocalCache = cacheDisabled
+		updaterConfig.PrefetchDelegations = true
+		updater := initUpdater(updaterConfig)
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					targetInfo, err := updater.GetTargetInfo("top.txt")
+					assert.NoError(t, err)
+					if err == nil {
+						assertPublished(t, targetInfo, contents)
+					}
+					_, err = updater.GetTargetInfo("delegated.txt")
+					assert.NoError(t, err)
+					assertConsistent(t, updater.GetTrustedMetadataSet())
+				}
+			}()
+		}
+		// a background loop refreshes while new versions are published
+		for _, content := range contents[1:] {
+			publishing.Lock()
+			publishTarget(content, "top.txt")
+			publishing.Unlock()
+			err = updater.Refresh()
+			assert.NoError(t, err)
+		}
+		close(stop)
+		wg.Wait()
+
+		targetInfo, err := updater.GetTargetInfo("top.txt")
+		assert.NoError(t, err)
+		assert.NoError(t, targetInfo.VerifyLengthHashes(contents[len(contents)-1]))
+		// back to the first version for the next round
+		publishTarget(contents[0], "top.txt")
+	}
+}
+
+// assertPublished asserts that targetInfo describes one of contents
+func assertPublished(t *testing.T, targetInfo *metadata.TargetFiles, contents [][]byte) {
+	for _, content := range contents {
+		if targetInfo.VerifyLengthHashes(content) == nil {
+			return
+		}
+	}
+	t.Errorf("unexpected target info %v", targetInfo)
+}
+
+// assertConsistent asserts that the metadata of trusted belongs to a
+// single refresh
+func assertConsistent(t *testing.T, trusted trustedmetadata.TrustedMetadata) {
+	snapshotMeta := trusted.Timestamp.Signed.Meta[fmt.Sprintf("%s.json", metadata.SNAPSHOT)]
+	assert.Equal(t, snapshotMeta.Version, trusted.Snapshot.Signed.Version)
+	targetsMeta := trusted.Snapshot.Signed.Meta[fmt.Sprintf("%s.json", metadata.TARGETS)]
+	assert.Equal(t, targetsMeta.Version, trusted.Targets[metadata.TARGETS].Signed.Version)
+}
+
+func TestFailedRefreshKeepsTrustedMetadata(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	publishTarget([]byte("first"), "file.txt")
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	trusted := updater.GetTrustedMetadataSet()
+
+	publishTarget([]byte("second"), "file.txt")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = updater.RefreshContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, trusted.Timestamp, updater.GetTrustedMetadataSet().Timestamp)
+	targetInfo, err := updater.GetTargetInfo("file.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, targetInfo.VerifyLengthHashes([]byte("first")))
+
+	// a later refresh picks the new version up
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	targetInfo, err = updater.GetTargetInfo("file.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, targetInfo.VerifyLengthHashes([]byte("second")))
+}
+
+func TestCheckRollback(t *testing.T) {
+	trustedSet := func(timestampVersion, snapshotVersion int64) *trustedmetadata.TrustedMetadata {
+		timestamp := metadata.Timestamp(simulator.Sim.SafeExpiry)
+		timestamp.Signed.Version = timestampVersion
+		snapshot := metadata.Snapshot(simulator.Sim.SafeExpiry)
+		snapshot.Signed.Version = snapshotVersion
+		return &trustedmetadata.TrustedMetadata{Timestamp: timestamp, Snapshot: snapshot}
+	}
+	for _, tt := range []struct {
+		name    string
+		current *trustedmetadata.TrustedMetadata
+		next    *trustedmetadata.TrustedMetadata
+		wantErr error
+	}{
+		{
+			name:    "first refresh",
+			current: &trustedmetadata.TrustedMetadata{},
+			next:    trustedSet(1, 1),
+		},
+		{
+			name:    "same versions",
+			current: trustedSet(2, 2),
+			next:    trustedSet(2, 2),
+		},
+		{
+			name:    "newer versions",
+			current: trustedSet(2, 2),
+			next:    trustedSet(3, 3),
+		},
+		{
+			name:    "older timestamp",
+			current: trustedSet(2, 2),
+			next:    trustedSet(1, 2),
+			wantErr: metadata.ErrBadVersionNumber{Msg: "new timestamp version 1 must be >= 2"},
+		},
+		{
+			name:    "older snapshot",
+			current: trustedSet(2, 2),
+			next:    trustedSet(2, 1),
+			wantErr: metadata.ErrBadVersionNumber{Msg: "new snapshot version 1 must be >= 2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRollback(tt.current, tt.next)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
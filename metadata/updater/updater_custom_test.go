@@ -0,0 +1,118 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/schema"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// addCustomTarget adds a target file with custom metadata to role
+func addCustomTarget(t *testing.T, role string, targetPath string, custom any) {
+	simulator.Sim.AddTarget(role, []byte(targetPath), targetPath)
+	targets := simulator.Sim.MDTargets.Signed.Targets
+	if role != metadata.TARGETS {
+		targets = simulator.Sim.MDDelegates[role].Signed.Targets
+	}
+	assert.NoError(t, targets[targetPath].SetCustom(custom))
+}
+
+func TestCustomValidators(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	addCustomTarget(t, metadata.TARGETS, "release.tar.gz", map[string]any{"version": "1.2.3"})
+	addCustomTarget(t, metadata.TARGETS, "broken.tar.gz", map[string]any{"version": 3})
+	addCustomTarget(t, metadata.TARGETS, "notes.txt", nil)
+	simulator.Sim.AddDelegation(metadata.TARGETS, metadata.DelegatedRole{
+		Name:      "role1",
+		KeyIDs:    []string{},
+		Threshold: 1,
+		Paths:     []string{"delegated*"},
+	}, metadata.Targets(simulator.Sim.SafeExpiry).Signed)
+	addCustomTarget(t, "role1", "delegated.tar.gz", map[string]any{"version": "1.2.3"})
+	simulator.Sim.UpdateSnapshot()
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updaterConfig.CustomValidators = []config.CustomValidator{
+		{
+			Paths:    []string{"*.tar.gz"},
+			Validate: schema.MustCompile([]byte(`{"type":"object","required":["version"],"properties":{"version":{"type":"string"}}}`)).Validate,
+		},
+		{
+			Role: "role1",
+			Validate: func(custom *json.RawMessage) error {
+				release, err := metadata.CustomAs[map[string]string](&metadata.TargetFiles{Custom: custom})
+				if err != nil {
+					return err
+				}
+				if release["signed-off-by"] == "" {
+					return fmt.Errorf("release is not signed off")
+				}
+				return nil
+			},
+		},
+	}
+	updater := initUpdater(updaterConfig)
+	for _, tt := range []struct {
+		name       string
+		targetPath string
+		wantErr    string
+	}{
+		{
+			name:       "valid custom metadata",
+			targetPath: "release.tar.gz",
+		},
+		{
+			name:       "invalid custom metadata",
+			targetPath: "broken.tar.gz",
+			wantErr:    "target broken.tar.gz listed by targets: /version: expected string, got integer",
+		},
+		{
+			name:       "no validator for the path",
+			targetPath: "notes.txt",
+		},
+		{
+			name:       "validator of the role",
+			targetPath: "delegated.tar.gz",
+			wantErr:    "target delegated.tar.gz listed by role1: release is not signed off",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			targetFile, err := updater.GetTargetInfo(tt.targetPath)
+			_, _, provenanceErr := updater.GetTargetInfoWithProvenance(tt.targetPath)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.NoError(t, provenanceErr)
+				assert.Equal(t, tt.targetPath, targetFile.Path)
+			} else {
+				assert.ErrorIs(t, err, metadata.ErrCustomMetadata{})
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.ErrorIs(t, provenanceErr, metadata.ErrCustomMetadata{})
+			}
+		})
+	}
+
+	// listing fails on invalid custom metadata
+	_, err = updater.ListTargets("release")
+	assert.NoError(t, err)
+	_, err = updater.ListTargets("")
+	assert.ErrorIs(t, err, metadata.ErrCustomMetadata{})
+}
@@ -0,0 +1,292 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+	testutils "github.com/rdimitrov/go-tuf-metadata/testutils/testutils"
+)
+
+// publishTarget adds a target to the top-level targets role of the
+// simulator and publishes new versions of targets, snapshot and timestamp
+func publishTarget(data []byte, targetPath string) {
+	simulator.Sim.AddTarget(metadata.TARGETS, data, targetPath)
+	simulator.Sim.MDTargets.Signed.Version += 1
+	simulator.Sim.UpdateSnapshot()
+}
+
+// targetsURL returns the base URL the simulator serves target files from
+func targetsURL() string {
+	return simulator.LocalDir + "/targets"
+}
+
+// assertNoTemporaryFiles asserts that no partial download files were
+// left behind in dir
+func assertNoTemporaryFiles(t *testing.T, dir string) {
+	matches, err := filepath.Glob(filepath.Join(dir, partialFilePrefix+"*"))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestDownloadTargetTo(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	content := []byte("target content streamed to a writer")
+	publishTarget(content, "stream/file.txt")
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+
+	targetInfo, err := updater.GetTargetInfo("stream/file.txt")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = updater.DownloadTargetTo(targetInfo, &buf, targetsURL())
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+
+	// the repository serves different content than the one in metadata
+	simulator.Sim.TargetFiles["stream/file.txt"] = simulator.RepositoryTarget{
+		Data:       []byte("target content streamed to a writeR"),
+		TargetFile: targetInfo,
+	}
+	buf.Reset()
+	err = updater.DownloadTargetTo(targetInfo, &buf, targetsURL())
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{Msg: "hash verification failed - mismatch for algorithm sha256"})
+}
+
+func TestDownloadTargetToFile(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	content := []byte("target content streamed to a file")
+	publishTarget(content, "file.txt")
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+
+	targetInfo, err := updater.GetTargetInfo("file.txt")
+	assert.NoError(t, err)
+
+	path, err := updater.DownloadTargetToFile(targetInfo, "", targetsURL())
+	assert.NoError(t, err)
+	assert.Equal(t, testutils.TargetsDir, filepath.Dir(path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	assertNoTemporaryFiles(t, testutils.TargetsDir)
+
+	// a target failing verification never replaces the destination file
+	destination := filepath.Join(t.TempDir(), "file.txt")
+	simulator.Sim.TargetFiles["file.txt"] = simulator.RepositoryTarget{
+		Data:       []byte("target content streamed to a fil3"),
+		TargetFile: targetInfo,
+	}
+	_, err = updater.DownloadTargetToFile(targetInfo, destination, targetsURL())
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{})
+	assert.NoFileExists(t, destination)
+	assertNoTemporaryFiles(t, filepath.Dir(destination))
+}
+
+// ignoreRangesFetcher serves the whole content no matter the offset asked
+// for, like a server not supporting ranges
+type ignoreRangesFetcher struct {
+	*simulator.RepositorySimulator
+}
+
+func (f ignoreRangesFetcher) DownloadFileRange(ctx context.Context, urlPath string, offset, maxLength int64) (io.ReadCloser, int64, error) {
+	return f.RepositorySimulator.DownloadFileRange(ctx, urlPath, 0, maxLength)
+}
+
+func TestDownloadTargetToFileResume(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	content := []byte("target content resumed from a partial file")
+	publishTarget(content, "resumed.txt")
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+
+	targetInfo, err := updater.GetTargetInfo("resumed.txt")
+	assert.NoError(t, err)
+
+	destination := filepath.Join(t.TempDir(), "resumed.txt")
+	partial := partialFilePath(destination)
+
+	// resume the download of the first half of the target file
+	err = os.WriteFile(partial, content[:len(content)/2], 0600)
+	assert.NoError(t, err)
+	path, err := updater.DownloadTargetToFile(targetInfo, destination, targetsURL())
+	assert.NoError(t, err)
+	assert.Equal(t, destination, path)
+	data, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	assert.NoFileExists(t, partial)
+
+	// a partial file with unrelated content, e.g. left behind by a target
+	// file which changed since, fails the verification of the resumed
+	// download, which then starts over from the beginning
+	err = os.Remove(destination)
+	assert.NoError(t, err)
+	err = os.WriteFile(partial, []byte("unrelated"), 0600)
+	assert.NoError(t, err)
+	path, err = updater.DownloadTargetToFile(targetInfo, destination, targetsURL())
+	assert.NoError(t, err)
+	assert.Equal(t, destination, path)
+	data, err = os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	assert.NoFileExists(t, partial)
+
+	// content not matching even when downloaded from the beginning fails
+	// and leaves nothing to resume
+	err = os.Remove(destination)
+	assert.NoError(t, err)
+	err = os.WriteFile(partial, content[:len(content)/2], 0600)
+	assert.NoError(t, err)
+	simulator.Sim.TargetFiles["resumed.txt"] = simulator.RepositoryTarget{
+		Data:       []byte("target content resumed from a partial filE"),
+		TargetFile: targetInfo,
+	}
+	_, err = updater.DownloadTargetToFile(targetInfo, destination, targetsURL())
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{Msg: "hash verification failed - mismatch for algorithm sha256"})
+	assert.NoFileExists(t, destination)
+	assert.NoFileExists(t, partial)
+	simulator.Sim.TargetFiles["resumed.txt"] = simulator.RepositoryTarget{Data: content, TargetFile: targetInfo}
+
+	// a server ignoring ranges sends the whole file, which replaces
+	// the content of the partial file
+	err = os.WriteFile(partial, []byte("unrelated"), 0600)
+	assert.NoError(t, err)
+	updaterConfig.Fetcher = ignoreRangesFetcher{simulator.Sim}
+	updater = initUpdater(updaterConfig)
+	path, _, err = updater.DownloadTarget(targetInfo, destination, targetsURL())
+	assert.NoError(t, err)
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	assert.NoFileExists(t, partial)
+
+	// another target file named like a partial file is left alone
+	other := destination + ".partial"
+	err = os.WriteFile(other, []byte("other target"), 0644)
+	assert.NoError(t, err)
+	err = os.Remove(destination)
+	assert.NoError(t, err)
+	_, err = updater.DownloadTargetToFile(targetInfo, destination, targetsURL())
+	assert.NoError(t, err)
+	data, err = os.ReadFile(other)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("other target"), data)
+}
+
+// slowFetcher serves target files a few bytes at a time, waiting for delay
+// before each of them
+type slowFetcher struct {
+	*simulator.RepositorySimulator
+	delay time.Duration
+}
+
+func (f slowFetcher) DownloadFileRange(ctx context.Context, urlPath string, offset, maxLength int64) (io.ReadCloser, int64, error) {
+	body, start, err := f.RepositorySimulator.DownloadFileRange(ctx, urlPath, offset, maxLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(&slowReader{ctx: ctx, data: data, delay: f.delay}), start, nil
+}
+
+func (f slowFetcher) DownloadFileStream(ctx context.Context, urlPath string, maxLength int64) (io.ReadCloser, error) {
+	body, _, err := f.DownloadFileRange(ctx, urlPath, 0, maxLength)
+	return body, err
+}
+
+type slowReader struct {
+	ctx   context.Context
+	data  []byte
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	select {
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	case <-time.After(r.delay):
+	}
+	n := copy(p[:min(len(p), 4)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestDownloadTargetTimeout(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	content := []byte("target content taking longer than the timeout")
+	publishTarget(content, "slow.txt")
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updaterConfig.DownloadTimeout = 100 * time.Millisecond
+	updaterConfig.Fetcher = slowFetcher{RepositorySimulator: simulator.Sim, delay: 20 * time.Millisecond}
+	updater := initUpdater(updaterConfig)
+	targetInfo, err := updater.GetTargetInfo("slow.txt")
+	assert.NoError(t, err)
+
+	// the whole transfer takes longer than the timeout, which only
+	// limits the time spent waiting for data
+	start := time.Now()
+	var buf bytes.Buffer
+	err = updater.DownloadTargetTo(targetInfo, &buf, targetsURL())
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf.Bytes())
+	assert.Greater(t, time.Since(start), updaterConfig.DownloadTimeout)
+	destination := filepath.Join(t.TempDir(), "slow.txt")
+	_, _, err = updater.DownloadTarget(targetInfo, destination, targetsURL())
+	assert.NoError(t, err)
+	updaterConfig.DisableLocalCache = true
+	_, data, err := initUpdater(updaterConfig).DownloadTarget(targetInfo, "", targetsURL())
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	// a stalled transfer times out
+	updaterConfig.DisableLocalCache = false
+	updaterConfig.Fetcher = slowFetcher{RepositorySimulator: simulator.Sim, delay: time.Second}
+	updater = initUpdater(updaterConfig)
+	buf.Reset()
+	err = updater.DownloadTargetTo(targetInfo, &buf, targetsURL())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "no data received for 100ms")
+}
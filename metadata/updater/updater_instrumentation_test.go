@@ -0,0 +1,154 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/instrumentation"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// stepKey is the context key of the step a recordingInstrumentation runs
+type stepKey struct{}
+
+// recordingInstrumentation records what it is reported
+type recordingInstrumentation struct {
+	mu sync.Mutex
+	// steps holds "<parent step> > <step> <role>" for each started step
+	steps []string
+	// failedSteps holds "<step> <role>" for each step ending with an error
+	failedSteps []string
+	downloaded  map[instrumentation.FileKind]int64
+	failures    []string
+	cacheHits   []bool
+	walks       []string
+}
+
+func (r *recordingInstrumentation) StartStep(ctx context.Context, step instrumentation.Step, role string) (context.Context, func(err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parent, _ := ctx.Value(stepKey{}).(instrumentation.Step)
+	r.steps = append(r.steps, fmt.Sprintf("%s > %s %s", parent, step, role))
+	return context.WithValue(ctx, stepKey{}, step), func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err != nil {
+			r.failedSteps = append(r.failedSteps, fmt.Sprintf("%s %s", step, role))
+		}
+	}
+}
+
+func (r *recordingInstrumentation) Downloaded(ctx context.Context, kind instrumentation.FileKind, bytes int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.downloaded == nil {
+		r.downloaded = map[instrumentation.FileKind]int64{}
+	}
+	r.downloaded[kind] += bytes
+}
+
+func (r *recordingInstrumentation) VerificationFailed(ctx context.Context, kind instrumentation.FileKind, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, fmt.Sprintf("%s %s", kind, instrumentation.ErrorType(err)))
+}
+
+func (r *recordingInstrumentation) CachedTarget(ctx context.Context, hit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cacheHits = append(r.cacheHits, hit)
+}
+
+func (r *recordingInstrumentation) DelegationWalk(ctx context.Context, depth int, found bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.walks = append(r.walks, fmt.Sprintf("depth %d found %t", depth, found))
+}
+
+func TestInstrumentation(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("top-level content"), "file.txt")
+	addDelegatedRoles("delegated.txt", false)
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	recorder := &recordingInstrumentation{}
+	updaterConfig.Instrumentation = recorder
+	updater := initUpdater(updaterConfig)
+
+	// the top-level roles are loaded within the refresh
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		" > refresh ",
+		"refresh > load_root root",
+		"refresh > load_timestamp timestamp",
+		"refresh > load_snapshot snapshot",
+		"refresh > load_targets targets",
+	}, recorder.steps)
+	assert.Empty(t, recorder.failedSteps)
+	assert.Positive(t, recorder.downloaded[instrumentation.Metadata])
+
+	// the delegated roles are loaded by the walk of the delegations
+	recorder.steps = nil
+	targetInfo, err := updater.GetTargetInfo("delegated.txt")
+	assert.NoError(t, err)
+	_, err = updater.GetTargetInfo("missing.txt")
+	assert.ErrorIs(t, err, metadata.ErrTargetNotFound{})
+	assert.Equal(t, []string{
+		" > load_targets role1",
+		" > load_targets role2",
+		" > load_targets role3",
+	}, recorder.steps)
+	assert.Equal(t, []string{"depth 2 found true", "depth 2 found false"}, recorder.walks)
+
+	// target files are downloaded once they are not cached
+	path, _, err := updater.FindCachedTarget(targetInfo, "")
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+	_, _, err = updater.DownloadTarget(targetInfo, "", targetsURL())
+	assert.NoError(t, err)
+	path, _, err = updater.FindCachedTarget(targetInfo, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, path)
+	assert.Equal(t, []bool{false, true}, recorder.cacheHits)
+	assert.Equal(t, int64(len("delegated content")), recorder.downloaded[instrumentation.Target])
+
+	// a target file served with a different content fails the verification
+	targetInfo, err = updater.GetTargetInfo("file.txt")
+	assert.NoError(t, err)
+	simulator.Sim.TargetFiles["file.txt"] = simulator.RepositoryTarget{
+		Data:       []byte("tampered content!"),
+		TargetFile: targetInfo,
+	}
+	_, _, err = updater.DownloadTarget(targetInfo, "", targetsURL())
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{})
+	assert.Equal(t, []string{"target length_or_hash_mismatch"}, recorder.failures)
+
+	// as does unsigned metadata, failing the steps loading it
+	delete(simulator.Sim.Signers, metadata.TIMESTAMP)
+	simulator.Sim.MDTimestamp.Signed.Version += 1
+	recorder = &recordingInstrumentation{}
+	updaterConfig.Instrumentation = recorder
+	_, err = runRefresh(updaterConfig, simulator.Sim.SafeExpiry.AddDate(0, 0, -1))
+	assert.ErrorIs(t, err, metadata.ErrUnsignedMetadata{})
+	assert.Equal(t, []string{"metadata unsigned"}, recorder.failures)
+	assert.Equal(t, []string{"load_timestamp timestamp", "refresh "}, recorder.failedSteps)
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// listedPaths returns the path and role of each listed target file
+func listedPaths(listed []ListedTarget) map[string]string {
+	paths := map[string]string{}
+	for _, target := range listed {
+		paths[target.TargetFile.Path] = target.Role
+	}
+	return paths
+}
+
+func TestListTargets(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("a"), "a.txt")
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("b"), "dir/b.txt")
+	for _, role := range []metadata.DelegatedRole{
+		{Name: "role1", Paths: []string{"dir/*"}, Terminating: true},
+		{Name: "role2", Paths: []string{"other/*"}},
+		{Name: "role3", Paths: []string{"dir/*"}},
+	} {
+		role.KeyIDs = []string{}
+		role.Threshold = 1
+		simulator.Sim.AddDelegation(metadata.TARGETS, role, metadata.Targets(simulator.Sim.SafeExpiry).Signed)
+	}
+	simulator.Sim.AddTarget("role1", []byte("shadowed b"), "dir/b.txt")
+	simulator.Sim.AddTarget("role1", []byte("c"), "dir/c.txt")
+	simulator.Sim.AddTarget("role2", []byte("d"), "other/d.txt")
+	// role3 is not reached past the terminating role1
+	simulator.Sim.AddTarget("role3", []byte("e"), "dir/e.txt")
+	simulator.Sim.UpdateSnapshot()
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+	for _, tt := range []struct {
+		name        string
+		pattern     string
+		wantListed  map[string]string
+		wantFetched []string
+	}{
+		{
+			name:    "all target files",
+			pattern: "",
+			wantListed: map[string]string{
+				"a.txt":       metadata.TARGETS,
+				"dir/b.txt":   metadata.TARGETS,
+				"dir/c.txt":   "role1",
+				"other/d.txt": "role2",
+			},
+			wantFetched: []string{"role1", "role2", "role3", "root", "snapshot", "targets", "timestamp"},
+		},
+		{
+			name:    "prefix",
+			pattern: "dir/",
+			wantListed: map[string]string{
+				"dir/b.txt": metadata.TARGETS,
+				"dir/c.txt": "role1",
+			},
+			wantFetched: []string{},
+		},
+		{
+			name:    "glob",
+			pattern: "*/?.txt",
+			wantListed: map[string]string{
+				"dir/b.txt":   metadata.TARGETS,
+				"dir/c.txt":   "role1",
+				"other/d.txt": "role2",
+			},
+			wantFetched: []string{},
+		},
+		{
+			name:        "no match",
+			pattern:     "*.tar.gz",
+			wantListed:  map[string]string{},
+			wantFetched: []string{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			simulator.Sim.FetchTracker.Metadata = []simulator.FTMetadata{}
+			listed, err := updater.ListTargets(tt.pattern)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantListed, listedPaths(listed))
+			// the roles are loaded once
+			assert.Equal(t, tt.wantFetched, fetchedMetadata())
+		})
+	}
+
+	// only the roles which may hold matching target files are loaded
+	simulator.Sim.FetchTracker.Metadata = []simulator.FTMetadata{}
+	updaterConfig.LocalMetadataDir = t.TempDir()
+	updater = initUpdater(updaterConfig)
+	listed, err := updater.ListTargets("other/")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"other/d.txt": "role2"}, listedPaths(listed))
+	assert.Equal(t, []string{"role2", "root", "snapshot", "targets", "timestamp"}, fetchedMetadata())
+}
+
+func TestListTargetsSuccinctRoles(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	simulator.Sim.AddSuccinctRoles(metadata.TARGETS, 2, "bin")
+	succinctRoles := simulator.Sim.MDTargets.Signed.Delegations.SuccinctRoles
+	bins := map[string]string{}
+	for _, targetPath := range []string{"file1.txt", "file2.txt", "file3.txt"} {
+		for bin := range succinctRoles.GetRolesForTarget(targetPath) {
+			simulator.Sim.AddTarget(bin, []byte(targetPath), targetPath)
+			bins[targetPath] = bin
+		}
+	}
+	simulator.Sim.UpdateSnapshot()
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+	listed, err := updater.ListTargets("file")
+	assert.NoError(t, err)
+	assert.Equal(t, bins, listedPaths(listed))
+
+	// no more than MaxDelegations roles are visited, the bins left over
+	// fail the listing
+	updaterConfig.MaxDelegations = 2
+	updater = initUpdater(updaterConfig)
+	listed, err = updater.ListTargets("file")
+	assert.ErrorIs(t, err, metadata.ErrTooManyDelegations{Max: 2, Left: 2})
+	assert.Nil(t, listed)
+}
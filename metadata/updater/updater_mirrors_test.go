@@ -0,0 +1,179 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// mirrorsFetcher serves the repository simulator from any host. The hosts
+// listed in status fail with the given HTTP status code, the hosts listed
+// in corrupt serve files with modified content.
+type mirrorsFetcher struct {
+	status   map[string]int
+	corrupt  map[string]bool
+	requests []string
+}
+
+func (f *mirrorsFetcher) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	u, err := url.Parse(urlPath)
+	if err != nil {
+		return nil, err
+	}
+	f.requests = append(f.requests, u.Host+u.Path)
+	if status, ok := f.status[u.Host]; ok {
+		return nil, metadata.ErrDownloadHTTP{StatusCode: status, URL: urlPath}
+	}
+	data, err := simulator.Sim.DownloadFile(ctx, simulator.LocalDir+u.Path, maxLength)
+	if err != nil {
+		return nil, err
+	}
+	if f.corrupt[u.Host] && len(data) > 0 {
+		data = append([]byte{}, data...)
+		data[len(data)-2] ^= 1
+	}
+	return data, nil
+}
+
+// requested returns the hosts the requests for fileName were sent to
+func (f *mirrorsFetcher) requested(fileName string) []string {
+	hosts := []string{}
+	for _, request := range f.requests {
+		host, path, _ := strings.Cut(request, "/")
+		if strings.HasSuffix(path, fileName) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func loadMirrorsUpdaterConfig(fetcher *mirrorsFetcher) (*config.UpdaterConfig, error) {
+	updaterConfig, err := loadUpdaterConfig()
+	if err != nil {
+		return nil, err
+	}
+	updaterConfig.Fetcher = fetcher
+	updaterConfig.RemoteMetadataURL = "https://primary.invalid/metadata"
+	updaterConfig.RemoteTargetsURL = "https://primary.invalid/targets"
+	updaterConfig.MetadataMirrorURLs = []string{"https://mirror.invalid/metadata"}
+	updaterConfig.TargetsMirrorURLs = []string{"https://mirror.invalid/targets"}
+	return updaterConfig, nil
+}
+
+func TestMirrorsFailover(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		fetcher *mirrorsFetcher
+	}{
+		{
+			name:    "download error",
+			fetcher: &mirrorsFetcher{status: map[string]int{"primary.invalid": http.StatusServiceUnavailable}},
+		},
+		{
+			name:    "verification error",
+			fetcher: &mirrorsFetcher{corrupt: map[string]bool{"primary.invalid": true}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadOrResetTrustedRootMetadata()
+			assert.NoError(t, err)
+			content := []byte("target served by a mirror")
+			publishTarget(content, "mirrored.txt")
+
+			updaterConfig, err := loadMirrorsUpdaterConfig(tt.fetcher)
+			assert.NoError(t, err)
+			updater := initUpdater(updaterConfig)
+
+			err = updater.Refresh()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"primary.invalid", "mirror.invalid"}, tt.fetcher.requested("timestamp.json"))
+			assert.Equal(t, []string{"primary.invalid", "mirror.invalid"}, tt.fetcher.requested("snapshot.json"))
+			assertFilesExist(t, []string{metadata.ROOT, metadata.TIMESTAMP, metadata.SNAPSHOT, metadata.TARGETS})
+
+			targetInfo, err := updater.GetTargetInfo("mirrored.txt")
+			assert.NoError(t, err)
+			_, data, err := updater.DownloadTarget(targetInfo, "", "")
+			assert.NoError(t, err)
+			assert.Equal(t, content, data)
+			assert.Equal(t, []string{"primary.invalid", "mirror.invalid"}, tt.fetcher.requested("mirrored.txt"))
+		})
+	}
+}
+
+func TestMirrorsAllFailing(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	fetcher := &mirrorsFetcher{status: map[string]int{
+		"primary.invalid": http.StatusBadGateway,
+		"mirror.invalid":  http.StatusServiceUnavailable,
+	}}
+	updaterConfig, err := loadMirrorsUpdaterConfig(fetcher)
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+
+	// the error of each mirror is reported
+	err = updater.Refresh()
+	assert.ErrorIs(t, err, metadata.ErrDownloadHTTP{})
+	assert.ErrorContains(t, err, "https://primary.invalid/metadata/2.root.json, http status code: 502")
+	assert.ErrorContains(t, err, "https://mirror.invalid/metadata/2.root.json, http status code: 503")
+}
+
+func TestMirrorsRootNotFoundOnOneMirror(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	// the primary repository lags behind and misses the new root
+	simulator.Sim.MDRoot.Signed.Version += 1
+	simulator.Sim.PublishRoot()
+	fetcher := &mirrorsFetcher{status: map[string]int{"primary.invalid": http.StatusNotFound}}
+	updaterConfig, err := loadMirrorsUpdaterConfig(fetcher)
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updater.trusted.Root.Signed.Version)
+	assert.Equal(t, []string{"primary.invalid", "mirror.invalid"}, fetcher.requested("3.root.json"))
+}
+
+func TestMirrorsPreferFastest(t *testing.T) {
+	mirrors := newMirrorSet(true, "https://a.invalid", "", "https://b.invalid", "https://c.invalid")
+	// mirrors not tried yet come first
+	assert.Equal(t, []string{"https://a.invalid", "https://b.invalid", "https://c.invalid"}, mirrors.ordered())
+
+	mirrors.observe("https://a.invalid", 30*time.Millisecond, nil)
+	mirrors.observe("https://b.invalid", 10*time.Millisecond, nil)
+	mirrors.observe("https://c.invalid", 20*time.Millisecond, nil)
+	assert.Equal(t, []string{"https://b.invalid", "https://c.invalid", "https://a.invalid"}, mirrors.ordered())
+
+	// failing mirrors come last until they succeed again
+	mirrors.observe("https://b.invalid", time.Second, metadata.ErrDownloadHTTP{StatusCode: http.StatusBadGateway})
+	assert.Equal(t, []string{"https://c.invalid", "https://a.invalid", "https://b.invalid"}, mirrors.ordered())
+	mirrors.observe("https://b.invalid", 10*time.Millisecond, nil)
+	assert.Equal(t, []string{"https://b.invalid", "https://c.invalid", "https://a.invalid"}, mirrors.ordered())
+
+	// the configured order is kept unless the fastest mirror is preferred
+	mirrors.preferFastest = false
+	assert.Equal(t, []string{"https://a.invalid", "https://b.invalid", "https://c.invalid"}, mirrors.ordered())
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// bundleFetcher serves the simulator and records the files it served in
+// a bundle laid out like the simulated repository
+type bundleFetcher struct {
+	bundle fstest.MapFS
+}
+
+func (f bundleFetcher) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	data, err := simulator.Sim.DownloadFile(ctx, urlPath, maxLength)
+	if err == nil {
+		f.bundle[strings.TrimPrefix(urlPath, simulator.LocalDir+"/")] = &fstest.MapFile{Data: data}
+	}
+	return data, err
+}
+
+// recordBundle runs an online refresh and downloads targetPaths to
+// return the bundle of the files used
+func recordBundle(t *testing.T, targetPaths ...string) fstest.MapFS {
+	fetcher := bundleFetcher{bundle: fstest.MapFS{}}
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updaterConfig.Fetcher = fetcher
+	updater := initUpdater(updaterConfig)
+	assert.NoError(t, updater.Refresh())
+	for _, targetPath := range targetPaths {
+		targetInfo, err := updater.GetTargetInfo(targetPath)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		_, _, err = updater.DownloadTarget(targetInfo, "", targetsURL())
+		assert.NoError(t, err)
+	}
+	return fetcher.bundle
+}
+
+func TestNewOffline(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	addDelegatedRoles("shipped.txt", false)
+	simulator.Sim.MDRoot.Signed.Version += 1
+	simulator.Sim.PublishRoot()
+	simulator.Sim.UpdateSnapshot()
+	bundle := recordBundle(t, "shipped.txt")
+	assert.Contains(t, bundle, "metadata/2.root.json")
+
+	// the whole chain verifies without network access
+	updater, err := NewOffline(simulator.RootBytes, bundle, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updater.GetTrustedMetadataSet().Root.Signed.Version)
+	targetInfo, err := updater.GetTargetInfo("shipped.txt")
+	assert.NoError(t, err)
+	path, data, err := updater.DownloadTarget(targetInfo, "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+	assert.Equal(t, []byte("delegated content"), data)
+
+	// a tampered target file is rejected
+	for name := range bundle {
+		if strings.HasPrefix(name, "targets/") {
+			bundle[name] = &fstest.MapFile{Data: []byte("tampered target")}
+		}
+	}
+	_, _, err = updater.DownloadTarget(targetInfo, "", "")
+	assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{})
+
+	// so is an incomplete bundle
+	delete(bundle, "metadata/timestamp.json")
+	_, err = NewOffline(simulator.RootBytes, bundle, time.Now())
+	assert.ErrorIs(t, err, metadata.ErrDownloadHTTP{})
+}
+
+func TestNewOfflineReferenceTime(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	now := time.Now()
+	simulator.Sim.MDTimestamp.Signed.Expires = now.Add(7 * 24 * time.Hour)
+	bundle := recordBundle(t)
+
+	// the expiry is checked against the reference time, which later
+	// refreshes keep using
+	updater, err := NewOffline(simulator.RootBytes, bundle, now.Add(6*24*time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, updater.Refresh())
+	_, err = NewOffline(simulator.RootBytes, bundle, now.Add(8*24*time.Hour))
+	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{})
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+	testutils "github.com/rdimitrov/go-tuf-metadata/testutils/testutils"
+)
+
+func TestDownloadTargets(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	contents := map[string][]byte{}
+	for i := 0; i < 10; i++ {
+		targetPath := fmt.Sprintf("batch/file%d.txt", i)
+		contents[targetPath] = []byte(fmt.Sprintf("content of target %d", i))
+		simulator.Sim.AddTarget(metadata.TARGETS, contents[targetPath], targetPath)
+	}
+	simulator.Sim.MDTargets.Signed.Version += 1
+	simulator.Sim.UpdateSnapshot()
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updaterConfig.MaxConcurrentDownloads = 3
+	updater := initUpdater(updaterConfig)
+
+	targetFiles := []*metadata.TargetFiles{}
+	for i := 0; i < 10; i++ {
+		targetInfo, err := updater.GetTargetInfo(fmt.Sprintf("batch/file%d.txt", i))
+		assert.NoError(t, err)
+		targetFiles = append(targetFiles, targetInfo)
+	}
+	// a target listed twice is downloaded once
+	targetFiles = append(targetFiles, targetFiles[0])
+	// a target the repository does not serve
+	missing := metadata.TargetFile()
+	missing.Path = "batch/missing.txt"
+	missing.Length = 10
+	targetFiles = append(targetFiles, missing)
+
+	simulator.Sim.FetchTracker.Targets = []simulator.FTTargets{}
+	paths, err := updater.DownloadTargets(targetFiles, targetsURL())
+	assert.ErrorContains(t, err, "failed to download target batch/missing.txt")
+	assert.Len(t, paths, len(targetFiles))
+	for i, targetFile := range targetFiles[:len(targetFiles)-1] {
+		assert.Equal(t, testutils.TargetsDir, filepath.Dir(paths[i]))
+		data, err := os.ReadFile(paths[i])
+		assert.NoError(t, err)
+		assert.Equal(t, contents[targetFile.Path], data)
+	}
+	assert.Empty(t, paths[len(paths)-1])
+	assert.Len(t, simulator.Sim.FetchTracker.Targets, 11)
+	assertNoTemporaryFiles(t, testutils.TargetsDir)
+}
+
+// addDelegatedRoles delegates "*" to role1, role2 and role3 in order,
+// role3 being the only one listing targetPath
+func addDelegatedRoles(targetPath string, terminating bool) {
+	for _, name := range []string{"role1", "role2", "role3"} {
+		role := metadata.DelegatedRole{
+			Name:        name,
+			KeyIDs:      []string{},
+			Threshold:   1,
+			Terminating: terminating,
+			Paths:       []string{"*"},
+		}
+		simulator.Sim.AddDelegation(metadata.TARGETS, role, metadata.Targets(simulator.Sim.SafeExpiry).Signed)
+	}
+	simulator.Sim.AddTarget("role3", []byte("delegated content"), targetPath)
+	simulator.Sim.UpdateSnapshot()
+}
+
+// fetchedMetadata returns the sorted names of the metadata fetched
+func fetchedMetadata() []string {
+	names := []string{}
+	for _, fetched := range simulator.Sim.FetchTracker.Metadata {
+		names = append(names, fetched.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPrefetchDelegations(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		terminating bool
+		prefetch    bool
+		wantFound   bool
+		wantFetched []string
+	}{
+		{
+			name:        "sequential walk",
+			prefetch:    false,
+			wantFound:   true,
+			wantFetched: []string{"role1", "role2", "role3"},
+		},
+		{
+			name:        "prefetched walk",
+			prefetch:    true,
+			wantFound:   true,
+			wantFetched: []string{"role1", "role2", "role3"},
+		},
+		{
+			name:        "sequential walk stopped by a terminating role",
+			terminating: true,
+			prefetch:    false,
+			wantFound:   false,
+			wantFetched: []string{"role1"},
+		},
+		{
+			name:        "prefetched walk stopped by a terminating role",
+			terminating: true,
+			prefetch:    true,
+			wantFound:   false,
+			wantFetched: []string{"role1"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadOrResetTrustedRootMetadata()
+			assert.NoError(t, err)
+			addDelegatedRoles("delegated.txt", tt.terminating)
+
+			updaterConfig, err := loadUpdaterConfig()
+			assert.NoError(t, err)
+			updaterConfig.PrefetchDelegations = tt.prefetch
+			updater := initUpdater(updaterConfig)
+			err = updater.Refresh()
+			assert.NoError(t, err)
+
+			simulator.Sim.FetchTracker.Metadata = []simulator.FTMetadata{}
+			targetInfo, err := updater.GetTargetInfo("delegated.txt")
+			if tt.wantFound {
+				assert.NoError(t, err)
+				assert.Equal(t, simulator.Sim.TargetFiles["delegated.txt"].TargetFile.Hashes, targetInfo.Hashes)
+			} else {
+				assert.ErrorContains(t, err, "target delegated.txt not found")
+			}
+			assert.Equal(t, tt.wantFetched, fetchedMetadata())
+			for _, role := range tt.wantFetched {
+				assert.NotNil(t, updater.trusted.Targets[role])
+			}
+
+			// cached metadata is not prefetched again
+			updater = initUpdater(updaterConfig)
+			err = updater.Refresh()
+			assert.NoError(t, err)
+			simulator.Sim.FetchTracker.Metadata = []simulator.FTMetadata{}
+			_, _ = updater.GetTargetInfo("delegated.txt")
+			assert.Empty(t, fetchedMetadata())
+		})
+	}
+}
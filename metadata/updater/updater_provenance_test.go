@@ -0,0 +1,98 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// signerKeyIDs returns the sorted IDs of the keys signing the metadata of
+// role in the simulator
+func signerKeyIDs(role string) []string {
+	keyIDs := []string{}
+	for keyID := range simulator.Sim.Signers[role] {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs
+}
+
+func TestGetTargetInfoWithProvenance(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("top-level content"), "top.txt")
+	addDelegatedRoles("delegated.txt", false)
+	nested := metadata.DelegatedRole{
+		Name:      "nested",
+		KeyIDs:    []string{},
+		Threshold: 1,
+		Paths:     []string{"nested*"},
+	}
+	simulator.Sim.AddDelegation("role2", nested, metadata.Targets(simulator.Sim.SafeExpiry).Signed)
+	simulator.Sim.AddTarget("nested", []byte("nested content"), "nested.txt")
+	simulator.Sim.UpdateSnapshot()
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+	for _, tt := range []struct {
+		name       string
+		targetPath string
+		wantChain  [][2]string
+	}{
+		{
+			name:       "top-level targets",
+			targetPath: "top.txt",
+			wantChain:  [][2]string{{metadata.TARGETS, metadata.ROOT}},
+		},
+		{
+			name:       "delegated role",
+			targetPath: "delegated.txt",
+			wantChain:  [][2]string{{metadata.TARGETS, metadata.ROOT}, {"role3", metadata.TARGETS}},
+		},
+		{
+			name:       "nested delegation",
+			targetPath: "nested.txt",
+			wantChain:  [][2]string{{metadata.TARGETS, metadata.ROOT}, {"role2", metadata.TARGETS}, {"nested", "role2"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			targetFile, provenance, err := updater.GetTargetInfoWithProvenance(tt.targetPath)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.targetPath, targetFile.Path)
+			assert.Equal(t, tt.wantChain[len(tt.wantChain)-1][0], provenance.Role)
+			assert.Equal(t, simulator.Sim.MDRoot.Signed.Version, provenance.RootVersion)
+			assert.Equal(t, simulator.Sim.MDTimestamp.Signed.Version, provenance.TimestampVersion)
+			assert.Equal(t, simulator.Sim.MDSnapshot.Signed.Version, provenance.SnapshotVersion)
+			if !assert.Len(t, provenance.Chain, len(tt.wantChain)) {
+				return
+			}
+			for i, step := range provenance.Chain {
+				assert.Equal(t, tt.wantChain[i][0], step.Role)
+				assert.Equal(t, tt.wantChain[i][1], step.Delegator)
+				assert.Equal(t, simulator.Sim.MDSnapshot.Signed.Meta[step.Role+".json"].Version, step.Version)
+				assert.Equal(t, signerKeyIDs(step.Role), step.KeyIDs)
+			}
+		})
+	}
+
+	_, _, err = updater.GetTargetInfoWithProvenance("missing.txt")
+	assert.ErrorContains(t, err, "target missing.txt not found")
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/store"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+func TestMemoryStore(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	content := []byte("target in memory")
+	publishTarget(content, "dir/memory.txt")
+
+	memoryStore := store.NewMemoryStore()
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updaterConfig.LocalMetadataDir = ""
+	updaterConfig.LocalTargetsDir = ""
+	updaterConfig.Store = memoryStore
+	updater := initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	for _, role := range metadata.TOP_LEVEL_ROLE_NAMES {
+		_, err := memoryStore.ReadMetadata(role)
+		assert.NoError(t, err, role)
+	}
+
+	targetInfo, err := updater.GetTargetInfo("dir/memory.txt")
+	assert.NoError(t, err)
+	path, data, err := updater.FindCachedTarget(targetInfo, "")
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+	assert.Nil(t, data)
+	path, data, err = updater.DownloadTarget(targetInfo, "", targetsURL())
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+	assert.Equal(t, content, data)
+	_, data, err = updater.FindCachedTarget(targetInfo, "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+	// DownloadTargetToFile needs a path with such a store
+	_, err = updater.DownloadTargetToFile(targetInfo, "", targetsURL())
+	assert.ErrorIs(t, err, metadata.ErrValue{Msg: "filePath must be set if the store does not keep target files on disk"})
+
+	// a new updater trusts the metadata cached in the store
+	simulator.Sim.FetchTracker.Metadata = []simulator.FTMetadata{}
+	updater = initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	for _, fetched := range simulator.Sim.FetchTracker.Metadata {
+		assert.NotEqual(t, metadata.SNAPSHOT, fetched.Name)
+		assert.NotEqual(t, metadata.TARGETS, fetched.Name)
+	}
+}
+
+func TestReadOnlyStore(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	content := []byte("embedded target")
+	publishTarget(content, "embedded.txt")
+
+	// cache the metadata on disk to build the read-only store from it
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	metadataFS := fstest.MapFS{}
+	for _, role := range metadata.TOP_LEVEL_ROLE_NAMES {
+		data, err := os.ReadFile(filepath.Join(simulator.MetadataDir, role+".json"))
+		assert.NoError(t, err)
+		metadataFS[role+".json"] = &fstest.MapFile{Data: data}
+	}
+
+	updaterConfig.LocalMetadataDir = ""
+	updaterConfig.LocalTargetsDir = ""
+	updaterConfig.Store = store.NewFSStore(metadataFS, fstest.MapFS{
+		"embedded.txt": {Data: content},
+	})
+	updaterConfig.UnsafeLocalMode = true
+	updater = initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	targetInfo, err := updater.GetTargetInfo("embedded.txt")
+	assert.NoError(t, err)
+	_, data, err := updater.FindCachedTarget(targetInfo, "")
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	// the metadata downloaded by an online refresh is not cached
+	publishTarget([]byte("new target"), "new.txt")
+	updaterConfig.UnsafeLocalMode = false
+	updater = initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	targetInfo, err = updater.GetTargetInfo("new.txt")
+	assert.NoError(t, err)
+	_, data, err = updater.DownloadTarget(targetInfo, "", targetsURL())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new target"), data)
+}
+
+func TestSharedCacheLock(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	publishTarget([]byte("shared target"), "shared.txt")
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updaterConfig.LockTimeout = 100 * time.Millisecond
+	updater := initUpdater(updaterConfig)
+
+	// another process holding the lock of the cache blocks the refresh
+	unlock, err := store.NewFileStore(simulator.MetadataDir, "").Lock(context.Background())
+	assert.NoError(t, err)
+	err = updater.Refresh()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, unlock())
+	err = updater.Refresh()
+	assert.NoError(t, err)
+
+	// the same goes for a target file being downloaded
+	targetInfo, err := updater.GetTargetInfo("shared.txt")
+	assert.NoError(t, err)
+	destination := filepath.Join(t.TempDir(), "shared.txt")
+	partial, err := store.LockFile(context.Background(), partialFilePath(destination), os.O_RDWR|os.O_CREATE, 0600)
+	assert.NoError(t, err)
+	_, err = updater.DownloadTargetToFile(targetInfo, destination, targetsURL())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, store.UnlockFile(partial))
+	_, err = updater.DownloadTargetToFile(targetInfo, destination, targetsURL())
+	assert.NoError(t, err)
+	assertNoTemporaryFiles(t, filepath.Dir(destination))
+}
@@ -12,6 +12,7 @@
 package updater
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
 	"github.com/rdimitrov/go-tuf-metadata/metadata/config"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
 	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
 	testutils "github.com/rdimitrov/go-tuf-metadata/testutils/testutils"
 )
@@ -76,24 +78,23 @@ func loadUnsafeUpdaterConfig() (*config.UpdaterConfig, error) {
 }
 
 // runRefresh creates new Updater instance and runs Refresh
-func runRefresh(updaterConfig *config.UpdaterConfig, moveInTime time.Time) (Updater, error) {
+func runRefresh(updaterConfig *config.UpdaterConfig, moveInTime time.Time) (*Updater, error) {
 	if len(simulator.Sim.DumpDir) > 0 {
 		simulator.Sim.Write()
 	}
 
-	updater, err := New(updaterConfig)
+	movedConfig := *updaterConfig
+	movedConfig.Clock = config.FixedClock(moveInTime)
+	updater, err := New(&movedConfig)
 	if err != nil {
 		log.Debugf("failed to create new updater config: %v", err)
-		return Updater{}, err
-	}
-	if moveInTime != time.Now() {
-		updater.trusted.RefTime = moveInTime
+		return nil, err
 	}
 	err = updater.Refresh()
-	return *updater, err
+	return updater, err
 }
 
-func initUpdater(updaterConfig *config.UpdaterConfig) Updater {
+func initUpdater(updaterConfig *config.UpdaterConfig) *Updater {
 	if len(simulator.Sim.DumpDir) > 0 {
 		simulator.Sim.Write()
 	}
@@ -102,7 +103,7 @@ func initUpdater(updaterConfig *config.UpdaterConfig) Updater {
 	if err != nil {
 		log.Debugf("failed to create new updater config: %v", err)
 	}
-	return *updater
+	return updater
 }
 
 // Asserts that local metadata files exist for 'roles'
@@ -136,6 +137,10 @@ func assertFilesExact(t *testing.T, roles []string) {
 
 	actual := []string{}
 	for _, file := range localMetadataFiles {
+		// the lock file of the cache is not metadata
+		if file.Name() == ".lock" {
+			continue
+		}
 		actual = append(actual, file.Name())
 	}
 
@@ -307,6 +312,7 @@ func TestTrustedRootMissing(t *testing.T) {
 	updaterConfig.LocalTrustedRoot = []byte{}
 	_, err = runRefresh(updaterConfig, time.Now())
 	assert.ErrorContains(t, err, "no initial trusted root metadata or remote URL provided")
+	assert.ErrorIs(t, err, metadata.ErrValue{Msg: "no initial trusted root metadata or remote URL provided"})
 	updaterConfig.LocalTrustedRoot = localTrusedRoot
 }
 
@@ -574,6 +580,10 @@ func TestNewTimestampVersionRollback(t *testing.T) {
 	simulator.Sim.MDTimestamp.Signed.Version = 1
 	_, err = runRefresh(updaterConfig, time.Now())
 	assert.ErrorIs(t, err, metadata.ErrBadVersionNumber{Msg: "new timestamp version 1 must be >= 2"})
+	// a rollback can be told apart from other repository errors
+	assert.ErrorIs(t, err, metadata.ErrBadVersionNumber{Role: metadata.TIMESTAMP, Expected: 2, Actual: 1})
+	assert.NotErrorIs(t, err, metadata.ErrBadVersionNumber{Role: metadata.SNAPSHOT})
+	assert.NotErrorIs(t, err, metadata.ErrExpiredMetadata{})
 	assertVersionEquals(t, metadata.TIMESTAMP, 2)
 }
 
@@ -608,6 +618,12 @@ func TestNewTimestampExpired(t *testing.T) {
 	assert.NoError(t, err)
 	_, err = runRefresh(updaterConfig, time.Now())
 	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{Msg: "timestamp.json is expired"})
+	var errExpired metadata.ErrExpiredMetadata
+	if assert.ErrorAs(t, err, &errExpired) {
+		assert.Equal(t, metadata.TIMESTAMP, errExpired.Role)
+		assert.True(t, simulator.PastDateTime.Equal(errExpired.Expires))
+	}
+	assert.NotErrorIs(t, err, metadata.ErrBadVersionNumber{})
 	assertFilesExist(t, []string{metadata.ROOT})
 }
 
@@ -1069,3 +1085,109 @@ func TestTimestampEqVersionsCheck(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, initialTimestampMetadataVer, timestamp.Signed.Meta["snapshot.json"].Version)
 }
+
+func TestRefreshContextCancelled(t *testing.T) {
+	// Test that a cancelled context aborts the refresh before anything
+	// gets downloaded and persisted
+
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = updater.RefreshContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assertFilesExact(t, []string{metadata.ROOT})
+
+	// the same updater refreshes fine with a live context
+	err = updater.RefreshContext(context.Background())
+	assert.NoError(t, err)
+	assertFilesExist(t, metadata.TOP_LEVEL_ROLE_NAMES[:])
+
+	_, err = updater.GetTargetInfoContext(ctx, "anything")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestClock(t *testing.T) {
+	// Test that each refresh checks the expiry against the time returned
+	// by the configured clock
+
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	simulator.Sim.MDTimestamp.Signed.Expires = now.Add(7 * 24 * time.Hour)
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	refTime := now
+	updaterConfig.Clock = func() time.Time { return refTime }
+	updater := initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+	assert.Equal(t, now, updater.GetTrustedMetadataSet().RefTime)
+
+	// the trusted metadata is kept when a later refresh finds it expired
+	refTime = now.Add(8 * 24 * time.Hour)
+	err = updater.Refresh()
+	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{})
+	assert.Equal(t, now, updater.GetTrustedMetadataSet().RefTime)
+
+	// a fixed clock tells whether the metadata was valid at a given date
+	updaterConfig.Clock = config.FixedClock(now.Add(6 * 24 * time.Hour))
+	updater = initUpdater(updaterConfig)
+	err = updater.Refresh()
+	assert.NoError(t, err)
+}
+
+func TestExpiryPolicy(t *testing.T) {
+	// Test that the cached metadata keeps being trusted through an outage
+	// of the repository, as long as the expiry policy allows it
+
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	expires := now.Truncate(time.Second).Add(7 * 24 * time.Hour)
+	simulator.Sim.MDTimestamp.Signed.Expires = expires
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	_, err = runRefresh(updaterConfig, now)
+	assert.NoError(t, err)
+
+	// the repository is down once the cached timestamp expired
+	updaterConfig.Fetcher = failingFetcher{}
+	_, err = runRefresh(updaterConfig, now.Add(8*24*time.Hour))
+	assert.ErrorContains(t, err, "unavailable")
+
+	updaterConfig.ExpiryPolicy = trustedmetadata.GracePeriods(map[string]time.Duration{metadata.TIMESTAMP: 2 * 24 * time.Hour})
+	updater, err := runRefresh(updaterConfig, now.Add(8*24*time.Hour))
+	assert.NoError(t, err)
+	// the root is kept too, although it is not expired
+	degraded := updater.DegradedRoles()
+	assert.Equal(t, expires, degraded[metadata.TIMESTAMP])
+	assert.Contains(t, degraded, metadata.ROOT)
+	assert.NotNil(t, updater.GetTopLevelTargets())
+
+	// the grace period is over
+	_, err = runRefresh(updaterConfig, now.Add(10*24*time.Hour))
+	assert.ErrorContains(t, err, "unavailable")
+
+	// the repository is back
+	updaterConfig.Fetcher = simulator.Sim
+	simulator.Sim.MDTimestamp.Signed.Expires = now.Add(30 * 24 * time.Hour)
+	simulator.Sim.UpdateTimestamp()
+	updater, err = runRefresh(updaterConfig, now.Add(8*24*time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, updater.DegradedRoles())
+
+	// expired metadata served by the repository is not trusted, even
+	// within its grace period
+	simulator.Sim.MDTimestamp.Signed.Expires = now.Add(24 * time.Hour)
+	simulator.Sim.UpdateTimestamp()
+	_, err = runRefresh(updaterConfig, now.Add(2*24*time.Hour))
+	assert.ErrorIs(t, err, metadata.ErrExpiredMetadata{Role: metadata.TIMESTAMP})
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+func TestVerifyLocalTarget(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("artifact"), "artifact.bin")
+	addDelegatedRoles("delegated.bin", false)
+	// a target file whose sha512 hash does not match its content
+	targetFile, err := metadata.TargetFile().FromBytes("mixed.bin", []byte("mixed"), "sha256", "sha512")
+	assert.NoError(t, err)
+	other, err := metadata.TargetFile().FromBytes("mixed.bin", []byte("other"), "sha512")
+	assert.NoError(t, err)
+	targetFile.Hashes["sha512"] = other.Hashes["sha512"]
+	simulator.Sim.MDTargets.Signed.Targets["mixed.bin"] = targetFile
+	simulator.Sim.UpdateSnapshot()
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+	for _, tt := range []struct {
+		name       string
+		targetPath string
+		content    string
+		wantErr    string
+	}{
+		{
+			name:       "matching file",
+			targetPath: "artifact.bin",
+			content:    "artifact",
+		},
+		{
+			name:       "delegated target",
+			targetPath: "delegated.bin",
+			content:    "delegated content",
+		},
+		{
+			name:       "shorter file",
+			targetPath: "artifact.bin",
+			content:    "art",
+			wantErr:    "length verification failed - expected 8, got 3",
+		},
+		{
+			name:       "longer file",
+			targetPath: "artifact.bin",
+			content:    "artifact!",
+			wantErr:    "length verification failed - expected 8, got at least 9",
+		},
+		{
+			name:       "modified file",
+			targetPath: "artifact.bin",
+			content:    "artefact",
+			wantErr:    "hash verification failed - mismatch for algorithm sha256",
+		},
+		{
+			name:       "one hash mismatching",
+			targetPath: "mixed.bin",
+			content:    "mixed",
+			wantErr:    "hash verification failed - mismatch for algorithm sha512",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "file")
+			err := os.WriteFile(filePath, []byte(tt.content), 0644)
+			assert.NoError(t, err)
+			verified, err := updater.VerifyLocalTarget(tt.targetPath, filePath)
+			readerVerified, readerErr := updater.VerifyLocalTargetFromReader(tt.targetPath, bytes.NewReader([]byte(tt.content)))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.NoError(t, readerErr)
+				assert.Equal(t, tt.targetPath, verified.Path)
+				assert.Equal(t, verified, readerVerified)
+			} else {
+				assert.ErrorIs(t, err, metadata.ErrLengthOrHashMismatch{})
+				assert.ErrorContains(t, err, filePath+" does not match target "+tt.targetPath)
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.ErrorIs(t, readerErr, metadata.ErrLengthOrHashMismatch{})
+				assert.ErrorContains(t, readerErr, "local file does not match target "+tt.targetPath)
+			}
+		})
+	}
+
+	// the target file is not in any role
+	_, err = updater.VerifyLocalTargetFromReader("missing.bin", bytes.NewReader(nil))
+	assert.ErrorContains(t, err, "target missing.bin not found")
+	// the local file does not exist
+	_, err = updater.VerifyLocalTarget("artifact.bin", filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	// nothing but metadata was downloaded
+	assert.Empty(t, simulator.Sim.FetchTracker.Targets)
+
+	// the implicit refresh is aborted once the context is done
+	filePath := filepath.Join(t.TempDir(), "file")
+	err = os.WriteFile(filePath, []byte("artifact"), 0644)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = initUpdater(updaterConfig).VerifyLocalTargetContext(ctx, "artifact.bin", filePath)
+	assert.ErrorIs(t, err, context.Canceled)
+}
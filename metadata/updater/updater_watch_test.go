@@ -0,0 +1,187 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	simulator "github.com/rdimitrov/go-tuf-metadata/testutils/simulator"
+)
+
+// nextEvents receives the events of the next refresh, which end with the
+// first event of type last
+func nextEvents(t *testing.T, events <-chan Event, last EventType) []Event {
+	received := []Event{}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("events channel closed")
+			}
+			received = append(received, event)
+			if event.Type == last {
+				return received
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("no %s event received", last)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("kept"), "kept.txt")
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("modified"), "modified.txt")
+	publishTarget([]byte("removed"), "removed.txt")
+
+	var publishing sync.RWMutex
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updaterConfig.Fetcher = publishingFetcher{mu: &publishing}
+	updater := initUpdater(updaterConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := updater.Watch(ctx, WatchConfig{Interval: 10 * time.Millisecond, Jitter: 0.5})
+
+	// the first refresh reports everything as new
+	assert.Equal(t, []Event{
+		{Type: EventNewTimestamp, Role: metadata.TIMESTAMP, Version: simulator.Sim.MDTimestamp.Signed.Version},
+		{Type: EventTargetsChanged, Role: metadata.TARGETS, Added: []string{"kept.txt", "modified.txt", "removed.txt"}},
+	}, nextEvents(t, events, EventTargetsChanged))
+
+	publishing.Lock()
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("added"), "added.txt")
+	simulator.Sim.AddTarget(metadata.TARGETS, []byte("new content"), "modified.txt")
+	delete(simulator.Sim.MDTargets.Signed.Targets, "removed.txt")
+	simulator.Sim.MDTargets.Signed.Version += 1
+	simulator.Sim.UpdateSnapshot()
+	timestampVersion := simulator.Sim.MDTimestamp.Signed.Version
+	publishing.Unlock()
+	assert.Equal(t, []Event{
+		{Type: EventNewTimestamp, Role: metadata.TIMESTAMP, Version: timestampVersion},
+		{Type: EventTargetsChanged, Role: metadata.TARGETS, Added: []string{"added.txt"}, Removed: []string{"removed.txt"}, Modified: []string{"modified.txt"}},
+	}, nextEvents(t, events, EventTargetsChanged))
+
+	publishing.Lock()
+	simulator.Sim.MDRoot.Signed.Version += 1
+	simulator.Sim.PublishRoot()
+	simulator.Sim.UpdateTimestamp()
+	timestampVersion = simulator.Sim.MDTimestamp.Signed.Version
+	publishing.Unlock()
+	assert.Equal(t, []Event{
+		{Type: EventRootRotated, Role: metadata.ROOT, Version: 2},
+		{Type: EventNewTimestamp, Role: metadata.TIMESTAMP, Version: timestampVersion},
+	}, nextEvents(t, events, EventNewTimestamp))
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchFunc(t *testing.T) {
+	err := loadOrResetTrustedRootMetadata()
+	assert.NoError(t, err)
+
+	updaterConfig, err := loadUpdaterConfig()
+	assert.NoError(t, err)
+	updater := initUpdater(updaterConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	received := []Event{}
+	err = updater.WatchFunc(ctx, WatchConfig{ExpiryWarning: 100 * 365 * 24 * time.Hour}, func(event Event) {
+		received = append(received, event)
+		if len(received) == 5 {
+			cancel()
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	expiring := []string{}
+	for _, event := range received[1:] {
+		assert.Equal(t, EventExpiryApproaching, event.Type)
+		assert.False(t, event.Expires.IsZero())
+		expiring = append(expiring, event.Role)
+	}
+	assert.Equal(t, []string{metadata.ROOT, metadata.TIMESTAMP, metadata.SNAPSHOT, metadata.TARGETS}, expiring)
+
+	// a failed refresh is reported and the watch goes on
+	updaterConfig.Fetcher = failingFetcher{}
+	updater = initUpdater(updaterConfig)
+	ctx, cancel = context.WithCancel(context.Background())
+	received = []Event{}
+	err = updater.WatchFunc(ctx, WatchConfig{Interval: time.Millisecond}, func(event Event) {
+		received = append(received, event)
+		if len(received) == 2 {
+			cancel()
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	for _, event := range received {
+		assert.Equal(t, EventRefreshFailed, event.Type)
+		assert.ErrorContains(t, event.Err, "unavailable")
+	}
+}
+
+// failingFetcher fails every download
+type failingFetcher struct{}
+
+func (failingFetcher) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestDiffTargets(t *testing.T) {
+	custom := json.RawMessage(`{"a": 1}`)
+	target := func(length int64, hash string, custom *json.RawMessage) *metadata.TargetFiles {
+		return &metadata.TargetFiles{Length: length, Hashes: metadata.Hashes{"sha256": []byte(hash)}, Custom: custom}
+	}
+	for _, tt := range []struct {
+		name         string
+		previous     map[string]*metadata.TargetFiles
+		current      map[string]*metadata.TargetFiles
+		wantAdded    []string
+		wantRemoved  []string
+		wantModified []string
+	}{
+		{
+			name:     "unchanged",
+			previous: map[string]*metadata.TargetFiles{"a": target(1, "a", nil)},
+			current:  map[string]*metadata.TargetFiles{"a": target(1, "a", nil)},
+		},
+		{
+			name:      "no previous targets",
+			current:   map[string]*metadata.TargetFiles{"b": target(1, "b", nil), "a": target(1, "a", nil)},
+			wantAdded: []string{"a", "b"},
+		},
+		{
+			name:         "length, hashes and custom changes",
+			previous:     map[string]*metadata.TargetFiles{"a": target(1, "a", nil), "b": target(1, "b", nil), "c": target(1, "c", nil), "d": target(1, "d", nil)},
+			current:      map[string]*metadata.TargetFiles{"a": target(2, "a", nil), "b": target(1, "B", nil), "c": target(1, "c", &custom), "e": target(1, "e", nil)},
+			wantAdded:    []string{"e"},
+			wantRemoved:  []string{"d"},
+			wantModified: []string{"a", "b", "c"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, modified := diffTargets(tt.previous, tt.current)
+			assert.Equal(t, tt.wantAdded, added)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, tt.wantModified, modified)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+)
+
+// VerifyLocalTarget checks that the file at filePath, e.g. placed on disk
+// by a build system, is the target file at targetPath according to the
+// trusted metadata, and returns the information about that target file.
+//
+// Unlike FindCachedTarget, the target file is looked up through the
+// delegation tree as GetTargetInfo does, and a detailed error is returned
+// if it is not found in any role or if the length or a hash of the file
+// does not match, in which case the error is an ErrLengthOrHashMismatch.
+// Nothing is downloaded apart from the metadata.
+func (update *Updater) VerifyLocalTarget(targetPath string, filePath string) (*metadata.TargetFiles, error) {
+	return update.VerifyLocalTargetContext(context.Background(), targetPath, filePath)
+}
+
+// VerifyLocalTargetContext is like VerifyLocalTarget but aborts the
+// implicit refresh and the loading of delegated metadata as soon as ctx is
+// done.
+func (update *Updater) VerifyLocalTargetContext(ctx context.Context, targetPath string, filePath string) (*metadata.TargetFiles, error) {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return update.verifyLocalTarget(ctx, targetPath, filePath, in)
+}
+
+// VerifyLocalTargetFromReader is like VerifyLocalTarget but checks the
+// content read from r. At most the length of the target file plus one
+// byte is read.
+func (update *Updater) VerifyLocalTargetFromReader(targetPath string, r io.Reader) (*metadata.TargetFiles, error) {
+	return update.VerifyLocalTargetFromReaderContext(context.Background(), targetPath, r)
+}
+
+// VerifyLocalTargetFromReaderContext is like VerifyLocalTargetFromReader
+// but aborts the implicit refresh and the loading of delegated metadata as
+// soon as ctx is done.
+func (update *Updater) VerifyLocalTargetFromReaderContext(ctx context.Context, targetPath string, r io.Reader) (*metadata.TargetFiles, error) {
+	return update.verifyLocalTarget(ctx, targetPath, "local file", r)
+}
+
+// verifyLocalTarget checks the content read from r, described by name in
+// errors, against the target file at targetPath
+func (update *Updater) verifyLocalTarget(ctx context.Context, targetPath string, name string, r io.Reader) (*metadata.TargetFiles, error) {
+	targetFile, err := update.GetTargetInfoContext(ctx, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	err = targetFile.VerifyLengthHashesFromReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s does not match target %s: %w", name, targetPath, err)
+	}
+	return targetFile, nil
+}
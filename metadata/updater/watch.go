@@ -0,0 +1,234 @@
+// Copyright 2023 VMware, Inc.
+//
+// This product is licensed to you under the BSD-2 license (the "License").
+// You may not use this product except in compliance with the BSD-2 License.
+// This product may include a number of subcomponents with separate copyright
+// notices and license terms. Your use of these subcomponents is subject to
+// the terms and conditions of the subcomponent's license, as noted in the
+// LICENSE file.
+//
+// SPDX-License-Identifier: BSD-2-Clause
+
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/rdimitrov/go-tuf-metadata/metadata"
+	"github.com/rdimitrov/go-tuf-metadata/metadata/trustedmetadata"
+)
+
+// defaultWatchInterval is the time between two refreshes of Watch if
+// WatchConfig.Interval is not set
+const defaultWatchInterval = 5 * time.Minute
+
+// EventType identifies what an Event reports
+type EventType int
+
+const (
+	// EventRootRotated reports a new trusted root version
+	EventRootRotated EventType = iota + 1
+	// EventNewTimestamp reports a new trusted timestamp version
+	EventNewTimestamp
+	// EventTargetsChanged reports changes to the top-level target files
+	EventTargetsChanged
+	// EventExpiryApproaching reports a top-level role expiring within
+	// WatchConfig.ExpiryWarning
+	EventExpiryApproaching
+	// EventRefreshFailed reports a refresh which failed, the previous
+	// trusted metadata stays in use
+	EventRefreshFailed
+	// EventTrustDegraded reports a top-level role whose expired metadata
+	// is trusted because of the ExpiryPolicy of the configuration
+	EventTrustDegraded
+)
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	switch t {
+	case EventRootRotated:
+		return "root rotated"
+	case EventNewTimestamp:
+		return "new timestamp"
+	case EventTargetsChanged:
+		return "targets changed"
+	case EventExpiryApproaching:
+		return "expiry approaching"
+	case EventRefreshFailed:
+		return "refresh failed"
+	case EventTrustDegraded:
+		return "trust degraded"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is emitted by Watch after a refresh. Only the fields relevant to
+// its Type are set.
+type Event struct {
+	Type EventType
+	// Role is the role the event is about
+	Role string
+	// Version is the new version of Role for EventRootRotated and
+	// EventNewTimestamp
+	Version int64
+	// Expires is when Role expires for EventExpiryApproaching, or expired
+	// for EventTrustDegraded
+	Expires time.Time
+	// Added, Removed and Modified list the sorted paths of the top-level
+	// target files which changed for EventTargetsChanged
+	Added    []string
+	Removed  []string
+	Modified []string
+	// Err is the error of EventRefreshFailed
+	Err error
+}
+
+// WatchConfig configures Watch
+type WatchConfig struct {
+	// Interval is the time between two refreshes, 5 minutes if not set
+	Interval time.Duration
+	// Jitter randomizes each interval by up to +/- the given fraction of
+	// it, so a fleet of clients does not refresh all at once
+	Jitter float64
+	// ExpiryWarning emits EventExpiryApproaching after every refresh for
+	// the top-level roles expiring within that duration. Zero disables it.
+	ExpiryWarning time.Duration
+}
+
+// Watch refreshes the trusted metadata right away and then on every
+// interval, until ctx is done. The changes each refresh brings are sent
+// as events on the returned channel, which is closed once ctx is done.
+// The events must be received for the refreshes to go on.
+func (update *Updater) Watch(ctx context.Context, cfg WatchConfig) <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		_ = update.WatchFunc(ctx, cfg, func(event Event) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return events
+}
+
+// WatchFunc is like Watch but calls fn with the events. It blocks until
+// ctx is done and returns its error.
+func (update *Updater) WatchFunc(ctx context.Context, cfg WatchConfig, fn func(Event)) error {
+	log := metadata.GetLogger()
+
+	for {
+		previous := update.trustedSet()
+		err := update.RefreshContext(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Error(err, "Failed to refresh metadata")
+			fn(Event{Type: EventRefreshFailed, Err: err})
+		} else {
+			for _, event := range update.refreshEvents(previous, update.trustedSet(), cfg.ExpiryWarning) {
+				fn(event)
+			}
+		}
+		timer := time.NewTimer(watchInterval(cfg))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// watchInterval returns the time until the next refresh
+func watchInterval(cfg WatchConfig) time.Duration {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	if cfg.Jitter > 0 {
+		interval = time.Duration(float64(interval) * (1 + cfg.Jitter*(2*rand.Float64()-1)))
+	}
+	return interval
+}
+
+// refreshEvents returns the events describing the changes from the
+// previous trusted metadata set to the current one
+func (update *Updater) refreshEvents(previous, current *trustedmetadata.TrustedMetadata, expiryWarning time.Duration) []Event {
+	events := []Event{}
+	if current.Root.Signed.Version != previous.Root.Signed.Version {
+		events = append(events, Event{Type: EventRootRotated, Role: metadata.ROOT, Version: current.Root.Signed.Version})
+	}
+	if previous.Timestamp == nil || current.Timestamp.Signed.Version != previous.Timestamp.Signed.Version {
+		events = append(events, Event{Type: EventNewTimestamp, Role: metadata.TIMESTAMP, Version: current.Timestamp.Signed.Version})
+	}
+	var previousTargets map[string]*metadata.TargetFiles
+	if targets := update.trustedTargets(previous, metadata.TARGETS); targets != nil {
+		previousTargets = targets.Signed.Targets
+	}
+	added, removed, modified := diffTargets(previousTargets, update.trustedTargets(current, metadata.TARGETS).Signed.Targets)
+	if len(added)+len(removed)+len(modified) > 0 {
+		events = append(events, Event{Type: EventTargetsChanged, Role: metadata.TARGETS, Added: added, Removed: removed, Modified: modified})
+	}
+	if expiryWarning > 0 {
+		deadline := update.now().Add(expiryWarning)
+		for _, role := range []struct {
+			name    string
+			expires time.Time
+		}{
+			{metadata.ROOT, current.Root.Signed.Expires},
+			{metadata.TIMESTAMP, current.Timestamp.Signed.Expires},
+			{metadata.SNAPSHOT, current.Snapshot.Signed.Expires},
+			{metadata.TARGETS, update.trustedTargets(current, metadata.TARGETS).Signed.Expires},
+		} {
+			if role.expires.Before(deadline) {
+				events = append(events, Event{Type: EventExpiryApproaching, Role: role.name, Expires: role.expires})
+			}
+		}
+	}
+	for _, role := range metadata.TOP_LEVEL_ROLE_NAMES {
+		if expires, ok := current.Degraded[role]; ok {
+			events = append(events, Event{Type: EventTrustDegraded, Role: role, Expires: expires})
+		}
+	}
+	return events
+}
+
+// diffTargets returns the sorted paths of the target files added to,
+// removed from and modified in previous
+func diffTargets(previous, current map[string]*metadata.TargetFiles) ([]string, []string, []string) {
+	var added, removed, modified []string
+	for path, target := range current {
+		previousTarget, ok := previous[path]
+		if !ok {
+			added = append(added, path)
+		} else if !previousTarget.Equal(*target) || !equalCustom(previousTarget.Custom, target.Custom) {
+			modified = append(modified, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return added, removed, modified
+}
+
+// equalCustom compares the custom fields of two target files
+func equalCustom(a, b *json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(*a, *b)
+}
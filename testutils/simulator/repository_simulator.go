@@ -45,15 +45,18 @@ package simulator
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ed25519"
 	"crypto/sha256"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rdimitrov/go-tuf-metadata/metadata"
@@ -106,6 +109,8 @@ type RepositorySimulator struct {
 	MDTimestamp                    *metadata.Metadata[metadata.TimestampType]
 	MDRoot                         *metadata.Metadata[metadata.RootType]
 	LocalDir                       string
+	// mu serializes downloads, which sign metadata on the fly
+	mu sync.Mutex
 }
 
 // New initializes a RepositorySimulator
@@ -265,10 +270,11 @@ func (rs *RepositorySimulator) PublishRoot() {
 }
 
 func lastIndex(str string, delimiter string) (string, string, string) {
-	// TODO: check if contained and lengths
-	spl := strings.Split(str, delimiter)
-	res := strings.SplitAfterN(str, delimiter, len(spl)-1)
-	return res[0], delimiter, res[1]
+	i := strings.LastIndex(str, delimiter)
+	if i < 0 {
+		return "", "", str
+	}
+	return str[:i], delimiter, str[i+len(delimiter):]
 }
 
 func partition(s string, delimiter string) (string, string) {
@@ -295,7 +301,12 @@ func partition(s string, delimiter string) (string, string) {
 	return version, role
 }
 
-func (rs *RepositorySimulator) DownloadFile(urlPath string, maxLength int64, timeout time.Duration) ([]byte, error) {
+func (rs *RepositorySimulator) DownloadFile(ctx context.Context, urlPath string, maxLength int64) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
 	data, err := rs.fetch(urlPath)
 	if err != nil {
 		return data, err
@@ -308,6 +319,20 @@ func (rs *RepositorySimulator) DownloadFile(urlPath string, maxLength int64, tim
 	return data, err
 }
 
+// DownloadFileRange serves the content of urlPath starting at offset. An
+// offset past the end of the content is ignored and the whole content
+// is served, just like a server not supporting ranges would do.
+func (rs *RepositorySimulator) DownloadFileRange(ctx context.Context, urlPath string, offset, maxLength int64) (io.ReadCloser, int64, error) {
+	data, err := rs.DownloadFile(ctx, urlPath, maxLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset > int64(len(data)) {
+		offset = 0
+	}
+	return io.NopCloser(bytes.NewReader(data[offset:])), offset, nil
+}
+
 func (rs *RepositorySimulator) fetch(urlPath string) ([]byte, error) {
 	parsedURL, _ := url.Parse(urlPath)
 	path := strings.TrimPrefix(parsedURL.Path, rs.LocalDir)
@@ -334,7 +359,7 @@ func (rs *RepositorySimulator) fetch(urlPath string) ([]byte, error) {
 		prefix := ""
 		filename = prefixedFilename
 		if rs.MDRoot.Signed.ConsistentSnapshot && rs.PrefixTargetsWithHash {
-			prefix, filename = partition(prefixedFilename, ".")
+			prefix, filename, _ = strings.Cut(prefixedFilename, ".")
 		}
 		targetPath = fmt.Sprintf("%s%s%s", dirParts, sep, filename)
 		target, err := rs.FetchTarget(targetPath, prefix)
@@ -363,7 +388,7 @@ func (rs *RepositorySimulator) FetchTarget(targetPath string, targetHash string)
 
 func contains(hashes map[string]metadata.HexBytes, targetHash []byte) bool {
 	for _, value := range hashes {
-		if bytes.Equal(value, targetHash) {
+		if value.String() == string(targetHash) {
 			return true
 		}
 	}
@@ -519,6 +544,12 @@ func (rs *RepositorySimulator) AddDelegation(delegatorName string, role metadata
 	if err != nil {
 		log.Debugf("repository simulator: failed to add key: %v", err)
 	}
+	if delegatorName != metadata.TARGETS {
+		// delegated metadata is stored by value, keep its new delegations
+		delegate := rs.MDDelegates[delegatorName]
+		delegate.Signed = *delegator
+		rs.MDDelegates[delegatorName] = delegate
+	}
 	rs.AddSigner(role.Name, mdkey.ID(), *signer)
 	if _, ok := rs.MDDelegates[role.Name]; !ok {
 		rs.MDDelegates[role.Name] = metadata.Metadata[metadata.TargetsType]{
@@ -548,13 +579,12 @@ func (rs *RepositorySimulator) AddSuccinctRoles(delegatorName string, bitLength
 		BitLength:  bitLength,
 		NamePrefix: namePrefix,
 	}
-	delegator.Delegations = &metadata.Delegations{Roles: nil, SuccinctRoles: succinctRoles}
+	delegator.Delegations = &metadata.Delegations{Keys: map[string]*metadata.Key{}, Roles: nil, SuccinctRoles: succinctRoles}
 	// Add targets metadata for all bins
 	for _, delegatedName := range succinctRoles.GetRoles() {
 		rs.MDDelegates[delegatedName] = metadata.Metadata[metadata.TargetsType]{
-			Signed: metadata.TargetsType{
-				Expires: rs.SafeExpiry,
-			},
+			Signed:             metadata.Targets(rs.SafeExpiry).Signed,
+			UnrecognizedFields: map[string]interface{}{},
 		}
 		rs.AddSigner(delegatedName, mdkey.ID(), *signer)
 	}